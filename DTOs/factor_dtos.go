@@ -0,0 +1,22 @@
+package dtos
+
+// FactorsDTO lists the second factors of a user, the preferred one is offered
+// first at login. The phone number of the sms codes is masked
+type FactorsDTO struct {
+	Factors   []string `json:"factors"`
+	Preferred string   `json:"preferred,omitempty"`
+	Phone     string   `json:"phone,omitempty"`
+}
+
+type PreferredFactorDTO struct {
+	Factor string `json:"factor" validate:"required,oneof=totp webauthn sms email"`
+}
+
+type SMSEnrollDTO struct {
+	PhoneNumber string `json:"phoneNumber" validate:"required,max=32"`
+}
+
+// OTPCodeDTO carries a code received by sms or email
+type OTPCodeDTO struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
@@ -0,0 +1,116 @@
+package dtos
+
+// OAuthErr is the error body of the oauth endpoints (RFC 6749 section 5.2),
+// the ApiErr code is sent as the error
+type OAuthErr struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// IntrospectionResponse is the RFC 7662 answer, only active is sent for an
+// invalid, expired or revoked token
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// AuthorizeRequest is the query of /oauth/authorize
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// echoed in the ID token (OpenID Connect)
+	Nonce string
+}
+
+// AuthorizationDTO is a pending authorization shown on the consent screen
+type AuthorizationDTO struct {
+	ID           string   `json:"id"`
+	ClientID     string   `json:"clientId"`
+	ClientName   string   `json:"clientName"`
+	Scopes       []string `json:"scopes"`
+	RedirectURI  string   `json:"redirectUri"`
+	ConsentGiven bool     `json:"consentGiven"`
+}
+
+// TokenResponse is the answer of the token endpoint (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// AuthorizationDecisionDTO is the answer of the user on the consent screen
+type AuthorizationDecisionDTO struct {
+	Approve *bool `json:"approve" validate:"required"`
+}
+
+// UserInfoResponse is the OpenID Connect userinfo, the claims depend on the
+// scopes granted to the token
+type UserInfoResponse struct {
+	Sub               string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// OpenIDConfiguration is the discovery document of the provider (OpenID
+// Connect Discovery 1.0, RFC 8414)
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// DeviceAuthorizationResponse is the answer of the device authorization
+// endpoint (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int32  `json:"interval"`
+}
+
+// DeviceRequestDTO is a pending device authorization shown to the user
+type DeviceRequestDTO struct {
+	UserCode   string   `json:"userCode"`
+	ClientID   string   `json:"clientId"`
+	ClientName string   `json:"clientName"`
+	Scopes     []string `json:"scopes"`
+}
+
+// DeviceDecisionDTO is the answer of the user for the code shown by a device
+type DeviceDecisionDTO struct {
+	UserCode string `json:"userCode" validate:"required"`
+	Approve  *bool  `json:"approve" validate:"required"`
+}
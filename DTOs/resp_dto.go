@@ -18,6 +18,8 @@ type ApiErr struct {
 	Err     string `json:"error"`
 	Code    string `json:"code"`
 	Details any    `json:"details,omitempty"`
+	// response headers sent with the error (Retry-After...)
+	Headers map[string]string `json:"-"`
 }
 
 func (apr *ApiErr) Error() string {
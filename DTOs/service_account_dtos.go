@@ -0,0 +1,18 @@
+package dtos
+
+import "time"
+
+type CreateServiceAccountDTO struct {
+	Name   string   `json:"name" validate:"required,min=3,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,required"`
+}
+
+type ServiceAccountDTO struct {
+	ClientID  string     `json:"clientId"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	// only sent when the account is created or its secret rotated
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
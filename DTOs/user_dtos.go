@@ -11,3 +11,39 @@ type LoginUserDTO struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,pwd"`
+}
+
+type VerifyEmailDTO struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationDTO struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ChangePasswordDTO struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,pwd"`
+	TOTP            string `json:"totp"`
+}
+
+type Disable2FADTO struct {
+	Password string `json:"password" validate:"required"`
+	TOTP     string `json:"totp" validate:"required"`
+}
+
+type MagicLinkDTO struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkCodeDTO struct {
+	Code string `json:"code" validate:"required"`
+}
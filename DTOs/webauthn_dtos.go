@@ -0,0 +1,37 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebAuthnOptionsDTO holds the options passed to navigator.credentials, the
+// challenge id is sent back with the answer of the authenticator
+type WebAuthnOptionsDTO struct {
+	ChallengeID string      `json:"challengeId"`
+	Options     interface{} `json:"options"`
+}
+
+// WebAuthnRegisterDTO carries the PublicKeyCredential returned by
+// navigator.credentials.create
+type WebAuthnRegisterDTO struct {
+	ChallengeID string          `json:"challengeId" validate:"required"`
+	Name        string          `json:"name" validate:"required,max=64"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
+
+// WebAuthnLoginDTO carries the PublicKeyCredential returned by
+// navigator.credentials.get
+type WebAuthnLoginDTO struct {
+	ChallengeID string          `json:"challengeId" validate:"required"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
+
+type WebAuthnCredentialDTO struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	Synced     bool       `json:"synced"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/internal/keyring"
+)
+
+const keysUsage = `usage: app keys <command>
+  list                         show the keys and their states
+  generate [alg] [--activate]  create a verify-only key (EdDSA, ES256 or RS256)
+  promote <kid>                make the key active, the previous one keeps verifying
+  retire <kid>                 stop accepting the key and delete it
+  rotate                       run the scheduled rotation once`
+
+// runKeysCommand manages the key ring of JWT_KEYS_DIR, the running servers
+// pick the changes up on their next reload (SIGHUP or within a minute)
+func runKeysCommand(args []string) error {
+	ring, err := keyring.New()
+	if err != nil {
+		return err
+	}
+	if ring == nil {
+		return errors.New("JWT_KEYS_DIR is not set")
+	}
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		keys, err := ring.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KID\tALG\tSTATE\tCREATED\tACTIVATED\tRETIRE AT")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.KID, key.Alg, key.State,
+				formatTime(&key.CreatedAt), formatTime(key.ActivatedAt), formatTime(key.RetireAt),
+			)
+		}
+		return w.Flush()
+
+	case "generate":
+		alg, activate := "", false
+		for _, arg := range args[1:] {
+			if arg == "--activate" {
+				activate = true
+			} else {
+				alg = arg
+			}
+		}
+		key, err := ring.Generate(alg)
+		if err != nil {
+			return err
+		}
+		if activate {
+			if err := ring.Promote(key.KID); err != nil {
+				return err
+			}
+		}
+		fmt.Println(key.KID)
+		return nil
+
+	case "promote", "retire":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		if args[0] == "promote" {
+			return ring.Promote(args[1])
+		}
+		return ring.Retire(args[1])
+
+	case "rotate":
+		changed, err := ring.Rotate(time.Now())
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Println("nothing to rotate")
+		}
+		return nil
+
+	default:
+		return errors.New(keysUsage)
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,21 +1,35 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/BigBr41n/echoAuth/config"
 	"github.com/BigBr41n/echoAuth/controllers"
 	"github.com/BigBr41n/echoAuth/db"
 	"github.com/BigBr41n/echoAuth/db/sqlc"
 	cstm_mdlwr "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/internal/keyring"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
 	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/BigBr41n/echoAuth/internal/passkey"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/internal/revocation"
+	"github.com/BigBr41n/echoAuth/internal/secretbox"
+	"github.com/BigBr41n/echoAuth/internal/sms"
 	"github.com/BigBr41n/echoAuth/routes"
 	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/clientinfo"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
 )
 
 func main() {
@@ -28,22 +42,136 @@ func main() {
 	// init the logger
 	logger.Init()
 
+	// `app keys ...` manages the signing keys of JWT_KEYS_DIR and exits
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		if err := runKeysCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// keys signing the tokens: the key ring when JWT_KEYS_DIR is set, else the
+	// single key of JWT_SIGNING_KEY_FILE (HS256 without both)
+	signingKeys, err := keyring.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if signingKeys != nil {
+		if _, err := signingKeys.Rotate(time.Now()); err != nil {
+			log.Fatal(err)
+		}
+		if err := signingKeys.Apply(); err != nil {
+			log.Fatal(err)
+		}
+		go signingKeys.Watch()
+	} else if err := jwtImpl.LoadSigningKeys(); err != nil {
+		log.Fatal(err)
+	}
+
+	// client addresses (lockout, rate limits, sessions) behind the proxies
+	if err := clientinfo.TrustProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
+
 	// coonnect to DB
 	db.ConnectDB()
 
 	// init SQLC queries
 	queries := sqlc.New(db.DBPool)
 
+	// encryption keys of the totp secrets
+	totpSecrets, err := secretbox.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !totpSecrets.Enabled() {
+		logger.Warn("TOTP secrets are stored in plaintext, set TOTP_ENC_KEYS and TOTP_ENC_ACTIVE_KEY")
+	}
+
+	// `app reencrypt-totp` re-encrypts the stored secrets with the active key and exits
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt-totp" {
+		if err := reencryptTOTPSecrets(queries, totpSecrets); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// revocation store shared by the logout endpoints and the jwt middleware
+	revocationStore := revocation.NewPostgresStore(queries)
+	cstm_mdlwr.SetRevocationStore(revocationStore)
+
+	// sessions and token pairs, shared by the login and the oauth token endpoint
+	tokenService := services.NewTokenService(queries, db.DBPool, revocationStore)
+
+	// clients of the oauth endpoints (authorization code flow, introspection)
+	oauthService := services.NewOAuthService(queries, db.DBPool, revocationStore, tokenService)
+
+	// `app oauth-clients ...` manages the oauth clients and exits
+	if len(os.Args) > 1 && os.Args[1] == "oauth-clients" {
+		if err := runOAuthClientsCommand(oauthService, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	go reencryptTOTPSecrets(queries, totpSecrets)
+	go purgeRevocations(revocationStore)
+	go purgeAuthorizations(oauthService)
+
+	// failed attempts counters of the login and totp steps
+	lockoutGuard := lockout.NewGuard(lockout.NewPostgresStore(queries))
+	go purgeLockouts(lockoutGuard)
+
+	// rate limits of the routes (memory or redis counters)
+	rateLimiter, err := ratelimit.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cstm_mdlwr.SetRateLimiter(rateLimiter)
+
+	// factors and login age asked by the routes (roles bound to a totp, step up)
+	cstm_mdlwr.SetMFAPolicy(mfapolicy.New())
+
+	// emails (password reset links...)
+	mailSender, err := mailer.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// webauthn relying party (passkeys and security keys)
+	passkeys, err := passkey.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// text messages (sms codes)
+	smsSender, err := sms.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// creating auth service and controller
-	authService := services.NewAuthService(queries, db.DBPool)
+	authService := services.NewAuthService(queries, db.DBPool, tokenService, mailSender, totpSecrets, lockoutGuard, passkeys, smsSender, rateLimiter)
+	go purgeChallenges(authService)
+	// a step up asked from a user without totp points to the setup
+	cstm_mdlwr.SetTOTPEnrollment(authService)
 	authControllers := controllers.NewAuthController(authService)
 
+	// sessions (devices) of the users
+	sessionService := services.NewSessionService(queries, tokenService)
+	cstm_mdlwr.SetSessionTracker(sessionService)
+	sessionControllers := controllers.NewSessionController(sessionService)
+
+	// admin endpoints (unlock accounts...)
+	adminService := services.NewAdminService(queries, lockoutGuard)
+	adminControllers := controllers.NewAdminController(adminService)
+
 	// echo instance & middlewares
 	e := echo.New()
 	e.Use(cstm_mdlwr.LoggerMiddleware)
 	//e.Use(middleware.Recover())
 	e.Use(cstm_mdlwr.RecoverWithJSON())
-	e.Use(middleware.CORS())
+	e.Use(cstm_mdlwr.CORSMiddleware())
 	e.Use(cstm_mdlwr.ResponseHeadersMiddleware)
 
 	// register global custom group
@@ -52,6 +180,21 @@ func main() {
 	// register /user routes
 	routes.RegisterUserRoutes(api, authControllers)
 
+	// register /auth/sessions routes
+	routes.RegisterSessionRoutes(api, sessionControllers)
+
+	// register /admin routes
+	routes.RegisterAdminRoutes(api, adminControllers)
+
+	// register /admin/service-accounts routes
+	routes.RegisterServiceAccountRoutes(api, controllers.NewServiceAccountController(oauthService))
+
+	// register /.well-known routes (jwks, openid configuration)
+	routes.RegisterWellKnownRoutes(e, controllers.NewWellKnownController())
+
+	// register /oauth routes (authorize, token, introspection) and /userinfo
+	routes.RegisterOAuthRoutes(e, controllers.NewOAuthController(oauthService))
+
 	// http 3 setup
 	tlsCert, err := tls.LoadX509KeyPair("server.crt", "server.key")
 	if err != nil {
@@ -89,3 +232,70 @@ func main() {
 		e.Logger.Fatal(err)
 	}
 }
+
+// purgeRevocations drops revoked tokens once they are expired anyway
+func purgeRevocations(store revocation.Store) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := store.Purge(context.Background()); err != nil {
+			logger.Error("failed to purge revoked tokens", zap.Error(err))
+		}
+	}
+}
+
+// purgeAuthorizations drops the expired authorization requests and codes
+func purgeAuthorizations(oauthSrv services.OAuthServiceI) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := oauthSrv.PurgeAuthorizations(context.Background()); err != nil {
+			logger.Error("failed to purge oauth authorizations", zap.Error(err))
+		}
+	}
+}
+
+// purgeChallenges drops the webauthn challenges nobody answered and the
+// expired sms and email codes
+func purgeChallenges(authSrv services.AuthServiceI) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := authSrv.PurgeChallenges(context.Background()); err != nil {
+			logger.Error("failed to purge login challenges", zap.Error(err))
+		}
+	}
+}
+
+// purgeLockouts drops the failed attempts counters that can't lock anymore
+func purgeLockouts(guard *lockout.Guard) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := guard.Purge(context.Background()); err != nil {
+			logger.Error("failed to purge failed attempts", zap.Error(err))
+		}
+	}
+}
+
+// reencryptTOTPSecrets moves the stored totp secrets to the active key
+func reencryptTOTPSecrets(qrs *sqlc.Queries, secrets *secretbox.Keyring) error {
+	updated, err := services.ReencryptTOTPSecrets(context.Background(), qrs, secrets)
+	if err != nil {
+		logger.Error("failed to re-encrypt totp secrets",
+			zap.Int("updated", updated),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	logger.Info("totp secrets re-encrypted",
+		zap.String("activeKey", secrets.ActiveKeyID()),
+		zap.Int("updated", updated),
+	)
+	return nil
+}
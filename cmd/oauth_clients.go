@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BigBr41n/echoAuth/services"
+)
+
+const oauthClientsUsage = `usage: app oauth-clients <command>
+  list                     show the registered clients
+  create <name> [flags] [scope...]
+                           register a client and print its secret (scope introspect by default)
+      --redirect-uri=<uri> allowed redirect of the authorization code flow, repeatable
+      --public             client without secret (native or browser app), pkce only
+      --service            service account using the client_credentials grant
+      --device             device flow for CLIs and TVs, no redirect uri needed
+  revoke <client_id>       disable the client`
+
+// runOAuthClientsCommand manages the clients authenticating to the oauth
+// endpoints
+func runOAuthClientsCommand(oauthSrv services.OAuthServiceI, args []string) error {
+	ctx := context.Background()
+	if len(args) == 0 {
+		return errors.New(oauthClientsUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		clients, err := oauthSrv.ListClients(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT ID\tNAME\tSCOPES\tPUBLIC\tSERVICE\tREDIRECT URIS\tCREATED\tREVOKED")
+		for _, client := range clients {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%s\t%s\t%t\n",
+				client.ClientID, client.Name, strings.Join(client.Scopes, " "),
+				client.Public, client.ServiceAccount, strings.Join(client.RedirectUris, " "),
+				client.CreatedAt.Time.Format("2006-01-02"), client.RevokedAt.Valid,
+			)
+		}
+		return w.Flush()
+
+	case "create":
+		if len(args) < 2 {
+			return errors.New(oauthClientsUsage)
+		}
+		params := &services.OAuthClientParams{Name: args[1]}
+		for _, arg := range args[2:] {
+			switch {
+			case arg == "--public":
+				params.Public = true
+			case arg == "--service":
+				params.ServiceAccount = true
+			case arg == "--device":
+				params.DeviceGrant = true
+			case strings.HasPrefix(arg, "--redirect-uri="):
+				params.RedirectURIs = append(params.RedirectURIs, strings.TrimPrefix(arg, "--redirect-uri="))
+			case strings.HasPrefix(arg, "--"):
+				return errors.New(oauthClientsUsage)
+			default:
+				params.Scopes = append(params.Scopes, arg)
+			}
+		}
+		if len(params.Scopes) == 0 {
+			params.Scopes = []string{services.ScopeIntrospect}
+		}
+		client, secret, err := oauthSrv.CreateClient(ctx, params)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("client_id:     %s\n", client.ClientID)
+		// the secret isn't stored, it can't be shown again
+		if secret != "" {
+			fmt.Printf("client_secret: %s\n", secret)
+		}
+		return nil
+
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(oauthClientsUsage)
+		}
+		return oauthSrv.RevokeClient(ctx, args[1])
+
+	default:
+		return errors.New(oauthClientsUsage)
+	}
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -19,6 +23,117 @@ type Config struct {
 	JWTSEC     string
 	JWTREFSEC  string
 	JWTTOTP    string
+
+	// asymmetric key (PEM: RSA, P-256 or Ed25519) signing the access tokens,
+	// the kid defaults to the key thumbprint. HS256 with JWTSEC when unset
+	JWTSigningKeyFile string
+	JWTSigningKID     string
+
+	// key ring directory (<kid>.pem files + keyring.json), replaces the single
+	// signing key when set. The active key is rotated every JWTKeyRotation (off
+	// when zero) and the previous one keeps verifying for JWTKeyOverlap
+	JWTKeysDir     string
+	JWTKeyRotation time.Duration
+	JWTKeyOverlap  time.Duration
+	// algorithm of the generated keys: EdDSA, ES256 or RS256
+	JWTKeyAlg string
+
+	// public url of the front, used to build the links sent by email
+	AppURL string
+	// page of the front where the user logs in and approves an oauth client,
+	// it gets the request_id of the pending authorization
+	OAuthConsentURL string
+	// page of the front where the user types the code shown by a device
+	OAuthDeviceURL string
+	// page of the front finishing a magic link login, it gets the one time
+	// code to exchange (or the error)
+	MagicLinkURL string
+	// public url of this service, the base of the links opened by the
+	// browser (magic links)
+	APIURL string
+	// origins of the front allowed to call the api with its cookies (the
+	// nonce of the magic links), the origin of APP_URL by default
+	CORSOrigins []string
+	// public url of this service, the iss of the ID tokens and the base of
+	// the endpoints listed in the openid configuration
+	OIDCIssuer string
+
+	// login is refused until the email address is verified
+	RequireEmailVerification bool
+
+	// mailer: smtp, file or memory
+	Mailer       string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+
+	// sms: http, file or memory provider, the http provider posts the
+	// messages as json to the url with the token as a bearer, numbers
+	// written without international prefix get the default country code,
+	// codes sent per number per window
+	SMSProvider           string
+	SMSFrom               string
+	SMSDir                string
+	SMSHTTPURL            string
+	SMSHTTPToken          string
+	SMSDefaultCountryCode string
+	SMSRateLimit          int
+	SMSRateWindow         time.Duration
+
+	// totp: issuer shown in the authenticator app, period in seconds,
+	// 6 or 8 digits, SHA1, SHA256 or SHA512 and the steps allowed around now
+	TOTPIssuer    string
+	TOTPPeriod    uint
+	TOTPDigits    int
+	TOTPAlgorithm string
+	TOTPSkew      uint
+
+	// totp secrets encryption: keys as id:base64key pairs and/or <id>.key
+	// files in a directory, the active key encrypts the new secrets
+	TOTPEncKeys      string
+	TOTPEncKeyDir    string
+	TOTPEncActiveKey string
+
+	// webauthn relying party: the id is the domain of the front (its host by
+	// default), the name is shown by the authenticator and the origins are
+	// the pages allowed to run the ceremonies (the front by default)
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+
+	// brute force protection: failures allowed per account and per ip before
+	// a lock, the first lock lasts the base delay and doubles up to the max,
+	// failures older than the window are forgotten
+	LockoutThreshold   int
+	LockoutIPThreshold int
+	LockoutBaseDelay   time.Duration
+	LockoutMaxDelay    time.Duration
+	LockoutWindow      time.Duration
+
+	// proxies (addresses or CIDR ranges) allowed to set X-Forwarded-For, the
+	// client address of the other requests is the one of the connection
+	TrustedProxies []string
+
+	// rate limiting: memory or redis backend, requests allowed per window on
+	// the public auth routes (per ip) and the authenticated ones (per user),
+	// a limit of 0 disables the rule
+	RateLimitBackend    string
+	RedisURL            string
+	RateLimitAuthLimit  int
+	RateLimitAuthWindow time.Duration
+	RateLimitUserLimit  int
+	RateLimitUserWindow time.Duration
+
+	// multi factor policy: roles that must log in with a totp, max age of the
+	// login for every route (0 for no limit) and for the sensitive ones, life
+	// of the elevated token minted by a step up
+	MFARequiredRoles []string
+	MFASessionMaxAge time.Duration
+	StepUpMaxAge     time.Duration
+	StepUpTokenTTL   time.Duration
 }
 
 var AppConfig Config
@@ -58,6 +173,75 @@ func Init() error {
 			JWTSEC:     os.Getenv("JWT_SECRET"),
 			JWTREFSEC:  os.Getenv("JWT_REF_SEC"),
 			JWTTOTP:    os.Getenv("JWTTOTP"),
+
+			JWTSigningKeyFile: os.Getenv("JWT_SIGNING_KEY_FILE"),
+			JWTSigningKID:     os.Getenv("JWT_SIGNING_KID"),
+
+			JWTKeysDir:     os.Getenv("JWT_KEYS_DIR"),
+			JWTKeyRotation: getEnvDuration("JWT_KEY_ROTATION", 0),
+			JWTKeyOverlap:  getEnvDuration("JWT_KEY_OVERLAP", 8*24*time.Hour),
+			JWTKeyAlg:      getEnv("JWT_KEY_ALG", "EdDSA"),
+
+			AppURL: os.Getenv("APP_URL"),
+
+			RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", false),
+
+			Mailer:       os.Getenv("MAILER"),
+			MailFrom:     os.Getenv("MAIL_FROM"),
+			MailDir:      os.Getenv("MAIL_DIR"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     os.Getenv("SMTP_PORT"),
+			SMTPUser:     os.Getenv("SMTP_USER"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+			SMSProvider:           os.Getenv("SMS_PROVIDER"),
+			SMSFrom:               os.Getenv("SMS_FROM"),
+			SMSDir:                os.Getenv("SMS_DIR"),
+			SMSHTTPURL:            os.Getenv("SMS_HTTP_URL"),
+			SMSHTTPToken:          os.Getenv("SMS_HTTP_TOKEN"),
+			SMSDefaultCountryCode: strings.TrimPrefix(os.Getenv("SMS_DEFAULT_COUNTRY_CODE"), "+"),
+
+			TOTPIssuer:    getEnv("TOTP_ISSUER", "goEchoAuthApp"),
+			TOTPPeriod:    uint(getEnvInt("TOTP_PERIOD", 30)),
+			TOTPDigits:    getEnvInt("TOTP_DIGITS", 6),
+			TOTPAlgorithm: strings.ToUpper(getEnv("TOTP_ALGORITHM", "SHA1")),
+			TOTPSkew:      uint(getEnvInt("TOTP_SKEW", 1)),
+
+			TOTPEncKeys:      os.Getenv("TOTP_ENC_KEYS"),
+			TOTPEncKeyDir:    os.Getenv("TOTP_ENC_KEY_DIR"),
+			TOTPEncActiveKey: os.Getenv("TOTP_ENC_ACTIVE_KEY"),
+
+			LockoutThreshold:   getEnvInt("LOCKOUT_THRESHOLD", 5),
+			LockoutIPThreshold: getEnvInt("LOCKOUT_IP_THRESHOLD", 20),
+			LockoutBaseDelay:   getEnvDuration("LOCKOUT_BASE_DELAY", time.Minute),
+			LockoutMaxDelay:    getEnvDuration("LOCKOUT_MAX_DELAY", time.Hour),
+			LockoutWindow:      getEnvDuration("LOCKOUT_WINDOW", 24*time.Hour),
+
+			RateLimitBackend: os.Getenv("RATE_LIMIT_BACKEND"),
+			RedisURL:         getEnv("REDIS_URL", "redis://localhost:6379/0"),
+
+			OIDCIssuer: strings.TrimSuffix(getEnv("OIDC_ISSUER", "https://localhost:8443"), "/"),
+			APIURL:     strings.TrimSuffix(getEnv("API_URL", "https://localhost:8443"), "/"),
+		}
+
+		AppConfig.OAuthConsentURL = getEnv("OAUTH_CONSENT_URL", AppConfig.AppURL+"/oauth/consent")
+		AppConfig.OAuthDeviceURL = getEnv("OAUTH_DEVICE_URL", AppConfig.AppURL+"/oauth/device")
+		AppConfig.MagicLinkURL = getEnv("MAGIC_LINK_URL", AppConfig.AppURL+"/magic-link")
+		AppConfig.CORSOrigins = getEnvList("CORS_ORIGINS", originOf(AppConfig.AppURL))
+		AppConfig.WebAuthnRPName = getEnv("WEBAUTHN_RP_NAME", AppConfig.TOTPIssuer)
+		AppConfig.WebAuthnRPID = getEnv("WEBAUTHN_RP_ID", hostOf(AppConfig.AppURL))
+		AppConfig.WebAuthnOrigins = getEnvList("WEBAUTHN_ORIGINS", AppConfig.AppURL)
+		AppConfig.RateLimitAuthLimit, AppConfig.RateLimitAuthWindow = getEnvRate("RATE_LIMIT_AUTH", 10, time.Minute)
+		AppConfig.RateLimitUserLimit, AppConfig.RateLimitUserWindow = getEnvRate("RATE_LIMIT_USER", 300, time.Minute)
+		AppConfig.SMSRateLimit, AppConfig.SMSRateWindow = getEnvRate("SMS_RATE_LIMIT", 5, time.Hour)
+		AppConfig.TrustedProxies = getEnvList("TRUSTED_PROXIES", "")
+		AppConfig.MFARequiredRoles = getEnvList("MFA_REQUIRED_ROLES", "seller,investor")
+		AppConfig.MFASessionMaxAge = getEnvDuration("MFA_SESSION_MAX_AGE", 0)
+		AppConfig.StepUpMaxAge = getEnvDuration("STEP_UP_MAX_AGE", 10*time.Minute)
+		AppConfig.StepUpTokenTTL = getEnvDuration("STEP_UP_TOKEN_TTL", 5*time.Minute)
+
+		if err = validateTOTP(&AppConfig); err != nil {
+			return err
 		}
 
 		log.Println("Configuration loaded successfully")
@@ -68,3 +252,103 @@ func Init() error {
 	return err
 
 }
+
+// getEnvBool parses a boolean env var, the default is used when unset or invalid
+func getEnvBool(key string, def bool) bool {
+	val, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// getEnv returns the env var or the default when unset
+func getEnv(key string, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
+
+// getEnvList splits a comma separated env var, the default is used when unset
+func getEnvList(key string, def string) []string {
+	list := []string{}
+	for _, val := range strings.Split(getEnv(key, def), ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			list = append(list, val)
+		}
+	}
+	return list
+}
+
+// hostOf returns the host name of a url without its port, empty when invalid
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// originOf returns the scheme and host of a url, empty when invalid
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// getEnvInt parses a non negative integer env var, the default is used when
+// unset or invalid
+func getEnvInt(key string, def int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || val < 0 {
+		return def
+	}
+	return val
+}
+
+// getEnvDuration parses a duration env var (15m, 1h...), the default is used
+// when unset or invalid
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	val, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || val <= 0 {
+		return def
+	}
+	return val
+}
+
+// getEnvRate parses a rate env var written limit/window (10/1m), the defaults
+// are used when unset or invalid
+func getEnvRate(key string, defLimit int, defWindow time.Duration) (int, time.Duration) {
+	limitStr, windowStr, ok := strings.Cut(os.Getenv(key), "/")
+	if !ok {
+		return defLimit, defWindow
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+	if err != nil || limit < 0 {
+		return defLimit, defWindow
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowStr))
+	if err != nil || window <= 0 {
+		return defLimit, defWindow
+	}
+	return limit, window
+}
+
+// validateTOTP rejects totp settings authenticator apps can't follow
+func validateTOTP(cfg *Config) error {
+	if cfg.TOTPPeriod == 0 {
+		return fmt.Errorf("TOTP_PERIOD must be greater than 0")
+	}
+	if cfg.TOTPDigits != 6 && cfg.TOTPDigits != 8 {
+		return fmt.Errorf("TOTP_DIGITS must be 6 or 8, got %d", cfg.TOTPDigits)
+	}
+	switch cfg.TOTPAlgorithm {
+	case "SHA1", "SHA256", "SHA512":
+	default:
+		return fmt.Errorf("TOTP_ALGORITHM must be SHA1, SHA256 or SHA512, got %q", cfg.TOTPAlgorithm)
+	}
+	return nil
+}
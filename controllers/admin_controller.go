@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+type AdminController struct {
+	admv services.AdminServiceI
+}
+
+type AdminControllerI interface {
+	UnlockUser(c echo.Context) error
+	UnlockIP(c echo.Context) error
+}
+
+func NewAdminController(admSrv services.AdminServiceI) AdminControllerI {
+	return &AdminController{
+		admv: admSrv,
+	}
+}
+
+func (ac *AdminController) UnlockUser(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	// set by JwtAuthMidd, the admin may be a service account
+	by, _ := principal.FromContext(c)
+
+	var userID pgtype.UUID
+	if err := userID.Scan(c.Param("id")); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_USER_ID",
+			Err:     "Invalid user id",
+			Details: nil,
+		})
+	}
+
+	if err := ac.admv.UnlockUser(ctx, by, userID, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "ACCOUNT_UNLOCKED",
+		Message: "account unlocked successfully",
+		Data:    nil,
+	})
+}
+
+func (ac *AdminController) UnlockIP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	by, _ := principal.FromContext(c)
+
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_IP",
+			Err:     "Invalid ip address",
+			Details: nil,
+		})
+	}
+
+	if err := ac.admv.UnlockIP(ctx, by, ip.String()); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "IP_UNLOCKED",
+		Message: "ip unlocked successfully",
+		Data:    nil,
+	})
+}
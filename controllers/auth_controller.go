@@ -2,12 +2,12 @@ package controllers
 
 import (
 	"net/http"
-	"os"
 	"strings"
 
 	dtos "github.com/BigBr41n/echoAuth/DTOs"
 	"github.com/BigBr41n/echoAuth/internal/logger"
 	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/clientinfo"
 	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
 	"github.com/BigBr41n/echoAuth/utils/response"
 	"github.com/BigBr41n/echoAuth/utils/validator"
@@ -24,14 +24,58 @@ type AuthControllerI interface {
 	RegisterNewUser(c echo.Context) error
 	LoginUser(c echo.Context) error
 	RefreshAxsToken(c echo.Context) error
-	Enable2FA(c echo.Context) error
+	Logout(c echo.Context) error
+	LogoutAll(c echo.Context) error
+	ForgotPassword(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	ChangePassword(c echo.Context) error
+	VerifyEmail(c echo.Context) error
+	ResendVerification(c echo.Context) error
+	Setup2FA(c echo.Context) error
+	Confirm2FA(c echo.Context) error
+	Disable2FA(c echo.Context) error
+	RegenerateRecoveryCodes(c echo.Context) error
+	RecoveryCodesStatus(c echo.Context) error
 	ValidateTOTP(c echo.Context) error
+	BeginWebAuthnRegistration(c echo.Context) error
+	FinishWebAuthnRegistration(c echo.Context) error
+	ListWebAuthnCredentials(c echo.Context) error
+	DeleteWebAuthnCredential(c echo.Context) error
+	EnableWebAuthnSecondFactor(c echo.Context) error
+	DisableWebAuthnSecondFactor(c echo.Context) error
+	BeginWebAuthnLogin(c echo.Context) error
+	FinishWebAuthnLogin(c echo.Context) error
+	ListFactors(c echo.Context) error
+	SetPreferredFactor(c echo.Context) error
+	EnableEmailOTP(c echo.Context) error
+	DisableEmailOTP(c echo.Context) error
+	LoginFactors(c echo.Context) error
+	SendEmailOTP(c echo.Context) error
+	ValidateEmailOTP(c echo.Context) error
+	EnrollSMS(c echo.Context) error
+	ConfirmSMS(c echo.Context) error
+	DisableSMS(c echo.Context) error
+	SendSMSOTP(c echo.Context) error
+	ValidateSMSOTP(c echo.Context) error
+	RequestMagicLink(c echo.Context) error
+	MagicLinkCallback(c echo.Context) error
+	ExchangeMagicLinkCode(c echo.Context) error
+	StepUp(c echo.Context) error
 }
 
 type TOTPInput struct {
 	TOTP string `json:"totp"`
 }
 
+// clientInfo collects the device details recorded with a new session
+func clientInfo(c echo.Context) *services.ClientInfo {
+	return &services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IP:        clientinfo.IP(c),
+		Protocol:  clientinfo.Protocol(c),
+	}
+}
+
 func NewAuthController(usrSrv services.AuthServiceI) AuthControllerI {
 	return &AuthController{
 		userv: usrSrv,
@@ -101,7 +145,7 @@ func (uc *AuthController) LoginUser(c echo.Context) error {
 	}
 
 	// login the user
-	if accessTok, refreshTok, err = uc.userv.Login(ctx, (*services.Credentials)(&loUserDTO)); err != nil {
+	if accessTok, refreshTok, err = uc.userv.Login(ctx, (*services.Credentials)(&loUserDTO), clientInfo(c)); err != nil {
 		return response.ErrResp(c, err)
 	}
 	// returning tokens
@@ -117,8 +161,11 @@ func (uc *AuthController) LoginUser(c echo.Context) error {
 }
 
 func (uc *AuthController) RefreshAxsToken(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
 	authHeader := c.Request().Header.Get("Authorization")
-	oldToken := c.Request().Header.Get("X-Old-Token")
 
 	authErr := &dtos.ApiErr{
 		Status:  http.StatusBadRequest,
@@ -131,51 +178,294 @@ func (uc *AuthController) RefreshAxsToken(c echo.Context) error {
 		authErr.Err = "Autherization header missed"
 		return response.ErrResp(c, authErr)
 	}
-	if oldToken == "" {
-		authErr.Err = "Old token missed"
-		return response.ErrResp(c, authErr)
-	}
 
 	// Check if it's a Bearer token
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 		authErr.Err = "Invalid Authorization header format"
 		authErr.Code = "INVALID_TOKEN_FORMAT"
-		return c.JSON(http.StatusUnauthorized, authErr)
+		authErr.Status = http.StatusUnauthorized
+		return response.ErrResp(c, authErr)
+	}
+
+	// rotate the refresh token, the old one can't be used anymore
+	accessTok, refreshTok, err := uc.userv.RefreshUserToken(ctx, parts[1])
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "TOKEN_REFRESHED",
+		Message: "tokens refreshed successfully",
+		Data: map[string]interface{}{
+			"accessToken":  accessTok,
+			"refreshToken": refreshTok,
+		},
+	})
+}
+
+func (uc *AuthController) Logout(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.Logout(ctx, userData); err != nil {
+		return response.ErrResp(c, err)
 	}
 
-	token := parts[1]
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "LOGGED_OUT",
+		Message: "user logged out successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) LogoutAll(c echo.Context) error {
 
-	newRefTok, err := uc.userv.RefreshUserToken(token, oldToken)
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.LogoutAll(ctx, userData.UserID); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "LOGGED_OUT_ALL",
+		Message: "user logged out from all sessions successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) ForgotPassword(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var forgotDTO dtos.ForgotPasswordDTO
+
+	if err := c.Bind(&forgotDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&forgotDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.ForgotPassword(ctx, forgotDTO.Email); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	// same answer whether the email is registered or not
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "RESET_EMAIL_SENT",
+		Message: "if the email is registered, a reset link has been sent to it",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) ResetPassword(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var resetDTO dtos.ResetPasswordDTO
+
+	if err := c.Bind(&resetDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&resetDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.ResetPassword(ctx, resetDTO.Token, resetDTO.Password); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "PASSWORD_RESET",
+		Message: "password changed successfully, login again",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) ChangePassword(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+	var changeDTO dtos.ChangePasswordDTO
+
+	if err := c.Bind(&changeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&changeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	accessTok, refreshTok, err := uc.userv.ChangePassword(ctx, userData, (*services.PasswordChange)(&changeDTO), clientInfo(c))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+		return response.ErrResp(c, err)
+	}
+
+	// the other sessions are signed out, this one continues with new tokens
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "PASSWORD_CHANGED",
+		Message: "password changed successfully, other sessions are signed out",
+		Data: map[string]interface{}{
+			"accessToken":  accessTok,
+			"refreshToken": refreshTok,
+		},
+	})
+}
+
+func (uc *AuthController) VerifyEmail(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var verifyDTO dtos.VerifyEmailDTO
+
+	if err := c.Bind(&verifyDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
 	}
 
-	return c.JSON(http.StatusAccepted, map[string]string{
-		"message": newRefTok,
+	if err := validator.Validate(&verifyDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.VerifyEmail(ctx, verifyDTO.Token); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "EMAIL_VERIFIED",
+		Message: "email verified successfully",
+		Data:    nil,
 	})
 }
 
-func (uc *AuthController) Enable2FA(c echo.Context) error {
+func (uc *AuthController) ResendVerification(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var resendDTO dtos.ResendVerificationDTO
+
+	if err := c.Bind(&resendDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&resendDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.ResendVerification(ctx, resendDTO.Email); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "VERIFICATION_EMAIL_SENT",
+		Message: "if the email is registered and not verified yet, a verification link has been sent to it",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) Setup2FA(c echo.Context) error {
 
 	// extract the context
 	ctx := c.Request().Context()
 
 	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+	var TOTP TOTPInput
 	var secret string
 	var qr string
 	var err error
 
-	logger.Debug("user enable 2FA test", zap.String("email", userData.Email), zap.String("id", userData.UserID.String()))
+	// the code is only needed to replace an active secret
+	if err = c.Bind(&TOTP); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	logger.Debug("user setup 2FA", zap.String("email", userData.Email), zap.String("id", userData.UserID.String()))
 
-	if secret, qr, err = uc.userv.Enable2FA(ctx, userData.Email, userData.UserID, true); err != nil {
+	if secret, qr, err = uc.userv.Setup2FA(ctx, userData.UserID, userData.Email, TOTP.TOTP); err != nil {
 		return response.ErrResp(c, err)
 	}
 
 	return response.ValResp(c, &dtos.ValidResponse{
 		Status:  http.StatusAccepted,
-		Code:    "OTP_ENABLED",
-		Message: "otp enabled successfully",
+		Code:    "OTP_PENDING",
+		Message: "scan the qr code and confirm with a code to enable 2FA",
 		Data: map[string]interface{}{
 			"secret": secret,
 			"qr":     qr,
@@ -183,24 +473,143 @@ func (uc *AuthController) Enable2FA(c echo.Context) error {
 	})
 }
 
-func (uc *AuthController) ValidateTOTP(c echo.Context) error {
+func (uc *AuthController) Confirm2FA(c echo.Context) error {
 
 	// extract the context
 	ctx := c.Request().Context()
 
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
 	var TOTP TOTPInput
 
-	tempToken := c.Request().Header.Get("Autherization")
-	parsedToken, val, err := jwtImpl.ParseExtractClaims(tempToken, "temp", os.Getenv("JWTTOTP"))
-	if err != nil || !val {
+	if err := c.Bind(&TOTP); err != nil || TOTP.TOTP == "" {
 		return response.ErrResp(c, &dtos.ApiErr{
-			Status:  http.StatusUnauthorized,
-			Code:    "INVALID_TOKEN",
-			Err:     "Temp token for the session is expired login again",
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
 			Details: nil,
 		})
 	}
 
+	codes, err := uc.userv.Confirm2FA(ctx, userData.UserID, TOTP.TOTP)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "OTP_ENABLED",
+		Message: "otp enabled successfully, store the recovery codes they are shown only once",
+		Data: map[string]interface{}{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+func (uc *AuthController) Disable2FA(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+	var disableDTO dtos.Disable2FADTO
+
+	if err := c.Bind(&disableDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&disableDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.Disable2FA(ctx, userData.UserID, disableDTO.Password, disableDTO.TOTP, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "OTP_DISABLED",
+		Message: "otp disabled successfully, login again",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) RegenerateRecoveryCodes(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+	var TOTP TOTPInput
+
+	if err := c.Bind(&TOTP); err != nil || TOTP.TOTP == "" {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	codes, err := uc.userv.RegenerateRecoveryCodes(ctx, userData.UserID, TOTP.TOTP, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "RECOVERY_CODES_REGENERATED",
+		Message: "previous recovery codes no longer work, store the new ones",
+		Data: map[string]interface{}{
+			"recoveryCodes": codes,
+			"remaining":     len(codes),
+		},
+	})
+}
+
+func (uc *AuthController) RecoveryCodesStatus(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	remaining, err := uc.userv.RemainingRecoveryCodes(ctx, userData.UserID)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "RECOVERY_CODES_STATUS",
+		Message: "remaining recovery codes",
+		Data: map[string]interface{}{
+			"remaining": remaining,
+		},
+	})
+}
+
+func (uc *AuthController) ValidateTOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var TOTP TOTPInput
+
+	claims, err := tempTokenClaims(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
 	if err := c.Bind(&TOTP); err != nil {
 		return response.ErrResp(c, &dtos.ApiErr{
 			Status:  http.StatusBadRequest,
@@ -210,8 +619,7 @@ func (uc *AuthController) ValidateTOTP(c echo.Context) error {
 		})
 	}
 
-	claims := parsedToken.Claims.(*jwtImpl.TempTOTPTokenClaims)
-	accessTok, refreshTok, err := uc.userv.ValidateTOTP(ctx, claims.UserID, TOTP.TOTP)
+	accessTok, refreshTok, err := uc.userv.ValidateTOTP(ctx, claims, TOTP.TOTP, clientInfo(c))
 	if err != nil {
 		return response.ErrResp(c, err)
 	}
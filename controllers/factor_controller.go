@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/BigBr41n/echoAuth/utils/validator"
+	"github.com/labstack/echo/v4"
+)
+
+// tempTokenClaims reads the temp token returned by the login when a second
+// factor is still needed
+func tempTokenClaims(c echo.Context) (*jwtImpl.TempTOTPTokenClaims, error) {
+	tempToken := c.Request().Header.Get("Autherization")
+	parsedToken, val, err := jwtImpl.ParseExtractClaims(tempToken, "temp", os.Getenv("JWTTOTP"))
+	if err != nil || !val {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "INVALID_TOKEN",
+			Err:     "Temp token for the session is expired login again",
+			Details: nil,
+		}
+	}
+	return parsedToken.Claims.(*jwtImpl.TempTOTPTokenClaims), nil
+}
+
+func (uc *AuthController) ListFactors(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	factors, err := uc.userv.ListFactors(ctx, userData.UserID)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "FACTORS",
+		Message: "second factors retrieved successfully",
+		Data:    map[string]interface{}{"factors": factors.Factors, "preferred": factors.Preferred, "phone": factors.Phone},
+	})
+}
+
+func (uc *AuthController) SetPreferredFactor(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var preferredDTO dtos.PreferredFactorDTO
+
+	if err := c.Bind(&preferredDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&preferredDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.SetPreferredFactor(ctx, userData, preferredDTO.Factor); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "PREFERRED_FACTOR_SET",
+		Message: "preferred factor changed successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) EnableEmailOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.EnableEmailOTP(ctx, userData, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "EMAIL_OTP_ENABLED",
+		Message: "email codes enabled successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) DisableEmailOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.DisableEmailOTP(ctx, userData, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "EMAIL_OTP_DISABLED",
+		Message: "email codes disabled successfully",
+		Data:    nil,
+	})
+}
+
+// LoginFactors lists the factors the user of a temp token can finish the
+// login with
+func (uc *AuthController) LoginFactors(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	claims, err := tempTokenClaims(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	factors, err := uc.userv.ListFactors(ctx, claims.UserID)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "FACTORS",
+		Message: "second factors retrieved successfully",
+		Data:    map[string]interface{}{"factors": factors.Factors, "preferred": factors.Preferred, "phone": factors.Phone},
+	})
+}
+
+func (uc *AuthController) SendEmailOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	claims, err := tempTokenClaims(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	if err := uc.userv.SendEmailOTP(ctx, claims.UserID); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "EMAIL_OTP_SENT",
+		Message: "a login code was sent to your email",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) ValidateEmailOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	claims, err := tempTokenClaims(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	var codeDTO dtos.OTPCodeDTO
+
+	if err := c.Bind(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	accessTok, refreshTok, err := uc.userv.ValidateEmailOTP(ctx, claims, codeDTO.Code, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "VERIFIED",
+		Message: "email code verified and logged in successfully",
+		Data: map[string]interface{}{
+			"accessToken":  accessTok,
+			"refreshToken": refreshTok,
+		},
+	})
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/BigBr41n/echoAuth/utils/validator"
+	"github.com/labstack/echo/v4"
+)
+
+// the nonce binding a magic link to the browser that asked for it, only sent
+// back to the callback
+const (
+	magicLinkCookie     = "magic_link_nonce"
+	magicLinkCookiePath = "/api/v1/auth/magic-link"
+)
+
+// magicLinkNonceCookie is the cookie of the nonce, Lax so it comes along when
+// the link is opened from a webmail, an empty value with a negative maxAge
+// removes it
+func magicLinkNonceCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    value,
+		Path:     magicLinkCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (uc *AuthController) RequestMagicLink(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var magicLinkDTO dtos.MagicLinkDTO
+
+	if err := c.Bind(&magicLinkDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&magicLinkDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	nonce, err := uc.userv.RequestMagicLink(ctx, magicLinkDTO.Email)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+	c.SetCookie(magicLinkNonceCookie(nonce, int(services.MagicLinkTTL.Seconds())))
+
+	// same answer whether the email is registered or not
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "MAGIC_LINK_SENT",
+		Message: "if the email is registered, a login link has been sent to it",
+		Data:    nil,
+	})
+}
+
+// MagicLinkCallback is opened from the email, a top level navigation: the
+// browser is sent to the front with a one time code (or the error) and the
+// front exchanges the code for the tokens
+func (uc *AuthController) MagicLinkCallback(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	token := c.QueryParam("token")
+	if token == "" {
+		return redirectToMagicLinkPage(c, url.Values{"error": {"INVALID_OR_MISSED_DATA"}})
+	}
+
+	cookie, err := c.Cookie(magicLinkCookie)
+	if err != nil || cookie.Value == "" {
+		return redirectToMagicLinkPage(c, url.Values{"error": {"MAGIC_LINK_BROWSER_MISMATCH"}})
+	}
+
+	code, err := uc.userv.ConsumeMagicLink(ctx, token, cookie.Value)
+	if err != nil {
+		var apiErr *dtos.ApiErr
+		if errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError {
+			return redirectToMagicLinkPage(c, url.Values{"error": {apiErr.Code}})
+		}
+		return redirectToMagicLinkPage(c, url.Values{"error": {"INTERNAL_ERROR"}})
+	}
+
+	return redirectToMagicLinkPage(c, url.Values{"code": {code}})
+}
+
+// redirectToMagicLinkPage sends the browser to the page of the front, the
+// response must not be stored nor leak the url to another site
+func redirectToMagicLinkPage(c echo.Context, query url.Values) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Referrer-Policy", "no-referrer")
+	return c.Redirect(http.StatusFound, config.AppConfig.MagicLinkURL+"?"+query.Encode())
+}
+
+// ExchangeMagicLinkCode is called by the front with the code of the callback,
+// from the browser holding the nonce cookie
+func (uc *AuthController) ExchangeMagicLinkCode(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var codeDTO dtos.MagicLinkCodeDTO
+
+	if err := c.Bind(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	cookie, err := c.Cookie(magicLinkCookie)
+	if err != nil || cookie.Value == "" {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "MAGIC_LINK_BROWSER_MISMATCH",
+			Err:     "Open the login link in the browser where you asked for it",
+			Details: nil,
+		})
+	}
+
+	accessTok, refreshTok, err := uc.userv.ExchangeMagicLinkCode(ctx, codeDTO.Code, cookie.Value, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+	c.SetCookie(magicLinkNonceCookie("", -1))
+
+	// like the login: the temp token and the factor when a second factor is needed
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "LOGGED_IN",
+		Message: "user logged in successfully",
+		Data: map[string]interface{}{
+			"accessToken":  accessTok,
+			"refreshToken": refreshTok,
+		},
+	})
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	ctm "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/labstack/echo/v4"
+)
+
+// magicLinkService accepts the link "good" opened with the nonce "nonce"
+type magicLinkService struct {
+	services.AuthServiceI
+}
+
+func (ms *magicLinkService) ConsumeMagicLink(ctx context.Context, token string, nonce string) (string, error) {
+	if token != "good" || nonce != "nonce" {
+		return "", &dtos.ApiErr{Status: http.StatusBadRequest, Code: "INVALID_MAGIC_LINK"}
+	}
+	return "one-time-code", nil
+}
+
+func (ms *magicLinkService) RequestMagicLink(ctx context.Context, email string) (string, error) {
+	return "nonce", nil
+}
+
+func (ms *magicLinkService) ExchangeMagicLinkCode(ctx context.Context, code string, nonce string, client *services.ClientInfo) (string, string, error) {
+	if code != "one-time-code" || nonce != "nonce" {
+		return "", "", &dtos.ApiErr{Status: http.StatusBadRequest, Code: "INVALID_MAGIC_LINK"}
+	}
+	return "access-token", "refresh-token", nil
+}
+
+// TestMagicLinkThroughCORS runs the calls of the front, another origin than
+// the api, through the middlewares of the server: the browser keeps and sends
+// back the nonce cookie only when the origin is allowed with credentials
+func TestMagicLinkThroughCORS(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	const front = "https://app.example.com"
+	config.AppConfig.CORSOrigins = []string{front}
+
+	uc := &AuthController{userv: &magicLinkService{}}
+	e := echo.New()
+	e.Use(ctm.CORSMiddleware())
+	e.Use(ctm.ResponseHeadersMiddleware)
+	e.POST("/api/v1/auth/magic-link", uc.RequestMagicLink)
+	e.POST("/api/v1/auth/magic-link/exchange", uc.ExchangeMagicLinkCode)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	allowed := func(t *testing.T, rec *httptest.ResponseRecorder, origin string) {
+		t.Helper()
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("Access-Control-Allow-Origin %q, want %q", got, origin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Access-Control-Allow-Credentials %q, want true", got)
+		}
+	}
+
+	// preflight of the json post
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/auth/magic-link", nil)
+	req.Header.Set("Origin", front)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	rec := serve(req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight status %d, want 204", rec.Code)
+	}
+	allowed(t, rec, front)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/magic-link", strings.NewReader(`{"email":"alice@example.com"}`))
+	req.Header.Set("Origin", front)
+	req.Header.Set("Content-Type", "application/json")
+	rec = serve(req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("request status %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+	allowed(t, rec, front)
+	var nonce *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == magicLinkCookie {
+			nonce = cookie
+		}
+	}
+	if nonce == nil {
+		t.Fatal("no nonce cookie")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/magic-link/exchange", strings.NewReader(`{"code":"one-time-code"}`))
+	req.Header.Set("Origin", front)
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(nonce)
+	rec = serve(req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("exchange status %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+	allowed(t, rec, front)
+
+	// another site gets no cors headers, its script can't read the answer
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/auth/magic-link/exchange", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec = serve(req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin %q for another site", got)
+	}
+}
+
+func TestMagicLinkCallbackRedirects(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.MagicLinkURL = "https://app.example.com/magic-link"
+
+	uc := &AuthController{userv: &magicLinkService{}}
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  url.Values
+	}{
+		{"valid link", "good", "nonce", url.Values{"code": {"one-time-code"}}},
+		{"no cookie", "good", "", url.Values{"error": {"MAGIC_LINK_BROWSER_MISMATCH"}}},
+		{"other browser", "good", "other", url.Values{"error": {"INVALID_MAGIC_LINK"}}},
+		{"no token", "", "nonce", url.Values{"error": {"INVALID_OR_MISSED_DATA"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/magic-link/callback?token="+tt.token, nil)
+			if tt.nonce != "" {
+				req.AddCookie(&http.Cookie{Name: magicLinkCookie, Value: tt.nonce})
+			}
+			rec := httptest.NewRecorder()
+			if err := uc.MagicLinkCallback(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != http.StatusFound {
+				t.Fatalf("status %d, want 302", rec.Code)
+			}
+			if strings.Contains(rec.Body.String(), "Token") {
+				t.Errorf("tokens in the body %q", rec.Body.String())
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control %q, want no-store", got)
+			}
+
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base := location.Scheme + "://" + location.Host + location.Path; base != config.AppConfig.MagicLinkURL {
+				t.Errorf("redirected to %s, want %s", base, config.AppConfig.MagicLinkURL)
+			}
+			if got := location.Query(); got.Encode() != tt.want.Encode() {
+				t.Errorf("query %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/BigBr41n/echoAuth/utils/validator"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// OAuthController serves the oauth endpoints, they take form parameters and
+// answer in the RFC formats instead of the api envelope
+type OAuthController struct {
+	oauthv services.OAuthServiceI
+}
+
+type OAuthControllerI interface {
+	Introspect(c echo.Context) error
+	Authorize(c echo.Context) error
+	Token(c echo.Context) error
+	GetAuthorization(c echo.Context) error
+	DecideAuthorization(c echo.Context) error
+	UserInfo(c echo.Context) error
+	DeviceAuthorization(c echo.Context) error
+	GetDeviceRequest(c echo.Context) error
+	DecideDeviceRequest(c echo.Context) error
+}
+
+func NewOAuthController(oauthSrv services.OAuthServiceI) OAuthControllerI {
+	return &OAuthController{
+		oauthv: oauthSrv,
+	}
+}
+
+// clientCredentials reads the client id and secret from the Basic header
+// (client_secret_basic) or from the form (client_secret_post)
+func clientCredentials(c echo.Context) (string, string) {
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		// both parts are form encoded before the base64 (RFC 6749 2.3.1)
+		if unescaped, err := url.QueryUnescape(id); err == nil {
+			id = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(secret); err == nil {
+			secret = unescaped
+		}
+		return id, secret
+	}
+	return c.FormValue("client_id"), c.FormValue("client_secret")
+}
+
+func (oc *OAuthController) Introspect(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	clientID, secret := clientCredentials(c)
+	client, err := oc.oauthv.AuthenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	resp, err := oc.oauthv.Introspect(ctx, client, c.FormValue("token"), c.FormValue("token_type_hint"))
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (oc *OAuthController) Authorize(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	redirectTo, err := oc.oauthv.StartAuthorization(ctx, &dtos.AuthorizeRequest{
+		ResponseType:        c.QueryParam("response_type"),
+		ClientID:            c.QueryParam("client_id"),
+		RedirectURI:         c.QueryParam("redirect_uri"),
+		Scope:               c.QueryParam("scope"),
+		State:               c.QueryParam("state"),
+		CodeChallenge:       c.QueryParam("code_challenge"),
+		CodeChallengeMethod: c.QueryParam("code_challenge_method"),
+		Nonce:               c.QueryParam("nonce"),
+	})
+	// no trusted redirect uri, the error is shown to the user agent
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	return c.Redirect(http.StatusFound, redirectTo)
+}
+
+func (oc *OAuthController) Token(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	clientID, secret := clientCredentials(c)
+	client, err := oc.oauthv.AuthenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	var resp *dtos.TokenResponse
+	switch c.FormValue("grant_type") {
+	case "authorization_code":
+		resp, err = oc.oauthv.ExchangeCode(ctx, client,
+			c.FormValue("code"), c.FormValue("redirect_uri"), c.FormValue("code_verifier"), clientInfo(c),
+		)
+	case "refresh_token":
+		resp, err = oc.oauthv.RefreshClientToken(ctx, client, c.FormValue("refresh_token"))
+	case "client_credentials":
+		resp, err = oc.oauthv.ClientCredentials(ctx, client, c.FormValue("scope"))
+	case services.DeviceCodeGrantType:
+		resp, err = oc.oauthv.PollDeviceToken(ctx, client, c.FormValue("device_code"), clientInfo(c))
+	default:
+		err = &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "unsupported_grant_type",
+			Err:     "Only authorization_code, refresh_token, client_credentials and device_code are supported",
+			Details: nil,
+		}
+	}
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, resp)
+}
+
+// authorizationID reads the id of the pending request from the path
+func authorizationID(c echo.Context) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	if err := id.Scan(c.Param("id")); err != nil {
+		return id, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_REQUEST_ID",
+			Err:     "Invalid authorization request id",
+			Details: nil,
+		}
+	}
+	return id, nil
+}
+
+func (oc *OAuthController) GetAuthorization(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	id, err := authorizationID(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	authz, err := oc.oauthv.GetAuthorization(ctx, userData.UserID, id)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "AUTHORIZATION_REQUEST",
+		Message: "authorization request retrieved successfully",
+		Data:    map[string]interface{}{"authorization": authz},
+	})
+}
+
+func (oc *OAuthController) DecideAuthorization(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	id, err := authorizationID(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	var decisionDTO dtos.AuthorizationDecisionDTO
+
+	if err := c.Bind(&decisionDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&decisionDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	redirectTo, err := oc.oauthv.DecideAuthorization(ctx, userData, id, *decisionDTO.Approve)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	// the front sends the browser back to the client
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "AUTHORIZATION_DECIDED",
+		Message: "authorization request answered",
+		Data:    map[string]interface{}{"redirectTo": redirectTo},
+	})
+}
+
+func (oc *OAuthController) UserInfo(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	info, err := oc.oauthv.UserInfo(ctx, userData)
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, info)
+}
+
+func (oc *OAuthController) DeviceAuthorization(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	// a CLI is usually a public client, it only sends its id
+	clientID, secret := clientCredentials(c)
+	client, err := oc.oauthv.AuthenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	resp, err := oc.oauthv.StartDeviceAuthorization(ctx, client, c.FormValue("scope"))
+	if err != nil {
+		return response.OAuthErrResp(c, err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (oc *OAuthController) GetDeviceRequest(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	device, err := oc.oauthv.GetDeviceRequest(ctx, userData, c.QueryParam("user_code"))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "DEVICE_REQUEST",
+		Message: "device request retrieved successfully",
+		Data:    map[string]interface{}{"device": device},
+	})
+}
+
+func (oc *OAuthController) DecideDeviceRequest(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var decisionDTO dtos.DeviceDecisionDTO
+
+	if err := c.Bind(&decisionDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&decisionDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := oc.oauthv.DecideDeviceRequest(ctx, userData, decisionDTO.UserCode, *decisionDTO.Approve); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "DEVICE_REQUEST_DECIDED",
+		Message: "device request answered, go back to your device",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/BigBr41n/echoAuth/utils/validator"
+	"github.com/labstack/echo/v4"
+)
+
+// ServiceAccountController manages the service accounts, the clients calling
+// the apis for themselves with the client credentials grant
+type ServiceAccountController struct {
+	oauthv services.OAuthServiceI
+}
+
+type ServiceAccountControllerI interface {
+	ListServiceAccounts(c echo.Context) error
+	CreateServiceAccount(c echo.Context) error
+	RotateSecret(c echo.Context) error
+	RevokeServiceAccount(c echo.Context) error
+}
+
+func NewServiceAccountController(oauthSrv services.OAuthServiceI) ServiceAccountControllerI {
+	return &ServiceAccountController{
+		oauthv: oauthSrv,
+	}
+}
+
+func (sac *ServiceAccountController) ListServiceAccounts(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	accounts, err := sac.oauthv.ListServiceAccounts(ctx)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SERVICE_ACCOUNTS_LISTED",
+		Message: "service accounts retrieved successfully",
+		Data:    map[string]interface{}{"serviceAccounts": accounts},
+	})
+}
+
+func (sac *ServiceAccountController) CreateServiceAccount(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	by, _ := principal.FromContext(c)
+
+	var createDTO dtos.CreateServiceAccountDTO
+
+	if err := c.Bind(&createDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&createDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	account, err := sac.oauthv.CreateServiceAccount(ctx, by, createDTO.Name, createDTO.Scopes)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	// the secret is stored hashed, it can't be shown again
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusCreated,
+		Code:    "SERVICE_ACCOUNT_CREATED",
+		Message: "service account created, store its secret now",
+		Data:    map[string]interface{}{"serviceAccount": account},
+	})
+}
+
+func (sac *ServiceAccountController) RotateSecret(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	by, _ := principal.FromContext(c)
+
+	account, err := sac.oauthv.RotateServiceAccountSecret(ctx, by, c.Param("clientId"))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SERVICE_ACCOUNT_SECRET_ROTATED",
+		Message: "secret rotated, the previous one doesn't work anymore",
+		Data:    map[string]interface{}{"serviceAccount": account},
+	})
+}
+
+func (sac *ServiceAccountController) RevokeServiceAccount(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	by, _ := principal.FromContext(c)
+
+	if err := sac.oauthv.RevokeServiceAccount(ctx, by, c.Param("clientId")); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SERVICE_ACCOUNT_REVOKED",
+		Message: "service account revoked successfully",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+type SessionController struct {
+	sessv services.SessionServiceI
+}
+
+type SessionControllerI interface {
+	ListSessions(c echo.Context) error
+	RevokeSession(c echo.Context) error
+}
+
+func NewSessionController(sessSrv services.SessionServiceI) SessionControllerI {
+	return &SessionController{
+		sessv: sessSrv,
+	}
+}
+
+func (sc *SessionController) ListSessions(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	sessions, err := sc.sessv.ListSessions(ctx, userData)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SESSIONS_LISTED",
+		Message: "active sessions of the user",
+		Data:    map[string]interface{}{"sessions": sessions},
+	})
+}
+
+func (sc *SessionController) RevokeSession(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var sessionID pgtype.UUID
+	if err := sessionID.Scan(c.Param("id")); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_SESSION_ID",
+			Err:     "Invalid session id",
+			Details: nil,
+		})
+	}
+
+	if err := sc.sessv.RevokeSession(ctx, userData.UserID, sessionID); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SESSION_REVOKED",
+		Message: "session revoked successfully",
+		Data:    nil,
+	})
+}
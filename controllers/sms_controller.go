@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/BigBr41n/echoAuth/utils/validator"
+	"github.com/labstack/echo/v4"
+)
+
+func (uc *AuthController) EnrollSMS(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var enrollDTO dtos.SMSEnrollDTO
+
+	if err := c.Bind(&enrollDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&enrollDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	phone, err := uc.userv.EnrollSMS(ctx, userData, enrollDTO.PhoneNumber)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SMS_OTP_SENT",
+		Message: "confirm the number with the code sent by sms",
+		Data:    map[string]interface{}{"phone": phone},
+	})
+}
+
+func (uc *AuthController) ConfirmSMS(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var codeDTO dtos.OTPCodeDTO
+
+	if err := c.Bind(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.ConfirmSMS(ctx, userData, codeDTO.Code, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SMS_OTP_ENABLED",
+		Message: "sms codes enabled successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) DisableSMS(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.DisableSMS(ctx, userData, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SMS_OTP_DISABLED",
+		Message: "sms codes disabled successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) SendSMSOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	claims, err := tempTokenClaims(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	phone, err := uc.userv.SendSMSOTP(ctx, claims.UserID)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "SMS_OTP_SENT",
+		Message: "a login code was sent by sms",
+		Data:    map[string]interface{}{"phone": phone},
+	})
+}
+
+func (uc *AuthController) ValidateSMSOTP(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	claims, err := tempTokenClaims(c)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	var codeDTO dtos.OTPCodeDTO
+
+	if err := c.Bind(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&codeDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	accessTok, refreshTok, err := uc.userv.ValidateSMSOTP(ctx, claims, codeDTO.Code, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "VERIFIED",
+		Message: "sms code verified and logged in successfully",
+		Data: map[string]interface{}{
+			"accessToken":  accessTok,
+			"refreshToken": refreshTok,
+		},
+	})
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/labstack/echo/v4"
+)
+
+// StepUp answers a STEP_UP_REQUIRED with a fresh totp, the elevated token is
+// sent instead of the access token to the sensitive routes until it expires
+func (uc *AuthController) StepUp(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+	var TOTP TOTPInput
+
+	if err := c.Bind(&TOTP); err != nil || TOTP.TOTP == "" {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	accessToken, expiresAt, err := uc.userv.StepUp(ctx, userData, TOTP.TOTP, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "STEPPED_UP",
+		Message: "use the elevated token for the sensitive actions",
+		Data: map[string]interface{}{
+			"accessToken": accessToken,
+			"expiresIn":   int(time.Until(expiresAt).Seconds()),
+		},
+	})
+}
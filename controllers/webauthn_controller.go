@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/BigBr41n/echoAuth/utils/validator"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+func (uc *AuthController) BeginWebAuthnRegistration(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	options, err := uc.userv.BeginWebAuthnRegistration(ctx, userData)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "WEBAUTHN_REGISTRATION_STARTED",
+		Message: "pass the options to navigator.credentials.create",
+		Data:    map[string]interface{}{"challengeId": options.ChallengeID, "options": options.Options},
+	})
+}
+
+func (uc *AuthController) FinishWebAuthnRegistration(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var registerDTO dtos.WebAuthnRegisterDTO
+
+	if err := c.Bind(&registerDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&registerDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	credential, err := uc.userv.FinishWebAuthnRegistration(ctx, userData, &registerDTO, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusCreated,
+		Code:    "WEBAUTHN_REGISTERED",
+		Message: "passkey registered successfully",
+		Data:    map[string]interface{}{"credential": credential},
+	})
+}
+
+func (uc *AuthController) ListWebAuthnCredentials(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	credentials, err := uc.userv.ListWebAuthnCredentials(ctx, userData.UserID)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "WEBAUTHN_CREDENTIALS",
+		Message: "passkeys retrieved successfully",
+		Data:    map[string]interface{}{"credentials": credentials},
+	})
+}
+
+func (uc *AuthController) DeleteWebAuthnCredential(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	var credentialID pgtype.UUID
+	if err := credentialID.Scan(c.Param("id")); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_CREDENTIAL_ID",
+			Err:     "Invalid credential id",
+			Details: nil,
+		})
+	}
+
+	if err := uc.userv.DeleteWebAuthnCredential(ctx, userData, credentialID, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "WEBAUTHN_REMOVED",
+		Message: "passkey removed successfully",
+		Data:    nil,
+	})
+}
+
+// EnableWebAuthnSecondFactor asks for a passkey after the password
+func (uc *AuthController) EnableWebAuthnSecondFactor(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.EnableWebAuthnSecondFactor(ctx, userData, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "WEBAUTHN_2FA_ENABLED",
+		Message: "passkeys enabled as a second factor successfully",
+		Data:    nil,
+	})
+}
+
+func (uc *AuthController) DisableWebAuthnSecondFactor(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	userData := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+
+	if err := uc.userv.DisableWebAuthnSecondFactor(ctx, userData, clientInfo(c)); err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "WEBAUTHN_2FA_DISABLED",
+		Message: "passkeys disabled as a second factor successfully",
+		Data:    nil,
+	})
+}
+
+// BeginWebAuthnLogin starts a passwordless login, or the second factor step
+// when the temp token of the login is sent
+func (uc *AuthController) BeginWebAuthnLogin(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var temp *jwtImpl.TempTOTPTokenClaims
+
+	if c.Request().Header.Get("Autherization") != "" {
+		claims, err := tempTokenClaims(c)
+		if err != nil {
+			return response.ErrResp(c, err)
+		}
+		temp = claims
+	}
+
+	options, err := uc.userv.BeginWebAuthnLogin(ctx, temp)
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusOK,
+		Code:    "WEBAUTHN_LOGIN_STARTED",
+		Message: "pass the options to navigator.credentials.get",
+		Data:    map[string]interface{}{"challengeId": options.ChallengeID, "options": options.Options},
+	})
+}
+
+func (uc *AuthController) FinishWebAuthnLogin(c echo.Context) error {
+
+	// extract the context
+	ctx := c.Request().Context()
+
+	var loginDTO dtos.WebAuthnLoginDTO
+
+	if err := c.Bind(&loginDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_OR_MISSED_DATA",
+			Err:     "Invalid input data",
+			Details: nil,
+		})
+	}
+
+	if err := validator.Validate(&loginDTO); err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_INPUT_FORMAT",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	accessTok, refreshTok, err := uc.userv.FinishWebAuthnLogin(ctx, &loginDTO, clientInfo(c))
+	if err != nil {
+		return response.ErrResp(c, err)
+	}
+
+	return response.ValResp(c, &dtos.ValidResponse{
+		Status:  http.StatusAccepted,
+		Code:    "LOGGED_IN",
+		Message: "user logged in successfully",
+		Data: map[string]interface{}{
+			"accessToken":  accessTok,
+			"refreshToken": refreshTok,
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/services"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/labstack/echo/v4"
+)
+
+// WellKnownController serves the public metadata other services read, the
+// documents follow their RFC format instead of the api envelope
+type WellKnownController struct{}
+
+type WellKnownControllerI interface {
+	JWKS(c echo.Context) error
+	OpenIDConfiguration(c echo.Context) error
+}
+
+func NewWellKnownController() WellKnownControllerI {
+	return &WellKnownController{}
+}
+
+func (wc *WellKnownController) JWKS(c echo.Context) error {
+
+	set, err := jwtImpl.JWKS()
+	if err != nil {
+		return response.ErrResp(c, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		})
+	}
+
+	// verifiers may cache the keys for a while
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, set)
+}
+
+func (wc *WellKnownController) OpenIDConfiguration(c echo.Context) error {
+
+	// relying parties fetch it at startup and may keep it for a while
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, services.OpenIDConfiguration())
+}
@@ -8,14 +8,204 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditEvent struct {
+	ID        pgtype.UUID        `json:"id"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	Event     string             `json:"event"`
+	Ip        string             `json:"ip"`
+	UserAgent string             `json:"user_agent"`
+	Details   []byte             `json:"details"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type EmailOtpCode struct {
+	ID         pgtype.UUID        `json:"id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	CodeHash   string             `json:"code_hash"`
+	Attempts   int32              `json:"attempts"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	ConsumedAt pgtype.Timestamptz `json:"consumed_at"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Key           string             `json:"key"`
+	Failures      int32              `json:"failures"`
+	LastFailureAt pgtype.Timestamptz `json:"last_failure_at"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+}
+
+type OauthAuthorization struct {
+	ID            pgtype.UUID        `json:"id"`
+	ClientID      string             `json:"client_id"`
+	RedirectUri   string             `json:"redirect_uri"`
+	Scope         string             `json:"scope"`
+	State         string             `json:"state"`
+	CodeChallenge string             `json:"code_challenge"`
+	UserID        pgtype.UUID        `json:"user_id"`
+	CodeHash      pgtype.Text        `json:"code_hash"`
+	SessionID     pgtype.UUID        `json:"session_id"`
+	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
+	ApprovedAt    pgtype.Timestamptz `json:"approved_at"`
+	UsedAt        pgtype.Timestamptz `json:"used_at"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	Nonce         string             `json:"nonce"`
+	Amr           []string           `json:"amr"`
+	AuthTime      pgtype.Timestamptz `json:"auth_time"`
+}
+
+type OauthClient struct {
+	ID             pgtype.UUID        `json:"id"`
+	ClientID       string             `json:"client_id"`
+	Name           string             `json:"name"`
+	SecretHash     string             `json:"secret_hash"`
+	Scopes         []string           `json:"scopes"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	RevokedAt      pgtype.Timestamptz `json:"revoked_at"`
+	RedirectUris   []string           `json:"redirect_uris"`
+	Public         bool               `json:"public"`
+	ServiceAccount bool               `json:"service_account"`
+	CreatedBy      pgtype.UUID        `json:"created_by"`
+	DeviceGrant    bool               `json:"device_grant"`
+}
+
+type OauthConsent struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	ClientID  string             `json:"client_id"`
+	Scopes    []string           `json:"scopes"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+type OauthDeviceCode struct {
+	ID             pgtype.UUID        `json:"id"`
+	ClientID       string             `json:"client_id"`
+	DeviceCodeHash string             `json:"device_code_hash"`
+	UserCode       string             `json:"user_code"`
+	Scope          string             `json:"scope"`
+	Status         string             `json:"status"`
+	UserID         pgtype.UUID        `json:"user_id"`
+	Amr            []string           `json:"amr"`
+	AuthTime       pgtype.Timestamptz `json:"auth_time"`
+	PollInterval   int32              `json:"poll_interval"`
+	LastPolledAt   pgtype.Timestamptz `json:"last_polled_at"`
+	ExpiresAt      pgtype.Timestamptz `json:"expires_at"`
+	DecidedAt      pgtype.Timestamptz `json:"decided_at"`
+	ConsumedAt     pgtype.Timestamptz `json:"consumed_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+type RecoveryCode struct {
+	ID        pgtype.UUID        `json:"id"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	CodeHash  string             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type RefreshToken struct {
+	ID        pgtype.UUID        `json:"id"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	FamilyID  pgtype.UUID        `json:"family_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	RevokedAt pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type RevokedToken struct {
+	Jti       string             `json:"jti"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type Session struct {
+	ID         pgtype.UUID        `json:"id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	UserAgent  string             `json:"user_agent"`
+	Ip         string             `json:"ip"`
+	Protocol   string             `json:"protocol"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastSeenAt pgtype.Timestamptz `json:"last_seen_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	ClientID   pgtype.Text        `json:"client_id"`
+	Scope      string             `json:"scope"`
+	Amr        []string           `json:"amr"`
+	AuthTime   pgtype.Timestamptz `json:"auth_time"`
+}
+
+type SmsOtpCode struct {
+	ID          pgtype.UUID        `json:"id"`
+	UserID      pgtype.UUID        `json:"user_id"`
+	PhoneNumber string             `json:"phone_number"`
+	Purpose     string             `json:"purpose"`
+	CodeHash    string             `json:"code_hash"`
+	Attempts    int32              `json:"attempts"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	ConsumedAt  pgtype.Timestamptz `json:"consumed_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
 type User struct {
-	ID           pgtype.UUID        `json:"id"`
-	Username     string             `json:"username"`
-	Email        string             `json:"email"`
-	Password     string             `json:"password"`
-	Role         string             `json:"role"`
-	TwoFaEnabled pgtype.Bool        `json:"two_fa_enabled"`
-	TotpSecret   pgtype.Text        `json:"totp_secret"`
-	CreatedAt    pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
+	ID                   pgtype.UUID        `json:"id"`
+	Username             string             `json:"username"`
+	Email                string             `json:"email"`
+	Password             string             `json:"password"`
+	Role                 string             `json:"role"`
+	TwoFaEnabled         pgtype.Bool        `json:"two_fa_enabled"`
+	TotpSecret           pgtype.Text        `json:"totp_secret"`
+	TotpPendingSecret    pgtype.Text        `json:"totp_pending_secret"`
+	TotpLastStep         pgtype.Int8        `json:"totp_last_step"`
+	EmailVerifiedAt      pgtype.Timestamptz `json:"email_verified_at"`
+	TokenVersion         int32              `json:"token_version"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+	EmailOtpEnabled      bool               `json:"email_otp_enabled"`
+	PreferredFactor      pgtype.Text        `json:"preferred_factor"`
+	PhoneNumber          pgtype.Text        `json:"phone_number"`
+	SmsOtpEnabled        bool               `json:"sms_otp_enabled"`
+	WebauthnSecondFactor bool               `json:"webauthn_second_factor"`
+}
+
+type UserToken struct {
+	ID         pgtype.UUID        `json:"id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	Purpose    string             `json:"purpose"`
+	TokenHash  string             `json:"token_hash"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	ConsumedAt pgtype.Timestamptz `json:"consumed_at"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserTokenRevocation struct {
+	UserID        pgtype.UUID        `json:"user_id"`
+	RevokedBefore pgtype.Timestamptz `json:"revoked_before"`
+}
+
+type WebauthnChallenge struct {
+	ID          pgtype.UUID        `json:"id"`
+	UserID      pgtype.UUID        `json:"user_id"`
+	Ceremony    string             `json:"ceremony"`
+	SessionData []byte             `json:"session_data"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	Amr         []string           `json:"amr"`
+}
+
+type WebauthnCredential struct {
+	ID              pgtype.UUID        `json:"id"`
+	UserID          pgtype.UUID        `json:"user_id"`
+	CredentialID    []byte             `json:"credential_id"`
+	PublicKey       []byte             `json:"public_key"`
+	AttestationType string             `json:"attestation_type"`
+	Aaguid          []byte             `json:"aaguid"`
+	SignCount       int64              `json:"sign_count"`
+	Transports      []string           `json:"transports"`
+	BackupEligible  bool               `json:"backup_eligible"`
+	BackupState     bool               `json:"backup_state"`
+	Name            string             `json:"name"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt      pgtype.Timestamptz `json:"last_used_at"`
 }
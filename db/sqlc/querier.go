@@ -11,11 +11,98 @@ import (
 )
 
 type Querier interface {
+	AcceptTOTPStep(ctx context.Context, arg AcceptTOTPStepParams) (int64, error)
+	ActivatePendingSecret2FA(ctx context.Context, arg ActivatePendingSecret2FAParams) (int64, error)
+	ApproveAuthorization(ctx context.Context, arg ApproveAuthorizationParams) (int64, error)
+	BumpTokenVersion(ctx context.Context, id pgtype.UUID) (int32, error)
+	ConsumeAuthorizationCode(ctx context.Context, codeHash pgtype.Text) (OauthAuthorization, error)
+	ConsumeDeviceCode(ctx context.Context, id pgtype.UUID) (int64, error)
+	ConsumeEmailOTP(ctx context.Context, id pgtype.UUID) (int64, error)
+	ConsumeSMSOTP(ctx context.Context, id pgtype.UUID) (int64, error)
+	ConsumeUserToken(ctx context.Context, arg ConsumeUserTokenParams) (UserToken, error)
+	ConsumeWebAuthnChallenge(ctx context.Context, arg ConsumeWebAuthnChallengeParams) (WebauthnChallenge, error)
+	CountEmailOTPAttempt(ctx context.Context, id pgtype.UUID) (int32, error)
+	CountRemainingRecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error)
+	CountSMSOTPAttempt(ctx context.Context, id pgtype.UUID) (int32, error)
+	CountWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) (int64, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error
+	CreateAuthorization(ctx context.Context, arg CreateAuthorizationParams) (OauthAuthorization, error)
+	CreateDeviceCode(ctx context.Context, arg CreateDeviceCodeParams) (OauthDeviceCode, error)
+	CreateEmailOTP(ctx context.Context, arg CreateEmailOTPParams) (EmailOtpCode, error)
+	CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error)
+	CreateSMSOTP(ctx context.Context, arg CreateSMSOTPParams) (SmsOtpCode, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error)
+	CreateUserToken(ctx context.Context, arg CreateUserTokenParams) (UserToken, error)
+	CreateWebAuthnChallenge(ctx context.Context, arg CreateWebAuthnChallengeParams) (WebauthnChallenge, error)
+	CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error)
+	DecideDeviceCode(ctx context.Context, arg DecideDeviceCodeParams) (int64, error)
+	DeleteAuthorization(ctx context.Context, id pgtype.UUID) error
+	DeleteEmailOTPs(ctx context.Context, userID pgtype.UUID) error
+	DeleteExpiredAuthorizations(ctx context.Context, expiredBefore pgtype.Timestamptz) error
+	DeleteExpiredDeviceCodes(ctx context.Context, expiredBefore pgtype.Timestamptz) error
+	DeleteExpiredEmailOTPs(ctx context.Context, expiredBefore pgtype.Timestamptz) error
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	DeleteExpiredSMSOTPs(ctx context.Context, expiredBefore pgtype.Timestamptz) error
+	DeleteExpiredWebAuthnChallenges(ctx context.Context, expiredBefore pgtype.Timestamptz) error
+	DeleteRecoveryCodes(ctx context.Context, userID pgtype.UUID) error
+	DeleteSMSOTPs(ctx context.Context, arg DeleteSMSOTPsParams) error
+	DeleteStaleLoginAttempts(ctx context.Context, lastFailureAt pgtype.Timestamptz) error
+	DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error)
+	Disable2FA(ctx context.Context, id pgtype.UUID) error
+	GetActiveEmailOTP(ctx context.Context, userID pgtype.UUID) (EmailOtpCode, error)
+	GetActiveSMSOTP(ctx context.Context, arg GetActiveSMSOTPParams) (SmsOtpCode, error)
+	GetAuthorizationByCodeHash(ctx context.Context, codeHash pgtype.Text) (OauthAuthorization, error)
+	GetConsent(ctx context.Context, arg GetConsentParams) (OauthConsent, error)
+	GetDeviceCodeByHash(ctx context.Context, deviceCodeHash string) (OauthDeviceCode, error)
+	GetLoginLock(ctx context.Context, keys []string) (pgtype.Timestamptz, error)
+	GetOAuthClient(ctx context.Context, clientID string) (OauthClient, error)
+	GetPendingAuthorization(ctx context.Context, id pgtype.UUID) (OauthAuthorization, error)
+	GetPendingDeviceCode(ctx context.Context, userCode string) (OauthDeviceCode, error)
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error)
+	GetSession(ctx context.Context, id pgtype.UUID) (Session, error)
 	GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error)
 	GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
+	InvalidateUserTokens(ctx context.Context, arg InvalidateUserTokensParams) error
+	IsAccessTokenRevoked(ctx context.Context, arg IsAccessTokenRevokedParams) (bool, error)
+	ListOAuthClients(ctx context.Context) ([]OauthClient, error)
+	ListServiceAccounts(ctx context.Context) ([]OauthClient, error)
+	ListTOTPSecrets(ctx context.Context, arg ListTOTPSecretsParams) ([]ListTOTPSecretsRow, error)
+	ListUserSessions(ctx context.Context, arg ListUserSessionsParams) ([]Session, error)
+	ListWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) ([]WebauthnCredential, error)
+	LockLoginKey(ctx context.Context, arg LockLoginKeyParams) error
+	MarkEmailVerified(ctx context.Context, id pgtype.UUID) error
+	MarkRefreshTokenUsed(ctx context.Context, id pgtype.UUID) (int64, error)
+	RecordDeviceCodePoll(ctx context.Context, arg RecordDeviceCodePollParams) error
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error)
+	ReplaceTOTPSecrets(ctx context.Context, arg ReplaceTOTPSecretsParams) (int64, error)
+	ResetLoginAttempts(ctx context.Context, keys []string) error
+	RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error
+	RevokeOAuthClient(ctx context.Context, clientID string) (int64, error)
+	RevokeOtherUserRefreshTokens(ctx context.Context, arg RevokeOtherUserRefreshTokensParams) error
+	RevokeOtherUserSessions(ctx context.Context, arg RevokeOtherUserSessionsParams) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID pgtype.UUID) error
+	RevokeServiceAccount(ctx context.Context, clientID string) (int64, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error)
+	RevokeUserRefreshTokens(ctx context.Context, userID pgtype.UUID) error
+	RevokeUserSessions(ctx context.Context, userID pgtype.UUID) error
+	RevokeUserTokensBefore(ctx context.Context, arg RevokeUserTokensBeforeParams) error
+	RotateServiceAccountSecret(ctx context.Context, arg RotateServiceAccountSecretParams) (OauthClient, error)
+	SaveConsent(ctx context.Context, arg SaveConsentParams) error
 	Set2FAStatus(ctx context.Context, arg Set2FAStatusParams) (User, error)
+	SetAuthorizationSession(ctx context.Context, arg SetAuthorizationSessionParams) error
+	SetEmailOTPStatus(ctx context.Context, arg SetEmailOTPStatusParams) error
+	SetPreferredFactor(ctx context.Context, arg SetPreferredFactorParams) error
+	SetSMSOTP(ctx context.Context, arg SetSMSOTPParams) error
+	SetWebAuthnSecondFactor(ctx context.Context, arg SetWebAuthnSecondFactorParams) error
+	StorePendingSecret2FA(ctx context.Context, arg StorePendingSecret2FAParams) error
 	StoreSecret2FA(ctx context.Context, arg StoreSecret2FAParams) error
+	TouchSession(ctx context.Context, id pgtype.UUID) error
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	UseWebAuthnCredential(ctx context.Context, arg UseWebAuthnCredentialParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,6 +11,59 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const acceptTOTPStep = `-- name: AcceptTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+`
+
+type AcceptTOTPStepParams struct {
+	ID           pgtype.UUID `json:"id"`
+	TotpLastStep pgtype.Int8 `json:"totp_last_step"`
+}
+
+func (q *Queries) AcceptTOTPStep(ctx context.Context, arg AcceptTOTPStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, acceptTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const activatePendingSecret2FA = `-- name: ActivatePendingSecret2FA :execrows
+UPDATE users
+SET totp_secret = totp_pending_secret, totp_pending_secret = NULL, totp_last_step = $3, two_fa_enabled = TRUE, updated_at = NOW()
+WHERE id = $1 AND totp_pending_secret = $2
+`
+
+type ActivatePendingSecret2FAParams struct {
+	ID                pgtype.UUID `json:"id"`
+	TotpPendingSecret pgtype.Text `json:"totp_pending_secret"`
+	TotpLastStep      pgtype.Int8 `json:"totp_last_step"`
+}
+
+func (q *Queries) ActivatePendingSecret2FA(ctx context.Context, arg ActivatePendingSecret2FAParams) (int64, error) {
+	result, err := q.db.Exec(ctx, activatePendingSecret2FA, arg.ID, arg.TotpPendingSecret, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const bumpTokenVersion = `-- name: BumpTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) BumpTokenVersion(ctx context.Context, id pgtype.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, bumpTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (username, email, password, role, created_at, updated_at)
 VALUES ($1, $2, $3, $4, NOW(), NOW())
@@ -54,19 +107,36 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 	return i, err
 }
 
+const disable2FA = `-- name: Disable2FA :exec
+UPDATE users
+SET two_fa_enabled = FALSE, totp_secret = NULL, totp_pending_secret = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) Disable2FA(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, disable2FA, id)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, email, password, role, two_fa_enabled 
+SELECT id, username, email, password, role, two_fa_enabled, email_verified_at, token_version, email_otp_enabled, preferred_factor, sms_otp_enabled, webauthn_second_factor
 FROM users
 WHERE email = $1
 `
 
 type GetUserByEmailRow struct {
-	ID           pgtype.UUID `json:"id"`
-	Username     string      `json:"username"`
-	Email        string      `json:"email"`
-	Password     string      `json:"password"`
-	Role         string      `json:"role"`
-	TwoFaEnabled pgtype.Bool `json:"two_fa_enabled"`
+	ID                   pgtype.UUID        `json:"id"`
+	Username             string             `json:"username"`
+	Email                string             `json:"email"`
+	Password             string             `json:"password"`
+	Role                 string             `json:"role"`
+	TwoFaEnabled         pgtype.Bool        `json:"two_fa_enabled"`
+	EmailVerifiedAt      pgtype.Timestamptz `json:"email_verified_at"`
+	TokenVersion         int32              `json:"token_version"`
+	EmailOtpEnabled      bool               `json:"email_otp_enabled"`
+	PreferredFactor      pgtype.Text        `json:"preferred_factor"`
+	SmsOtpEnabled        bool               `json:"sms_otp_enabled"`
+	WebauthnSecondFactor bool               `json:"webauthn_second_factor"`
 }
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error) {
@@ -79,12 +149,18 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 		&i.Password,
 		&i.Role,
 		&i.TwoFaEnabled,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.EmailOtpEnabled,
+		&i.PreferredFactor,
+		&i.SmsOtpEnabled,
+		&i.WebauthnSecondFactor,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, username, email, password, role, two_fa_enabled, totp_secret, created_at, updated_at 
+SELECT id, username, email, password, role, two_fa_enabled, totp_secret, totp_pending_secret, totp_last_step, email_verified_at, token_version, created_at, updated_at, email_otp_enabled, preferred_factor, phone_number, sms_otp_enabled, webauthn_second_factor 
 FROM users
 WHERE id = $1
 `
@@ -100,17 +176,106 @@ func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
 		&i.Role,
 		&i.TwoFaEnabled,
 		&i.TotpSecret,
+		&i.TotpPendingSecret,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EmailOtpEnabled,
+		&i.PreferredFactor,
+		&i.PhoneNumber,
+		&i.SmsOtpEnabled,
+		&i.WebauthnSecondFactor,
 	)
 	return i, err
 }
 
+const listTOTPSecrets = `-- name: ListTOTPSecrets :many
+SELECT id, totp_secret, totp_pending_secret
+FROM users
+WHERE id > $1 AND (totp_secret IS NOT NULL OR totp_pending_secret IS NOT NULL)
+ORDER BY id
+LIMIT $2
+`
+
+type ListTOTPSecretsParams struct {
+	ID    pgtype.UUID `json:"id"`
+	Limit int32       `json:"limit"`
+}
+
+type ListTOTPSecretsRow struct {
+	ID                pgtype.UUID `json:"id"`
+	TotpSecret        pgtype.Text `json:"totp_secret"`
+	TotpPendingSecret pgtype.Text `json:"totp_pending_secret"`
+}
+
+func (q *Queries) ListTOTPSecrets(ctx context.Context, arg ListTOTPSecretsParams) ([]ListTOTPSecretsRow, error) {
+	rows, err := q.db.Query(ctx, listTOTPSecrets, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTOTPSecretsRow
+	for rows.Next() {
+		var i ListTOTPSecretsRow
+		if err := rows.Scan(&i.ID, &i.TotpSecret, &i.TotpPendingSecret); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, markEmailVerified, id)
+	return err
+}
+
+const replaceTOTPSecrets = `-- name: ReplaceTOTPSecrets :execrows
+UPDATE users
+SET totp_secret = $2, totp_pending_secret = $3
+WHERE id = $1
+  AND totp_secret IS NOT DISTINCT FROM $4::text
+  AND totp_pending_secret IS NOT DISTINCT FROM $5::text
+`
+
+type ReplaceTOTPSecretsParams struct {
+	ID                   pgtype.UUID `json:"id"`
+	TotpSecret           pgtype.Text `json:"totp_secret"`
+	TotpPendingSecret    pgtype.Text `json:"totp_pending_secret"`
+	OldTotpSecret        pgtype.Text `json:"old_totp_secret"`
+	OldTotpPendingSecret pgtype.Text `json:"old_totp_pending_secret"`
+}
+
+func (q *Queries) ReplaceTOTPSecrets(ctx context.Context, arg ReplaceTOTPSecretsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, replaceTOTPSecrets,
+		arg.ID,
+		arg.TotpSecret,
+		arg.TotpPendingSecret,
+		arg.OldTotpSecret,
+		arg.OldTotpPendingSecret,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const set2FAStatus = `-- name: Set2FAStatus :one
 UPDATE users
 SET two_fa_enabled = $2
 WHERE id = $1
-RETURNING id, username, email, password, role, two_fa_enabled, totp_secret, created_at, updated_at
+RETURNING id, username, email, password, role, two_fa_enabled, totp_secret, totp_pending_secret, totp_last_step, email_verified_at, token_version, created_at, updated_at, email_otp_enabled, preferred_factor, phone_number, sms_otp_enabled, webauthn_second_factor
 `
 
 type Set2FAStatusParams struct {
@@ -129,12 +294,102 @@ func (q *Queries) Set2FAStatus(ctx context.Context, arg Set2FAStatusParams) (Use
 		&i.Role,
 		&i.TwoFaEnabled,
 		&i.TotpSecret,
+		&i.TotpPendingSecret,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EmailOtpEnabled,
+		&i.PreferredFactor,
+		&i.PhoneNumber,
+		&i.SmsOtpEnabled,
+		&i.WebauthnSecondFactor,
 	)
 	return i, err
 }
 
+const setEmailOTPStatus = `-- name: SetEmailOTPStatus :exec
+UPDATE users
+SET email_otp_enabled = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetEmailOTPStatusParams struct {
+	ID              pgtype.UUID `json:"id"`
+	EmailOtpEnabled bool        `json:"email_otp_enabled"`
+}
+
+func (q *Queries) SetEmailOTPStatus(ctx context.Context, arg SetEmailOTPStatusParams) error {
+	_, err := q.db.Exec(ctx, setEmailOTPStatus, arg.ID, arg.EmailOtpEnabled)
+	return err
+}
+
+const setPreferredFactor = `-- name: SetPreferredFactor :exec
+UPDATE users
+SET preferred_factor = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetPreferredFactorParams struct {
+	ID              pgtype.UUID `json:"id"`
+	PreferredFactor pgtype.Text `json:"preferred_factor"`
+}
+
+func (q *Queries) SetPreferredFactor(ctx context.Context, arg SetPreferredFactorParams) error {
+	_, err := q.db.Exec(ctx, setPreferredFactor, arg.ID, arg.PreferredFactor)
+	return err
+}
+
+const setSMSOTP = `-- name: SetSMSOTP :exec
+UPDATE users
+SET phone_number = $2, sms_otp_enabled = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetSMSOTPParams struct {
+	ID            pgtype.UUID `json:"id"`
+	PhoneNumber   pgtype.Text `json:"phone_number"`
+	SmsOtpEnabled bool        `json:"sms_otp_enabled"`
+}
+
+func (q *Queries) SetSMSOTP(ctx context.Context, arg SetSMSOTPParams) error {
+	_, err := q.db.Exec(ctx, setSMSOTP, arg.ID, arg.PhoneNumber, arg.SmsOtpEnabled)
+	return err
+}
+
+const setWebAuthnSecondFactor = `-- name: SetWebAuthnSecondFactor :exec
+UPDATE users
+SET webauthn_second_factor = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetWebAuthnSecondFactorParams struct {
+	ID                   pgtype.UUID `json:"id"`
+	WebauthnSecondFactor bool        `json:"webauthn_second_factor"`
+}
+
+func (q *Queries) SetWebAuthnSecondFactor(ctx context.Context, arg SetWebAuthnSecondFactorParams) error {
+	_, err := q.db.Exec(ctx, setWebAuthnSecondFactor, arg.ID, arg.WebauthnSecondFactor)
+	return err
+}
+
+const storePendingSecret2FA = `-- name: StorePendingSecret2FA :exec
+UPDATE users
+SET totp_pending_secret = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type StorePendingSecret2FAParams struct {
+	ID                pgtype.UUID `json:"id"`
+	TotpPendingSecret pgtype.Text `json:"totp_pending_secret"`
+}
+
+func (q *Queries) StorePendingSecret2FA(ctx context.Context, arg StorePendingSecret2FAParams) error {
+	_, err := q.db.Exec(ctx, storePendingSecret2FA, arg.ID, arg.TotpPendingSecret)
+	return err
+}
+
 const storeSecret2FA = `-- name: StoreSecret2FA :exec
 UPDATE users 
 SET totp_secret = $2 
@@ -150,3 +405,19 @@ func (q *Queries) StoreSecret2FA(ctx context.Context, arg StoreSecret2FAParams)
 	_, err := q.db.Exec(ctx, storeSecret2FA, arg.ID, arg.TotpSecret)
 	return err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID       pgtype.UUID `json:"id"`
+	Password string      `json:"password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.Password)
+	return err
+}
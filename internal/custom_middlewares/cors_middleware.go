@@ -0,0 +1,25 @@
+package custommiddlewares
+
+import (
+	"net/http"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CORSMiddleware lets the front call the api with its cookies (the nonce of
+// the magic links): the origins of CORS_ORIGINS get the credentials, the
+// others get no Access-Control-Allow-Origin. A wildcard can't carry
+// credentials, the browser would drop the cookie
+func CORSMiddleware() echo.MiddlewareFunc {
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     config.AppConfig.CORSOrigins,
+		AllowCredentials: true,
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		// Autherization carries the temp token of the second factor step
+		AllowHeaders:  []string{"Content-Type", "Authorization", "Autherization"},
+		ExposeHeaders: []string{"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "WWW-Authenticate"},
+		MaxAge:        600,
+	})
+}
@@ -1,59 +1,160 @@
 package custommiddlewares
 
 import (
+	"context"
 	"net/http"
-	"os"
 	"strings"
 
 	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/internal/revocation"
 	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
 	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// revocation store checked for every access token, set once at startup
+var revocationStore revocation.Store
 
-func JwtAuthMidd(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
+func SetRevocationStore(store revocation.Store) {
+	revocationStore = store
+}
 
-		authHeader := c.Request().Header.Get("Authorization")
+// SessionTracker records the activity of the session an access token belongs to
+type SessionTracker interface {
+	Touch(ctx context.Context, sessionID pgtype.UUID) error
+}
 
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			return response.ErrResp(c, &dtos.ApiErr{
-				Status:  http.StatusBadRequest,
-				Code:    "INVALID_ACCESS_TOKEN",
-				Err:     "Missing or invalid Authorization header",
-				Details: nil,
-			})
+var sessionTracker SessionTracker
+
+func SetSessionTracker(tracker SessionTracker) {
+	sessionTracker = tracker
+}
+
+// authenticate checks the bearer access token of the request: signature,
+// expiry and revocation. Both the api and the oauth middlewares start here
+func authenticate(c echo.Context) (*jwtImpl.CustomAccessTokenClaims, *dtos.ApiErr) {
+
+	authHeader := c.Request().Header.Get("Authorization")
+
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_ACCESS_TOKEN",
+			Err:     "Missing or invalid Authorization header",
+			Details: nil,
 		}
+	}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, val, err := jwtImpl.ParseExtractClaims(tokenStr, "access", string(jwtSecret))
+	token, val, err := jwtImpl.ParseExtractClaims(tokenStr, "access", config.AppConfig.JWTSEC)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     "Something went wrong, try later",
+			Details: nil,
+		}
+	}
+	if !val {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "EXPIRED_TOKEN",
+			Err:     "Access token is expired use refresh token",
+			Details: nil,
+		}
+	}
+
+	claims, ok := token.Claims.(*jwtImpl.CustomAccessTokenClaims)
+	if !ok {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "INVALID_CLAIMS",
+			Err:     "Invalid token claims",
+			Details: nil,
+		}
+	}
+
+	// reject tokens ended by a logout
+	if revocationStore != nil {
+		revoked, err := revocationStore.IsRevoked(c.Request().Context(), claims)
 		if err != nil {
-			return response.ErrResp(c, &dtos.ApiErr{
+			logger.Error("failed to check token revocation", zap.Error(err))
+			return nil, &dtos.ApiErr{
 				Status:  http.StatusInternalServerError,
 				Code:    "INTERNAL_ERROR",
 				Err:     "Something went wrong, try later",
 				Details: nil,
-			})
+			}
 		}
-		if !val {
-			return response.ErrResp(c, &dtos.ApiErr{
+		if revoked {
+			return nil, &dtos.ApiErr{
 				Status:  http.StatusUnauthorized,
-				Code:    "EXPIRED_TOKEN",
-				Err:     "Access token is expired use refresh token",
+				Code:    "REVOKED_TOKEN",
+				Err:     "Access token was revoked login again",
+				Details: nil,
+			}
+		}
+	}
+
+	// last seen time of the device, failing here must not block the request
+	if sessionTracker != nil && claims.SessionID.Valid {
+		if err := sessionTracker.Touch(c.Request().Context(), claims.SessionID); err != nil {
+			logger.Warn("failed to update session activity", zap.Error(err))
+		}
+	}
+
+	return claims, nil
+}
+
+// JwtAuthMidd accepts the tokens of the first party app (humans) and of the
+// service accounts, the principal tells them apart. Only humans get the User
+// claims, the routes reading them run RequireHuman
+func JwtAuthMidd(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		claims, apiErr := authenticate(c)
+		if apiErr != nil {
+			return response.ErrResp(c, apiErr)
+		}
+
+		p := principal.FromClaims(claims)
+
+		// tokens delegated by a user to an oauth client are for the resource
+		// servers, not for the account api
+		if p.IsHuman() && claims.ClientID != "" {
+			return response.ErrResp(c, &dtos.ApiErr{
+				Status:  http.StatusForbidden,
+				Code:    "CLIENT_TOKEN_NOT_ALLOWED",
+				Err:     "Tokens issued to oauth clients can't use this endpoint",
 				Details: nil,
 			})
 		}
 
-		if claims, ok := token.Claims.(*jwtImpl.CustomAccessTokenClaims); ok {
+		principal.Set(c, p)
+		if p.IsHuman() {
 			c.Set("User", claims)
-		} else {
+		}
+
+		return next(c)
+	}
+}
+
+// RequireHuman refuses the service accounts, it runs after JwtAuthMidd
+func RequireHuman(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		p, ok := principal.FromContext(c)
+		if !ok || !p.IsHuman() {
 			return response.ErrResp(c, &dtos.ApiErr{
-				Status:  http.StatusUnauthorized,
-				Code:    "INVALID_CLAIMS",
-				Err:     "Invalid token claims",
+				Status:  http.StatusForbidden,
+				Code:    "HUMAN_REQUIRED",
+				Err:     "Service accounts can't use this endpoint",
 				Details: nil,
 			})
 		}
@@ -3,6 +3,7 @@ package custommiddlewares
 import (
 	"time"
 
+	"github.com/BigBr41n/echoAuth/utils/clientinfo"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
@@ -11,10 +12,7 @@ func LoggerMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		start := time.Now()
 
-		ip := c.Request().Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = c.Request().RemoteAddr
-		}
+		ip := clientinfo.IP(c)
 
 		err := next(c)
 
@@ -0,0 +1,128 @@
+package custommiddlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// multi factor policy of the routes, set once at startup
+var mfaPolicy *mfapolicy.Policy
+
+func SetMFAPolicy(policy *mfapolicy.Policy) {
+	mfaPolicy = policy
+}
+
+// TOTPEnrollment tells whether a user has the authenticator app, the step up
+// is answered with it
+type TOTPEnrollment interface {
+	HasTOTP(ctx context.Context, userID pgtype.UUID) (bool, error)
+}
+
+// looked up when a step up is asked, set once at startup
+var totpEnrollment TOTPEnrollment
+
+func SetTOTPEnrollment(enrollment TOTPEnrollment) {
+	totpEnrollment = enrollment
+}
+
+// RequireMFAPolicy checks the login behind the token against the policy of
+// the route level, it runs after JwtAuthMidd. Service accounts don't log in,
+// the policy is for humans only
+func RequireMFAPolicy(level mfapolicy.Level) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			if mfaPolicy == nil {
+				return next(c)
+			}
+			if p, ok := principal.FromContext(c); ok && p.IsService() {
+				return next(c)
+			}
+
+			claims, ok := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+			if !ok {
+				return response.ErrResp(c, &dtos.ApiErr{
+					Status:  http.StatusUnauthorized,
+					Code:    "INVALID_CLAIMS",
+					Err:     "Invalid token claims",
+					Details: nil,
+				})
+			}
+
+			var authTime time.Time
+			if claims.AuthTime != nil {
+				authTime = claims.AuthTime.Time
+			}
+
+			decision := mfaPolicy.Evaluate(claims.Role, level, claims.AMR, authTime, time.Now())
+			if decision.Allowed {
+				return next(c)
+			}
+
+			// a step up the user can't answer, the app must be set up first
+			if decision.Code == mfapolicy.StepUpRequired && totpEnrollment != nil {
+				enrolled, err := totpEnrollment.HasTOTP(c.Request().Context(), claims.UserID)
+				if err != nil {
+					return response.ErrResp(c, &dtos.ApiErr{
+						Status:  http.StatusInternalServerError,
+						Code:    "INTERNAL_ERROR",
+						Err:     err.Error(),
+						Details: nil,
+					})
+				}
+				if !enrolled {
+					return response.ErrResp(c, totpEnrollmentErr(decision))
+				}
+			}
+
+			return response.ErrResp(c, stepUpErr(decision))
+		}
+	}
+}
+
+// stepUpErr is a RFC 9470 challenge, the client reads the level and the max
+// age of the login to ask for from the WWW-Authenticate header
+func stepUpErr(decision mfapolicy.Decision) *dtos.ApiErr {
+	req := decision.Requirement
+
+	msg := "Log in again to access this resource"
+	if decision.Code == mfapolicy.StepUpRequired {
+		msg = "Confirm with your authenticator app on /api/v1/auth/step-up to access this resource"
+	}
+
+	details := map[string]any{"acr_values": req.ACR()}
+	challenge := fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="%s", acr_values="%s"`, msg, req.ACR())
+	if req.MaxAge > 0 {
+		details["max_age"] = int(req.MaxAge.Seconds())
+		challenge += fmt.Sprintf(`, max_age=%d`, int(req.MaxAge.Seconds()))
+	}
+
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    decision.Code,
+		Err:     msg,
+		Details: details,
+		Headers: map[string]string{"WWW-Authenticate": challenge},
+	}
+}
+
+// totpEnrollmentErr sends the user to the totp setup, the step up and the
+// role bound to a totp need it
+func totpEnrollmentErr(decision mfapolicy.Decision) *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusForbidden,
+		Code:    mfapolicy.TOTPEnrollmentRequired,
+		Err:     "Set up your authenticator app on /api/v1/auth/2FA/setup to access this resource",
+		Details: map[string]any{"acr_values": decision.Requirement.ACR(), "setup": "/api/v1/auth/2FA/setup"},
+	}
+}
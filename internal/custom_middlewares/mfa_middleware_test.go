@@ -0,0 +1,78 @@
+package custommiddlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+type staticEnrollment bool
+
+func (e staticEnrollment) HasTOTP(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	return bool(e), nil
+}
+
+func TestRequireMFAPolicyEnrollment(t *testing.T) {
+	savedPolicy, savedEnrollment := mfaPolicy, totpEnrollment
+	t.Cleanup(func() { mfaPolicy, totpEnrollment = savedPolicy, savedEnrollment })
+	SetMFAPolicy(&mfapolicy.Policy{TOTPRoles: []string{"seller"}, SensitiveMaxAge: 10 * time.Minute})
+
+	loggedIn := jwt.NewNumericDate(time.Now())
+	tests := []struct {
+		name     string
+		role     string
+		amr      []string
+		level    mfapolicy.Level
+		enrolled bool
+		want     int
+		code     string
+	}{
+		{"seller without totp", "seller", []string{"pwd"}, mfapolicy.Standard, false, http.StatusForbidden, mfapolicy.TOTPEnrollmentRequired},
+		{"seller with totp", "seller", []string{"pwd"}, mfapolicy.Standard, true, http.StatusUnauthorized, mfapolicy.StepUpRequired},
+		{"seller logged in with totp", "seller", []string{"pwd", "otp", "mfa"}, mfapolicy.Standard, true, http.StatusNoContent, ""},
+		{"client on a standard route", "client", []string{"pwd"}, mfapolicy.Standard, false, http.StatusNoContent, ""},
+		{"client without totp on a sensitive route", "client", []string{"pwd"}, mfapolicy.Sensitive, false, http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTOTPEnrollment(staticEnrollment(tt.enrolled))
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			c.Set("User", &jwtImpl.CustomAccessTokenClaims{Role: tt.role, AMR: tt.amr, AuthTime: loggedIn})
+
+			h := RequireMFAPolicy(tt.level)(func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			})
+			if err := h(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.code == "" {
+				return
+			}
+
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code {
+				t.Errorf("code %s, want %s", body.Code, tt.code)
+			}
+		})
+	}
+}
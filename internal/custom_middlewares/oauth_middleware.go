@@ -0,0 +1,75 @@
+package custommiddlewares
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/labstack/echo/v4"
+)
+
+// bearerErr is a RFC 6750 error, the client reads the reason from the
+// WWW-Authenticate header
+func bearerErr(status int, code string, msg string) *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  status,
+		Code:    code,
+		Err:     msg,
+		Details: nil,
+		Headers: map[string]string{
+			"WWW-Authenticate": fmt.Sprintf(`Bearer error="%s", error_description="%s"`, code, msg),
+		},
+	}
+}
+
+// OAuthBearerMidd accepts the tokens a user delegated to an oauth client
+// only, the first party app and the service accounts keep to JwtAuthMidd
+func OAuthBearerMidd(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		claims, apiErr := authenticate(c)
+		if apiErr != nil {
+			if apiErr.Status == http.StatusInternalServerError {
+				return response.OAuthErrResp(c, &dtos.ApiErr{
+					Status:  http.StatusInternalServerError,
+					Code:    "server_error",
+					Err:     apiErr.Err,
+					Details: nil,
+				})
+			}
+			if apiErr.Code == "INVALID_ACCESS_TOKEN" {
+				return response.OAuthErrResp(c, bearerErr(http.StatusUnauthorized, "invalid_request", apiErr.Err))
+			}
+			return response.OAuthErrResp(c, bearerErr(http.StatusUnauthorized, "invalid_token", apiErr.Err))
+		}
+
+		// a service account token has no user behind it
+		if claims.ClientID == "" || !claims.UserID.Valid {
+			return response.OAuthErrResp(c, bearerErr(http.StatusUnauthorized, "invalid_token", "The token wasn't delegated by a user to an oauth client"))
+		}
+
+		c.Set("User", claims)
+
+		return next(c)
+	}
+}
+
+// RequireScope lets through the tokens granted the scope, it runs after
+// OAuthBearerMidd
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			claims, ok := c.Get("User").(*jwtImpl.CustomAccessTokenClaims)
+			if !ok || !slices.Contains(strings.Fields(claims.Scope), scope) {
+				return response.OAuthErrResp(c, bearerErr(http.StatusForbidden, "insufficient_scope", "The token needs the "+scope+" scope"))
+			}
+
+			return next(c)
+		}
+	}
+}
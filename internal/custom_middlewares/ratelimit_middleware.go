@@ -0,0 +1,107 @@
+package custommiddlewares
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/utils/clientinfo"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// limiter shared by every rate limited route, set once at startup
+var rateLimiter ratelimit.Limiter
+
+func SetRateLimiter(limiter ratelimit.Limiter) {
+	rateLimiter = limiter
+}
+
+// KeyFunc returns the identity a request is counted for
+type KeyFunc func(c echo.Context) string
+
+// KeyByIP counts the requests per client address
+func KeyByIP(c echo.Context) string {
+	return "ip:" + clientinfo.IP(c)
+}
+
+// KeyByUser counts the requests per user or service account, it runs after
+// JwtAuthMidd and falls back to the ip
+func KeyByUser(c echo.Context) string {
+	if p, ok := principal.FromContext(c); ok && p.IsService() {
+		return "service:" + p.ClientID
+	}
+	if claims, ok := c.Get("User").(*jwtImpl.CustomAccessTokenClaims); ok && claims.UserID.Valid {
+		return "user:" + claims.UserID.String()
+	}
+	return KeyByIP(c)
+}
+
+// RateLimit rejects the requests of a key over the rule with a 429, the
+// RateLimit-* headers are sent with every answer. The request goes through if
+// the backend fails
+func RateLimit(rule ratelimit.Rule, keyFn KeyFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			if rateLimiter == nil || rule.Limit <= 0 {
+				return next(c)
+			}
+
+			res, err := rateLimiter.Allow(c.Request().Context(), keyFn(c), rule)
+			if err != nil {
+				logger.Warn("rate limiter unavailable", zap.String("rule", rule.Name), zap.Error(err))
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+			header.Set("RateLimit-Policy", strconv.Itoa(rule.Limit)+";w="+strconv.Itoa(ceilSeconds(rule.Window)))
+
+			if !res.Allowed {
+				retry := strconv.Itoa(ceilSeconds(res.RetryAfter))
+				return response.ErrResp(c, &dtos.ApiErr{
+					Status:  http.StatusTooManyRequests,
+					Code:    "RATE_LIMITED",
+					Err:     "Too many requests, slow down",
+					Details: nil,
+					Headers: map[string]string{"Retry-After": retry},
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// AuthRateLimit is the strict per ip limit of the public auth routes
+func AuthRateLimit() echo.MiddlewareFunc {
+	return RateLimit(ratelimit.Rule{
+		Name:   "auth",
+		Limit:  config.AppConfig.RateLimitAuthLimit,
+		Window: config.AppConfig.RateLimitAuthWindow,
+	}, KeyByIP)
+}
+
+// UserRateLimit is the per user limit of the authenticated routes
+func UserRateLimit() echo.MiddlewareFunc {
+	return RateLimit(ratelimit.Rule{
+		Name:   "user",
+		Limit:  config.AppConfig.RateLimitUserLimit,
+		Window: config.AppConfig.RateLimitUserWindow,
+	}, KeyByUser)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
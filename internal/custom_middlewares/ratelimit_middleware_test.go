@@ -0,0 +1,109 @@
+package custommiddlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/utils/clientinfo"
+	"github.com/labstack/echo/v4"
+)
+
+func serveLimited(t *testing.T, h echo.HandlerFunc, remoteAddr string, xff string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	if err := h(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	SetRateLimiter(ratelimit.NewMemoryLimiter())
+	t.Cleanup(func() { SetRateLimiter(nil) })
+
+	rule := ratelimit.Rule{Name: "test", Limit: 2, Window: time.Minute}
+	h := RateLimit(rule, KeyByIP)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	rec := serveLimited(t, h, "198.51.100.7:4000", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want 204", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Policy":    "2;w=60",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if rec.Header().Get("RateLimit-Reset") == "" {
+		t.Error("no RateLimit-Reset header")
+	}
+
+	serveLimited(t, h, "198.51.100.7:4001", "")
+	rec = serveLimited(t, h, "198.51.100.7:4002", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", rec.Header().Get("RateLimit-Remaining"))
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header on a 429")
+	}
+}
+
+func TestKeyByIPIgnoresForwardedForFromClients(t *testing.T) {
+	SetRateLimiter(ratelimit.NewMemoryLimiter())
+	t.Cleanup(func() { SetRateLimiter(nil) })
+
+	rule := ratelimit.Rule{Name: "test", Limit: 1, Window: time.Minute}
+	h := RateLimit(rule, KeyByIP)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	serveLimited(t, h, "198.51.100.7:4000", "203.0.113.1")
+	rec := serveLimited(t, h, "198.51.100.7:4000", "203.0.113.2")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("a new X-Forwarded-For got through the limit, status %d", rec.Code)
+	}
+}
+
+func TestKeyByIPReadsForwardedForFromTrustedProxies(t *testing.T) {
+	if err := clientinfo.TrustProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clientinfo.TrustProxies(nil) })
+
+	for _, tc := range []struct {
+		remote string
+		xff    string
+		want   string
+	}{
+		{"10.0.0.2:443", "203.0.113.9", "ip:203.0.113.9"},
+		// the client prepends its own entry, the proxy appends the real one
+		{"10.0.0.2:443", "192.0.2.1, 203.0.113.9", "ip:203.0.113.9"},
+		{"198.51.100.7:443", "203.0.113.9", "ip:198.51.100.7"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Forwarded-For", tc.xff)
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+
+		if got := KeyByIP(c); got != tc.want {
+			t.Errorf("remote %s, xff %q: key %q, want %q", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+}
@@ -18,9 +18,7 @@ func ResponseHeadersMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		c.Response().Header().Set("Content-Security-Policy", "default-src 'self'")
 		c.Response().Header().Set("Permissions-Policy", "geolocation=(), microphone=()")
 
-		c.Response().Header().Set("Access-Control-Allow-Origin", "*") //currently no domains
-		c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		// the Access-Control-* headers are set by CORSMiddleware
 
 		if c.Response().Header().Get("Content-Type") == "" {
 			c.Response().Header().Set("Content-Type", "application/json")
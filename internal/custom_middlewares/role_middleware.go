@@ -0,0 +1,57 @@
+package custommiddlewares
+
+import (
+	"net/http"
+	"slices"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/utils/response"
+	"github.com/labstack/echo/v4"
+)
+
+func forbiddenErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusForbidden,
+		Code:    "FORBIDDEN",
+		Err:     "You are not allowed to access this resource",
+		Details: nil,
+	}
+}
+
+// RequireRole lets only the users of the given roles through, it runs after
+// JwtAuthMidd. Service accounts have no role, they are refused
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return RequireRoleOrScope(roles, "")
+}
+
+// RequireRoleOrScope lets through the users of the given roles and the service
+// accounts granted the scope, an empty scope refuses every service account.
+// A scope named like a role doesn't count, the admin scopes are explicit
+// (principal.ScopeAdmin...)
+func RequireRoleOrScope(roles []string, scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			p, ok := principal.FromContext(c)
+			if !ok {
+				return response.ErrResp(c, &dtos.ApiErr{
+					Status:  http.StatusUnauthorized,
+					Code:    "INVALID_CLAIMS",
+					Err:     "Invalid token claims",
+					Details: nil,
+				})
+			}
+
+			allowed := p.IsHuman() && slices.Contains(roles, p.Role)
+			if p.IsService() {
+				allowed = scope != "" && p.HasScope(scope)
+			}
+			if !allowed {
+				return response.ErrResp(c, forbiddenErr())
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package custommiddlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequireRoleOrScope(t *testing.T) {
+	human := func(role string) *principal.Principal {
+		return &principal.Principal{Kind: principal.Human, ID: "u1", Role: role}
+	}
+	service := func(scopes ...string) *principal.Principal {
+		return &principal.Principal{Kind: principal.Service, ID: "c1", Role: principal.RoleService, Scopes: scopes}
+	}
+
+	tests := []struct {
+		name string
+		mw   echo.MiddlewareFunc
+		p    *principal.Principal
+		want int
+	}{
+		{"admin", RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), human("admin"), http.StatusNoContent},
+		{"client", RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), human("client"), http.StatusForbidden},
+		{"human with the scope role", RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), human(principal.ScopeAdminLockouts), http.StatusForbidden},
+		{"service with the scope", RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), service(principal.ScopeAdminLockouts), http.StatusNoContent},
+		{"service with another admin scope", RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), service(principal.ScopeAdminServiceAccounts), http.StatusForbidden},
+		{"service with a scope named like the role", RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), service("admin"), http.StatusForbidden},
+		{"role only refuses services", RequireRole("admin"), service("admin", principal.ScopeAdminLockouts), http.StatusForbidden},
+		{"service with the service role", RequireRole(principal.RoleService), service(), http.StatusForbidden},
+		{"no principal", RequireRole("admin"), nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin", nil), rec)
+			if tt.p != nil {
+				principal.Set(c, tt.p)
+			}
+
+			h := tt.mw(func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			})
+			if err := h(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package keyring
+
+import "os"
+
+// no flock here, only the changes of this process are serialized: run the
+// `keys` commands while the scheduled rotation is off
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestUpdateWaitsForTheOtherProcesses(t *testing.T) {
+	r := &Ring{dir: t.TempDir(), alg: "EdDSA"}
+
+	// another open of the lock file stands for another process, the flock
+	// is held by the open file and not by the process
+	f, err := os.OpenFile(filepath.Join(r.dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Generate("")
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("the manifest was updated under the lock of another process")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := unlockFile(f); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the update still waits after the release")
+	}
+
+	keys, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("%d keys, want 1", len(keys))
+	}
+}
@@ -0,0 +1,123 @@
+package keyring
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestFile lists the keys of the directory and their states, the private
+// keys are stored next to it as <kid>.pem
+const manifestFile = "keyring.json"
+
+// lockFileName is flocked during the manifest updates, the manifest is
+// replaced by a rename and can't carry the lock itself
+const lockFileName = "keyring.lock"
+
+// State of a key in the ring
+type State string
+
+const (
+	// signs the new tokens, exactly one key is active
+	StateActive State = "active"
+	// published and accepted but never used to sign: a key waiting to be
+	// promoted or a previous key kept until its tokens expire
+	StateVerifyOnly State = "verify-only"
+	// no longer published nor accepted, its private key is deleted
+	StateRetired State = "retired"
+)
+
+// Entry is a key of the manifest
+type Entry struct {
+	KID         string     `json:"kid"`
+	Alg         string     `json:"alg"`
+	State       State      `json:"state"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	// end of the overlap of a demoted key, retired once passed
+	RetireAt  *time.Time `json:"retire_at,omitempty"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// Manifest is the content of keyring.json
+type Manifest struct {
+	Keys []*Entry `json:"keys"`
+}
+
+// find returns the entry of the kid, nil when unknown
+func (m *Manifest) find(kid string) *Entry {
+	for _, entry := range m.Keys {
+		if entry.KID == kid {
+			return entry
+		}
+	}
+	return nil
+}
+
+// active returns the active entry, nil when the ring has none
+func (m *Manifest) active() *Entry {
+	for _, entry := range m.Keys {
+		if entry.State == StateActive {
+			return entry
+		}
+	}
+	return nil
+}
+
+// pending returns the newest verify-only key that was never active, the next
+// key to promote
+func (m *Manifest) pending() *Entry {
+	var next *Entry
+	for _, entry := range m.Keys {
+		if entry.State != StateVerifyOnly || entry.ActivatedAt != nil {
+			continue
+		}
+		if next == nil || entry.CreatedAt.After(next.CreatedAt) {
+			next = entry
+		}
+	}
+	return next
+}
+
+// readManifest reads the manifest of the directory, empty when missing
+func readManifest(dir string) (*Manifest, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{Keys: []*Entry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// writeManifest replaces the manifest through a rename so a reload never
+// reads a partial file
+func writeManifest(dir string, m *Manifest) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, manifestFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, manifestFile))
+}
@@ -0,0 +1,350 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+)
+
+// prePublish is how long a new key is published before it signs, so the
+// verifiers caching the jwks know it when the first token arrives
+const prePublish = 10 * time.Minute
+
+var ErrUnknownKey = errors.New("keyring: unknown key")
+
+// Ring manages the signing keys of a directory
+type Ring struct {
+	dir string
+	// key of the generated keys
+	alg string
+	// rotation period of the active key, no automatic rotation when zero
+	rotation time.Duration
+	// how long a demoted key keeps verifying
+	overlap time.Duration
+	// serializes the changes made by this process, the flock of lock()
+	// those of the other processes sharing the directory
+	mu sync.Mutex
+}
+
+// New opens the key ring of JWT_KEYS_DIR, nil when unset
+func New() (*Ring, error) {
+	cfg := config.AppConfig
+	if cfg.JWTKeysDir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(cfg.JWTKeysDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Ring{
+		dir:      cfg.JWTKeysDir,
+		alg:      cfg.JWTKeyAlg,
+		rotation: cfg.JWTKeyRotation,
+		overlap:  cfg.JWTKeyOverlap,
+	}, nil
+}
+
+// List returns the keys of the manifest
+func (r *Ring) List() ([]*Entry, error) {
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys, nil
+}
+
+// Generate creates a key of the algorithm (the configured one when empty) in
+// the verify-only state, it signs once promoted
+func (r *Ring) Generate(alg string) (*Entry, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := r.generate(m, alg, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return entry, writeManifest(r.dir, m)
+}
+
+// Promote makes the key active, the previous active key keeps verifying until
+// the end of the overlap
+func (r *Ring) Promote(kid string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return err
+	}
+	if err := r.promote(m, kid, time.Now()); err != nil {
+		return err
+	}
+	return writeManifest(r.dir, m)
+}
+
+// Retire stops publishing and accepting the key and deletes its private key,
+// the tokens it signed are rejected from now on
+func (r *Ring) Retire(kid string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return err
+	}
+	entry := m.find(kid)
+	if entry == nil {
+		return ErrUnknownKey
+	}
+	if entry.State == StateActive {
+		return errors.New("keyring: promote another key before retiring the active one")
+	}
+	if err := r.retire(entry, time.Now()); err != nil {
+		return err
+	}
+	return writeManifest(r.dir, m)
+}
+
+// Rotate runs the scheduled steps: it retires the keys past their overlap,
+// pre-publishes the next key shortly before the rotation and promotes it once
+// the active key is older than the rotation period. A ring without active key
+// gets one. It reports whether the manifest changed
+func (r *Ring) Rotate(now time.Time) (bool, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+
+	for _, entry := range m.Keys {
+		if entry.State == StateVerifyOnly && entry.RetireAt != nil && !now.Before(*entry.RetireAt) {
+			if err := r.retire(entry, now); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	active := m.active()
+	switch {
+	case active == nil:
+		next := m.pending()
+		if next == nil {
+			if next, err = r.generate(m, "", now); err != nil {
+				return false, err
+			}
+		}
+		if err := r.promote(m, next.KID, now); err != nil {
+			return false, err
+		}
+		changed = true
+
+	case r.rotation > 0 && active.ActivatedAt != nil:
+		due := active.ActivatedAt.Add(r.rotation)
+		next := m.pending()
+		if next == nil && !now.Before(due.Add(-prePublish)) {
+			if next, err = r.generate(m, "", now); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+		// the key must have been published for a while, even when the
+		// rotation is overdue
+		if next != nil && !now.Before(due) && !now.Before(next.CreatedAt.Add(prePublish)) {
+			if err := r.promote(m, next.KID, now); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+	return true, writeManifest(r.dir, m)
+}
+
+// Apply loads the active and verify-only keys into the token signer, the keys
+// missing from the manifest or retired aren't accepted anymore
+func (r *Ring) Apply() error {
+	m, err := readManifest(r.dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		active     *jwtImpl.SigningKey
+		verifyOnly []*jwtImpl.SigningKey
+	)
+	for _, entry := range m.Keys {
+		if entry.State == StateRetired {
+			continue
+		}
+		sk, err := r.load(entry.KID)
+		if err != nil {
+			return fmt.Errorf("keyring: key %s: %w", entry.KID, err)
+		}
+		if entry.State == StateActive {
+			active = sk
+		} else {
+			verifyOnly = append(verifyOnly, sk)
+		}
+	}
+	if active == nil {
+		return errors.New("keyring: no active key, run `keys rotate` or `keys promote <kid>`")
+	}
+
+	jwtImpl.SetSigningKeys(active, verifyOnly)
+	return nil
+}
+
+// lock serializes the read-modify-rename of the manifest between the
+// goroutines and between the processes (a server rotating on schedule and a
+// `keys` command), it returns the release
+func (r *Ring) lock() (func(), error) {
+	r.mu.Lock()
+
+	f, err := os.OpenFile(filepath.Join(r.dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		r.mu.Unlock()
+		return nil, fmt.Errorf("keyring: lock %s: %w", lockFileName, err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+		r.mu.Unlock()
+	}, nil
+}
+
+func (r *Ring) generate(m *Manifest, alg string, now time.Time) (*Entry, error) {
+	if alg == "" {
+		alg = r.alg
+	}
+	private, err := generateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := jwtImpl.NewSigningKey(private, "")
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	raw := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(r.keyPath(sk.ID), raw, 0o600); err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		KID:       sk.ID,
+		Alg:       sk.Method.Alg(),
+		State:     StateVerifyOnly,
+		CreatedAt: now,
+	}
+	m.Keys = append(m.Keys, entry)
+	return entry, nil
+}
+
+func (r *Ring) promote(m *Manifest, kid string, now time.Time) error {
+	entry := m.find(kid)
+	if entry == nil {
+		return ErrUnknownKey
+	}
+	switch entry.State {
+	case StateActive:
+		return nil
+	case StateRetired:
+		return errors.New("keyring: a retired key can't be promoted")
+	}
+
+	if current := m.active(); current != nil {
+		retireAt := now.Add(r.overlap)
+		current.State = StateVerifyOnly
+		current.RetireAt = &retireAt
+	}
+	entry.State = StateActive
+	entry.ActivatedAt = &now
+	entry.RetireAt = nil
+	return nil
+}
+
+func (r *Ring) retire(entry *Entry, now time.Time) error {
+	if err := os.Remove(r.keyPath(entry.KID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	entry.State = StateRetired
+	entry.RetiredAt = &now
+	return nil
+}
+
+func (r *Ring) load(kid string) (*jwtImpl.SigningKey, error) {
+	raw, err := os.ReadFile(r.keyPath(kid))
+	if err != nil {
+		return nil, err
+	}
+	private, err := jwtImpl.ParsePrivateKeyPEM(raw)
+	if err != nil {
+		return nil, err
+	}
+	return jwtImpl.NewSigningKey(private, kid)
+}
+
+func (r *Ring) keyPath(kid string) string {
+	return filepath.Join(r.dir, kid+".pem")
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "EdDSA":
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return nil, fmt.Errorf("keyring: unsupported algorithm %q (EdDSA, ES256 or RS256)", alg)
+	}
+}
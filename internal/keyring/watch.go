@@ -0,0 +1,44 @@
+package keyring
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"go.uber.org/zap"
+)
+
+// reloadInterval is how often the directory is read again, so the changes of
+// the keys subcommand (or of another instance) are picked up without restart
+const reloadInterval = time.Minute
+
+// Watch runs the scheduled steps of the ring and reloads the keys every
+// minute and on SIGHUP. It never returns
+func (r *Ring) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := r.Rotate(time.Now())
+			if err != nil {
+				logger.Error("failed to rotate the signing keys", zap.Error(err))
+			} else if changed {
+				logger.Info("signing keys rotated")
+			}
+		case <-hup:
+			logger.Info("reloading the signing keys")
+		}
+
+		if err := r.Apply(); err != nil {
+			// the keys already loaded stay in use
+			logger.Error("failed to reload the signing keys", zap.Error(err))
+		}
+	}
+}
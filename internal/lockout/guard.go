@@ -0,0 +1,150 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+)
+
+// Policy sets when a key gets locked and for how long
+type Policy struct {
+	// failures in the window before the first lock
+	Threshold int
+	// length of the first lock, doubled on every failure after it
+	BaseDelay time.Duration
+	// upper bound of a lock
+	MaxDelay time.Duration
+	// failures older than the window are forgotten
+	Window time.Duration
+}
+
+// Delay returns the lock earned by the given number of failures, zero while
+// under the threshold
+func (p Policy) Delay(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Guard applies the account and the ip policies on top of a store. The
+// account key limits the guesses on one account whatever the ip, the ip key
+// limits one client spraying many accounts
+type Guard struct {
+	store   Store
+	account Policy
+	ip      Policy
+}
+
+// NewGuard builds a guard with the policies of the app config
+func NewGuard(store Store) *Guard {
+	cfg := config.AppConfig
+	return &Guard{
+		store: store,
+		account: Policy{
+			Threshold: cfg.LockoutThreshold,
+			BaseDelay: cfg.LockoutBaseDelay,
+			MaxDelay:  cfg.LockoutMaxDelay,
+			Window:    cfg.LockoutWindow,
+		},
+		ip: Policy{
+			Threshold: cfg.LockoutIPThreshold,
+			BaseDelay: cfg.LockoutBaseDelay,
+			MaxDelay:  cfg.LockoutMaxDelay,
+			Window:    cfg.LockoutWindow,
+		},
+	}
+}
+
+// LoginKey is the account key of the password step, the email is used so an
+// unknown address is limited like a known one
+func LoginKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// SecondFactorKey is the account key of the second factor step
+func SecondFactorKey(userID string) string {
+	return "2fa:" + userID
+}
+
+// IPKey is the key of a client address
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the account key or the ip stays locked, zero when
+// the attempt can go on
+func (g *Guard) Check(ctx context.Context, accountKey string, ip string) (time.Duration, error) {
+	keys := []string{accountKey}
+	if ip != "" {
+		keys = append(keys, IPKey(ip))
+	}
+
+	lockedUntil, err := g.store.LockedUntil(ctx, keys...)
+	if err != nil || lockedUntil.IsZero() {
+		return 0, err
+	}
+
+	if retry := time.Until(lockedUntil); retry > 0 {
+		return retry, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt of the account key and of the ip, and locks
+// the ones over their threshold. It returns the lock of the account key
+func (g *Guard) Fail(ctx context.Context, accountKey string, ip string) (time.Duration, error) {
+	delay, err := g.fail(ctx, accountKey, g.account)
+	if err != nil {
+		return 0, err
+	}
+
+	if ip != "" {
+		if _, err = g.fail(ctx, IPKey(ip), g.ip); err != nil {
+			return delay, err
+		}
+	}
+
+	return delay, nil
+}
+
+func (g *Guard) fail(ctx context.Context, key string, policy Policy) (time.Duration, error) {
+	failures, err := g.store.RecordFailure(ctx, key, policy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := policy.Delay(failures)
+	if delay > 0 {
+		if err = g.store.Lock(ctx, key, time.Now().Add(delay)); err != nil {
+			return 0, err
+		}
+	}
+	return delay, nil
+}
+
+// Succeed forgets the failures of the account key, the ip counter isn't reset
+// so a client owning one account can't clear its sprays on the others
+func (g *Guard) Succeed(ctx context.Context, accountKey string) error {
+	return g.store.Reset(ctx, accountKey)
+}
+
+// Unlock removes the failures and the locks of the keys
+func (g *Guard) Unlock(ctx context.Context, keys ...string) error {
+	return g.store.Reset(ctx, keys...)
+}
+
+// Purge drops the counters that can't lock anymore
+func (g *Guard) Purge(ctx context.Context) error {
+	return g.store.Purge(ctx, max(g.account.Window, g.ip.Window))
+}
@@ -0,0 +1,75 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Store keeps the failed attempts and the locks of the login keys
+type Store interface {
+	// RecordFailure counts a failed attempt of the key, failures older than
+	// the window are forgotten. It returns the failures in the window
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock rejects the key until the given time, a longer lock is kept
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns the end of the longest active lock of the keys, the
+	// zero time when none is locked
+	LockedUntil(ctx context.Context, keys ...string) (time.Time, error)
+	// Reset forgets the failures and the locks of the keys
+	Reset(ctx context.Context, keys ...string) error
+	// Purge drops the keys without failure in the window and no active lock
+	Purge(ctx context.Context, window time.Duration) error
+}
+
+type PostgresStore struct {
+	queries *sqlc.Queries
+}
+
+func NewPostgresStore(qrs *sqlc.Queries) Store {
+	return &PostgresStore{
+		queries: qrs,
+	}
+}
+
+func (ps *PostgresStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	failures, err := ps.queries.RecordLoginFailure(ctx, sqlc.RecordLoginFailureParams{
+		Key: key,
+		WindowStart: pgtype.Timestamptz{
+			Time:  time.Now().Add(-window),
+			Valid: true,
+		},
+	})
+	return int(failures), err
+}
+
+func (ps *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return ps.queries.LockLoginKey(ctx, sqlc.LockLoginKeyParams{
+		Key: key,
+		LockedUntil: pgtype.Timestamptz{
+			Time:  until,
+			Valid: true,
+		},
+	})
+}
+
+func (ps *PostgresStore) LockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	lockedUntil, err := ps.queries.GetLoginLock(ctx, keys)
+	if err != nil || !lockedUntil.Valid {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+func (ps *PostgresStore) Reset(ctx context.Context, keys ...string) error {
+	return ps.queries.ResetLoginAttempts(ctx, keys)
+}
+
+func (ps *PostgresStore) Purge(ctx context.Context, window time.Duration) error {
+	return ps.queries.DeleteStaleLoginAttempts(ctx, pgtype.Timestamptz{
+		Time:  time.Now().Add(-window),
+		Valid: true,
+	})
+}
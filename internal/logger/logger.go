@@ -8,7 +8,8 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var logger *zap.Logger
+// nop until Init, packages can log before (commands, tests)
+var logger = zap.NewNop()
 
 // Init initializes the global logger with file rotation and JSON formatting.
 func Init() {
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes every email as an .eml file, used for local development
+type FileSender struct {
+	dir  string
+	from string
+}
+
+func NewFileSender(dir, from string) (Sender, error) {
+	if dir == "" {
+		dir = "./mails"
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("could not create mail dir: %w", err)
+	}
+
+	return &FileSender{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (fs *FileSender) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return os.WriteFile(filepath.Join(fs.dir, name), buildMessage(fs.from, msg), 0o640)
+}
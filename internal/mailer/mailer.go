@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BigBr41n/echoAuth/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails, implementations are picked with the MAILER env var
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New builds the sender configured in the app config (smtp, file or memory),
+// there is no default: a server must not write its reset links to disk
+// because MAILER was forgotten
+func New() (Sender, error) {
+	switch config.AppConfig.Mailer {
+	case "smtp":
+		return NewSMTPSender(
+			config.AppConfig.SMTPHost,
+			config.AppConfig.SMTPPort,
+			config.AppConfig.SMTPUser,
+			config.AppConfig.SMTPPassword,
+			config.AppConfig.MailFrom,
+		), nil
+	case "file":
+		return NewFileSender(config.AppConfig.MailDir, config.AppConfig.MailFrom)
+	case "memory":
+		return NewMemorySender(), nil
+	case "":
+		return nil, errors.New("MAILER is not set (smtp, file or memory)")
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", config.AppConfig.Mailer)
+	}
+}
@@ -0,0 +1,118 @@
+package mfapolicy
+
+import (
+	"slices"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+)
+
+// Level is the sensitivity of a route
+type Level int
+
+const (
+	// routes of the account, only the role and the session age count
+	Standard Level = iota
+	// routes changing the account or its access, they need a recent login
+	Sensitive
+)
+
+// authentication methods (RFC 8176) and levels the policy reads in the claims
+const (
+	MethodOTP = "otp"
+	MethodMFA = "mfa"
+
+	ACRSingleFactor = "aal1"
+	ACRMultiFactor  = "aal2"
+)
+
+// decision codes, a step up is answered with a totp on /auth/step-up, a
+// reauthentication with a new login. A step up asked from a user without
+// the authenticator app becomes an enrollment on /auth/2FA/setup
+const (
+	StepUpRequired           = "STEP_UP_REQUIRED"
+	ReauthenticationRequired = "REAUTHENTICATION_REQUIRED"
+	TOTPEnrollmentRequired   = "TOTP_ENROLLMENT_REQUIRED"
+)
+
+// Policy decides what the login behind an access token must have been for a
+// route
+type Policy struct {
+	// roles that must log in with a totp
+	TOTPRoles []string
+	// max age of the login for every route, 0 for no limit
+	SessionMaxAge time.Duration
+	// max age of the login for the sensitive routes
+	SensitiveMaxAge time.Duration
+}
+
+// New builds the policy of the app config
+func New() *Policy {
+	cfg := config.AppConfig
+	return &Policy{
+		TOTPRoles:       cfg.MFARequiredRoles,
+		SessionMaxAge:   cfg.MFASessionMaxAge,
+		SensitiveMaxAge: cfg.StepUpMaxAge,
+	}
+}
+
+// Requirement is what a route asks from the login
+type Requirement struct {
+	// method the login must include, empty for any
+	Method string
+	// max age of the login, 0 for no limit
+	MaxAge time.Duration
+}
+
+// ACR returns the level of the requirement
+func (r Requirement) ACR() string {
+	if r.Method != "" {
+		return ACRMultiFactor
+	}
+	return ACRSingleFactor
+}
+
+// Require returns the requirement of a route for the role
+func (p *Policy) Require(role string, level Level) Requirement {
+	req := Requirement{MaxAge: p.SessionMaxAge}
+	if slices.Contains(p.TOTPRoles, role) {
+		req.Method = MethodOTP
+	}
+	if level == Sensitive && p.SensitiveMaxAge > 0 &&
+		(req.MaxAge == 0 || p.SensitiveMaxAge < req.MaxAge) {
+		req.MaxAge = p.SensitiveMaxAge
+	}
+	return req
+}
+
+// Decision is the answer of the policy for a token
+type Decision struct {
+	Allowed bool
+	// StepUpRequired or ReauthenticationRequired when refused
+	Code        string
+	Requirement Requirement
+}
+
+// Evaluate checks the methods and the time of the login against the route.
+// A step up (fresh totp) is asked when it can meet the requirement: the role
+// needs a totp or the user logged in with one, the others log in again
+func (p *Policy) Evaluate(role string, level Level, amr []string, authTime time.Time, now time.Time) Decision {
+	req := p.Require(role, level)
+	decision := Decision{Allowed: true, Requirement: req}
+
+	met := req.Method == "" || slices.Contains(amr, req.Method)
+	// tokens issued before the login time was tracked are as old as it gets
+	if req.MaxAge > 0 && (authTime.IsZero() || now.Sub(authTime) > req.MaxAge) {
+		met = false
+	}
+	if met {
+		return decision
+	}
+
+	decision.Allowed = false
+	decision.Code = ReauthenticationRequired
+	if req.Method == MethodOTP || slices.Contains(amr, MethodOTP) {
+		decision.Code = StepUpRequired
+	}
+	return decision
+}
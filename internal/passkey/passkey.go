@@ -0,0 +1,38 @@
+package passkey
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ChallengeTTL is the time left to the user to answer the authenticator, the
+// challenges are refused once expired
+const ChallengeTTL = 5 * time.Minute
+
+// New builds the webauthn relying party from WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME
+// and WEBAUTHN_ORIGINS
+func New() (*webauthn.WebAuthn, error) {
+	cfg := config.AppConfig
+	if cfg.WebAuthnRPID == "" || len(cfg.WebAuthnOrigins) == 0 {
+		return nil, fmt.Errorf("passkey: WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS (or APP_URL) must be set")
+	}
+
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    ChallengeTTL,
+		TimeoutUVD: ChallengeTTL,
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
@@ -0,0 +1,90 @@
+package principal
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// Kind tells who is behind an access token
+type Kind string
+
+const (
+	// a user logged in the first party app
+	Human Kind = "human"
+	// a service account authenticated with the client credentials grant
+	Service Kind = "service"
+)
+
+// RoleService is the role carried by the tokens of the service accounts
+const RoleService = "service"
+
+// scopes opening the admin routes to a service account, the admin role of the
+// humans doesn't grant them
+const (
+	ScopeAdminLockouts        = "admin:lockouts"
+	ScopeAdminServiceAccounts = "admin:service-accounts"
+)
+
+// context key set by the jwt middleware
+const contextKey = "Principal"
+
+// Principal is the caller of an authenticated request
+type Principal struct {
+	Kind Kind
+	// user id for a human, client id for a service
+	ID     string
+	UserID pgtype.UUID
+	// service account, empty for a human
+	ClientID string
+	Role     string
+	Scopes   []string
+}
+
+// FromClaims builds the principal of an access token, the tokens of a service
+// account have a client id and no user
+func FromClaims(claims *jwtImpl.CustomAccessTokenClaims) *Principal {
+	p := &Principal{
+		Kind:     Human,
+		ID:       claims.UserID.String(),
+		UserID:   claims.UserID,
+		ClientID: claims.ClientID,
+		Role:     claims.Role,
+		Scopes:   strings.Fields(claims.Scope),
+	}
+	if !claims.UserID.Valid && claims.ClientID != "" {
+		p.Kind = Service
+		p.ID = claims.ClientID
+	}
+	return p
+}
+
+func (p *Principal) IsHuman() bool {
+	return p.Kind == Human
+}
+
+func (p *Principal) IsService() bool {
+	return p.Kind == Service
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// String identifies the principal in the logs and the audit events
+func (p *Principal) String() string {
+	return string(p.Kind) + ":" + p.ID
+}
+
+func Set(c echo.Context, p *Principal) {
+	c.Set(contextKey, p)
+}
+
+// FromContext returns the principal set by the jwt middleware
+func FromContext(c echo.Context) (*Principal, bool) {
+	p, ok := c.Get(contextKey).(*Principal)
+	return p, ok
+}
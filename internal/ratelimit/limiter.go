@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Rule allows Limit requests per Window, the name keeps the counters of two
+// rules apart when they share a key
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// Result is the state of the key after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until the quota is replenished (the current window ends for the
+	// sliding window)
+	ResetAfter time.Duration
+	// time until the next request is allowed, set when denied
+	RetryAfter time.Duration
+}
+
+// Limiter counts the requests of a key against a rule, implementations are
+// picked with the RATE_LIMIT_BACKEND env var
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (*Result, error)
+}
+
+// New builds the limiter configured in the app config (memory or redis)
+func New() (Limiter, error) {
+	switch config.AppConfig.RateLimitBackend {
+	case "memory", "":
+		return NewMemoryLimiter(), nil
+	case "redis":
+		opts, err := redis.ParseURL(config.AppConfig.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		return NewRedisLimiter(redis.NewClient(opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", config.AppConfig.RateLimitBackend)
+	}
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// idle buckets are dropped after this delay, a bucket idle for a whole window
+// is full anyway
+const memoryCleanupInterval = time.Minute
+
+// MemoryLimiter is a token bucket per key kept in the process, counters aren't
+// shared between instances
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	ml := &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+	}
+	go ml.cleanup()
+	return ml
+}
+
+// Allow takes a token from the bucket of the key, the bucket holds Limit
+// tokens and refills at Limit per Window
+func (ml *MemoryLimiter) Allow(ctx context.Context, key string, rule Rule) (*Result, error) {
+	now := time.Now()
+	limit := float64(rule.Limit)
+	// tokens added per second
+	rate := limit / rule.Window.Seconds()
+
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	id := rule.Name + ":" + key
+	b, ok := ml.buckets[id]
+	if !ok {
+		b = &bucket{tokens: limit, last: now, window: rule.Window}
+		ml.buckets[id] = b
+	}
+
+	b.tokens = math.Min(limit, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := &Result{Limit: rule.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = seconds((limit - b.tokens) / rate)
+	return res, nil
+}
+
+func (ml *MemoryLimiter) cleanup() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		ml.mu.Lock()
+		for id, b := range ml.buckets {
+			if now.Sub(b.last) > b.window {
+				delete(ml.buckets, id)
+			}
+		}
+		ml.mu.Unlock()
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
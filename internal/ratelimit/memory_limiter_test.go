@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiterDeniesOverLimit(t *testing.T) {
+	ml := NewMemoryLimiter()
+	ctx := context.Background()
+	rule := Rule{Name: "test", Limit: 3, Window: time.Minute}
+
+	for i := range 3 {
+		res, err := ml.Allow(ctx, "k", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed {
+			t.Fatalf("request %d denied under the limit", i)
+		}
+		if want := 3 - (i + 1); res.Remaining != want {
+			t.Errorf("request %d: remaining %d, want %d", i, res.Remaining, want)
+		}
+	}
+
+	res, _ := ml.Allow(ctx, "k", rule)
+	if res.Allowed {
+		t.Fatal("request over the limit allowed")
+	}
+	// one token comes back every window / limit
+	if res.RetryAfter <= 0 || res.RetryAfter > rule.Window/3 {
+		t.Errorf("retry after %s, want up to %s", res.RetryAfter, rule.Window/3)
+	}
+	if res.ResetAfter <= 0 || res.ResetAfter > rule.Window {
+		t.Errorf("reset after %s out of the window", res.ResetAfter)
+	}
+}
+
+func TestMemoryLimiterRefillsOverTheWindow(t *testing.T) {
+	ml := NewMemoryLimiter()
+	ctx := context.Background()
+	rule := Rule{Name: "test", Limit: 2, Window: 100 * time.Millisecond}
+
+	for range 2 {
+		ml.Allow(ctx, "k", rule)
+	}
+	if res, _ := ml.Allow(ctx, "k", rule); res.Allowed {
+		t.Fatal("request over the limit allowed")
+	}
+
+	time.Sleep(rule.Window)
+
+	res, _ := ml.Allow(ctx, "k", rule)
+	if !res.Allowed {
+		t.Fatal("request denied once the bucket refilled")
+	}
+	if res.Remaining != 1 {
+		t.Errorf("remaining %d, want 1", res.Remaining)
+	}
+}
+
+func TestMemoryLimiterKeepsKeysAndRulesApart(t *testing.T) {
+	ml := NewMemoryLimiter()
+	ctx := context.Background()
+	rule := Rule{Name: "auth", Limit: 1, Window: time.Minute}
+
+	ml.Allow(ctx, "a", rule)
+	if res, _ := ml.Allow(ctx, "b", rule); !res.Allowed {
+		t.Error("another key shares the bucket")
+	}
+	if res, _ := ml.Allow(ctx, "a", Rule{Name: "user", Limit: 1, Window: time.Minute}); !res.Allowed {
+		t.Error("another rule shares the bucket")
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindow counts the requests of the current fixed window and weights
+// the previous one by the part of it still inside the sliding window. The check
+// and the increment run in one script so concurrent requests can't overshoot
+var slidingWindow = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local used = math.floor(previous * (window - elapsed) / window) + current
+
+if used >= limit then
+	return {0, used}
+end
+
+if redis.call("INCR", KEYS[1]) == 1 then
+	redis.call("PEXPIRE", KEYS[1], window * 2)
+end
+return {1, used + 1}
+`)
+
+// RedisLimiter is a sliding window per key kept in redis (or any server
+// speaking its protocol), counters are shared by every instance
+type RedisLimiter struct {
+	client redis.Scripter
+}
+
+func NewRedisLimiter(client redis.Scripter) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+	}
+}
+
+func (rl *RedisLimiter) Allow(ctx context.Context, key string, rule Rule) (*Result, error) {
+	window := max(rule.Window.Milliseconds(), 1)
+	now := time.Now().UnixMilli()
+	index := now / window
+	elapsed := now % window
+
+	prefix := "ratelimit:" + rule.Name + ":" + key + ":"
+	keys := []string{
+		prefix + strconv.FormatInt(index, 10),
+		prefix + strconv.FormatInt(index-1, 10),
+	}
+
+	vals, err := slidingWindow.Run(ctx, rl.client, keys, rule.Limit, window, elapsed).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	// the previous window stops counting once the current one ends
+	untilNext := time.Duration(window-elapsed) * time.Millisecond
+	res := &Result{
+		Allowed:    vals[0] == 1,
+		Limit:      rule.Limit,
+		Remaining:  max(rule.Limit-int(vals[1]), 0),
+		ResetAfter: untilNext,
+	}
+	if !res.Allowed {
+		res.RetryAfter = untilNext
+	}
+	return res, nil
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisLimiter runs the limiter against an in process redis
+func newTestRedisLimiter(t *testing.T) (*RedisLimiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisLimiter(client), srv
+}
+
+func TestRedisLimiterDeniesOverLimit(t *testing.T) {
+	rl, _ := newTestRedisLimiter(t)
+	ctx := context.Background()
+	rule := Rule{Name: "test", Limit: 3, Window: time.Minute}
+
+	for i := range 3 {
+		res, err := rl.Allow(ctx, "ip:1.2.3.4", rule)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if !res.Allowed {
+			t.Fatalf("request %d denied under the limit", i)
+		}
+		if want := 3 - (i + 1); res.Remaining != want {
+			t.Errorf("request %d: remaining %d, want %d", i, res.Remaining, want)
+		}
+	}
+
+	res, err := rl.Allow(ctx, "ip:1.2.3.4", rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed {
+		t.Fatal("request over the limit allowed")
+	}
+	if res.Remaining != 0 {
+		t.Errorf("remaining %d, want 0", res.Remaining)
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > rule.Window {
+		t.Errorf("retry after %s out of the window", res.RetryAfter)
+	}
+}
+
+func TestRedisLimiterKeepsKeysAndRulesApart(t *testing.T) {
+	rl, _ := newTestRedisLimiter(t)
+	ctx := context.Background()
+	rule := Rule{Name: "auth", Limit: 1, Window: time.Minute}
+
+	if res, _ := rl.Allow(ctx, "ip:1.1.1.1", rule); !res.Allowed {
+		t.Fatal("first request denied")
+	}
+	if res, _ := rl.Allow(ctx, "ip:1.1.1.1", rule); res.Allowed {
+		t.Fatal("second request of the key allowed")
+	}
+	if res, _ := rl.Allow(ctx, "ip:2.2.2.2", rule); !res.Allowed {
+		t.Error("another key shares the counter")
+	}
+	other := Rule{Name: "user", Limit: 1, Window: time.Minute}
+	if res, _ := rl.Allow(ctx, "ip:1.1.1.1", other); !res.Allowed {
+		t.Error("another rule shares the counter")
+	}
+}
+
+func TestRedisLimiterWindowSlides(t *testing.T) {
+	rl, _ := newTestRedisLimiter(t)
+	ctx := context.Background()
+	rule := Rule{Name: "test", Limit: 2, Window: 100 * time.Millisecond}
+
+	for range 2 {
+		if res, _ := rl.Allow(ctx, "k", rule); !res.Allowed {
+			t.Fatal("request denied under the limit")
+		}
+	}
+	if res, _ := rl.Allow(ctx, "k", rule); res.Allowed {
+		t.Fatal("request over the limit allowed")
+	}
+
+	// two windows later neither the current nor the previous one counts
+	time.Sleep(2 * rule.Window)
+
+	res, err := rl.Allow(ctx, "k", rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed {
+		t.Error("request denied once the window passed")
+	}
+}
+
+func TestRedisLimiterExpiresCounters(t *testing.T) {
+	rl, srv := newTestRedisLimiter(t)
+	rule := Rule{Name: "test", Limit: 5, Window: time.Minute}
+
+	if _, err := rl.Allow(context.Background(), "k", rule); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := srv.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("got keys %v, want one counter", keys)
+	}
+	// the counter outlives its window to weight the next one, not more
+	if ttl := srv.TTL(keys[0]); ttl <= 0 || ttl > 2*rule.Window {
+		t.Errorf("counter ttl %s, want up to two windows", ttl)
+	}
+}
+
+func TestRedisLimiterReportsBackendErrors(t *testing.T) {
+	rl, srv := newTestRedisLimiter(t)
+	srv.Close()
+
+	if _, err := rl.Allow(context.Background(), "k", Rule{Name: "test", Limit: 1, Window: time.Minute}); err == nil {
+		t.Error("no error with the backend down")
+	}
+}
@@ -0,0 +1,83 @@
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Store keeps track of access tokens that must be rejected before they expire
+type Store interface {
+	// RevokeToken rejects a single access token by its jti
+	RevokeToken(ctx context.Context, jti string, userID pgtype.UUID, expiresAt time.Time) error
+	// RevokeAllForUser rejects every access token of the user issued before now
+	RevokeAllForUser(ctx context.Context, userID pgtype.UUID) error
+	// IsRevoked reports if the access token, its session or its oauth client
+	// was revoked
+	IsRevoked(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) (bool, error)
+	// Purge drops revocations of tokens that are expired anyway
+	Purge(ctx context.Context) error
+}
+
+type PostgresStore struct {
+	queries *sqlc.Queries
+}
+
+func NewPostgresStore(qrs *sqlc.Queries) Store {
+	return &PostgresStore{
+		queries: qrs,
+	}
+}
+
+// a token without jti can't be told apart from the others, its session and
+// version revoke it
+func (ps *PostgresStore) RevokeToken(ctx context.Context, jti string, userID pgtype.UUID, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	return ps.queries.RevokeAccessToken(ctx, sqlc.RevokeAccessTokenParams{
+		Jti:    jti,
+		UserID: userID,
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  expiresAt,
+			Valid: true,
+		},
+	})
+}
+
+func (ps *PostgresStore) RevokeAllForUser(ctx context.Context, userID pgtype.UUID) error {
+	// iat has a one second precision, tokens issued in the current second stay valid
+	return ps.queries.RevokeUserTokensBefore(ctx, sqlc.RevokeUserTokensBeforeParams{
+		UserID: userID,
+		RevokedBefore: pgtype.Timestamptz{
+			Time:  time.Now().Truncate(time.Second),
+			Valid: true,
+		},
+	})
+}
+
+func (ps *PostgresStore) IsRevoked(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	return ps.queries.IsAccessTokenRevoked(ctx, sqlc.IsAccessTokenRevokedParams{
+		Jti:    claims.ID,
+		UserID: claims.UserID,
+		IssuedAt: pgtype.Timestamptz{
+			Time:  issuedAt,
+			Valid: true,
+		},
+		SessionID:    claims.SessionID,
+		TokenVersion: claims.TokenVersion,
+		ClientID:     claims.ClientID,
+	})
+}
+
+func (ps *PostgresStore) Purge(ctx context.Context) error {
+	return ps.queries.DeleteExpiredRevokedTokens(ctx)
+}
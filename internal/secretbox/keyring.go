@@ -0,0 +1,140 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix of the encrypted values, the full format is enc:<keyID>:<base64 nonce+ciphertext>
+const prefix = "enc:"
+
+// KeySize is the size of an AES-256 key
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("secretbox: unknown key id")
+
+// Keyring encrypts with the active key and decrypts with any known key, so the
+// active key can change while older values are still readable
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from raw AES-256 keys indexed by key id, an
+// empty active id leaves the values in plaintext
+func NewKeyring(keys map[string][]byte, active string) (*Keyring, error) {
+	kr := &Keyring{
+		active: active,
+		keys:   make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("secretbox: invalid key id %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("secretbox: key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys[id] = aead
+	}
+
+	if active != "" {
+		if _, ok := kr.keys[active]; !ok {
+			return nil, fmt.Errorf("secretbox: active key %q is not loaded", active)
+		}
+	}
+
+	return kr, nil
+}
+
+// Enabled reports if new values are encrypted
+func (kr *Keyring) Enabled() bool {
+	return kr.active != ""
+}
+
+// ActiveKeyID returns the id of the key new values are encrypted with
+func (kr *Keyring) ActiveKeyID() string {
+	return kr.active
+}
+
+// Encrypt seals the value with the active key, aad binds the value to its
+// owner so it can't be copied to another row
+func (kr *Keyring) Encrypt(plaintext string, aad []byte) (string, error) {
+	if !kr.Enabled() {
+		return plaintext, nil
+	}
+
+	aead := kr.keys[kr.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), aad)
+	return prefix + kr.active + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt, values stored before encryption
+// was enabled are returned as they are
+func (kr *Keyring) Decrypt(value string, aad []byte) (string, error) {
+	keyID, payload, encrypted := parse(value)
+	if !encrypted {
+		return value, nil
+	}
+
+	aead, ok := kr.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("secretbox: malformed value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("secretbox: malformed value")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("secretbox: decryption failed with key %q: %w", keyID, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports if the value isn't sealed with the active key
+func (kr *Keyring) NeedsRotation(value string) bool {
+	if !kr.Enabled() {
+		return false
+	}
+	keyID, _, encrypted := parse(value)
+	return !encrypted || keyID != kr.active
+}
+
+// parse splits an encrypted value into its key id and payload
+func parse(value string) (string, string, bool) {
+	if !strings.HasPrefix(value, prefix) {
+		return "", "", false
+	}
+	keyID, payload, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", "", false
+	}
+	return keyID, payload, true
+}
@@ -0,0 +1,67 @@
+package secretbox
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BigBr41n/echoAuth/config"
+)
+
+// keyFileExt is the extension of the key files, the file name is the key id
+const keyFileExt = ".key"
+
+// New loads the keys listed in TOTP_ENC_KEYS (id:base64key,...) and the
+// <id>.key files of TOTP_ENC_KEY_DIR, TOTP_ENC_ACTIVE_KEY picks the key used
+// to encrypt
+func New() (*Keyring, error) {
+	keys := make(map[string][]byte)
+
+	for _, entry := range strings.Split(config.AppConfig.TOTPEncKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("secretbox: TOTP_ENC_KEYS entry must be id:base64key")
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("secretbox: key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	if dir := config.AppConfig.TOTPEncKeyDir; dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			id := strings.TrimSuffix(filepath.Base(file), keyFileExt)
+			key, err := decodeKey(string(raw))
+			if err != nil {
+				return nil, fmt.Errorf("secretbox: key file %s: %w", file, err)
+			}
+			keys[id] = key
+		}
+	}
+
+	return NewKeyring(keys, config.AppConfig.TOTPEncActiveKey)
+}
+
+// decodeKey accepts the standard and url base64 alphabets
+func decodeKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+}
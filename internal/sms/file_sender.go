@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes every message as a .txt file, used for local development
+type FileSender struct {
+	dir string
+}
+
+func NewFileSender(dir string) (SMSSender, error) {
+	if dir == "" {
+		dir = "./sms"
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("could not create sms dir: %w", err)
+	}
+
+	return &FileSender{
+		dir: dir,
+	}, nil
+}
+
+func (fs *FileSender) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.txt", time.Now().UnixNano())
+	content := "To: " + msg.To + "\n\n" + msg.Body + "\n"
+	return os.WriteFile(filepath.Join(fs.dir, name), []byte(content), 0o640)
+}
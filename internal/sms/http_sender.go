@@ -0,0 +1,79 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPSender posts the messages to the api of an sms provider (or a gateway
+// in front of it) as {"from", "to", "body"}, any 2xx answer is a success
+type HTTPSender struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+func NewHTTPSender(endpoint, token, from string) (SMSSender, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("SMS_HTTP_URL must be an http(s) url")
+	}
+
+	return &HTTPSender{
+		url:   endpoint,
+		token: token,
+		from:  from,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+type httpMessage struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+func (hs *HTTPSender) Send(ctx context.Context, msg *Message) error {
+	payload, err := json.Marshal(&httpMessage{
+		From: hs.from,
+		To:   msg.To,
+		Body: msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hs.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hs.token != "" {
+		req.Header.Set("Authorization", "Bearer "+hs.token)
+	}
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send sms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// a short part of the answer helps to understand the refusal
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms provider answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	// drained so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
@@ -0,0 +1,113 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPSenderPostsTheMessage(t *testing.T) {
+	var got httpMessage
+	var auth, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method %s, want POST", r.Method)
+		}
+		auth = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	sender, err := NewHTTPSender(srv.URL, "secret-token", "EchoAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(context.Background(), &Message{To: "+33612345678", Body: "Your code is 123456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := httpMessage{From: "EchoAuth", To: "+33612345678", Body: "Your code is 123456"}
+	if got != want {
+		t.Errorf("payload %+v, want %+v", got, want)
+	}
+	if auth != "Bearer secret-token" {
+		t.Errorf("Authorization %q, want the bearer token", auth)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type %q, want application/json", contentType)
+	}
+}
+
+func TestHTTPSenderWithoutToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization %q sent without token", auth)
+		}
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		if _, ok := payload["from"]; ok {
+			t.Error("empty sender sent")
+		}
+	}))
+	defer srv.Close()
+
+	sender, err := NewHTTPSender(srv.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(context.Background(), &Message{To: "+33612345678", Body: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPSenderFailsOnRefusal(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "number blocked", status)
+		}))
+
+		sender, err := NewHTTPSender(srv.URL, "token", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sender.Send(context.Background(), &Message{To: "+33612345678", Body: "hi"})
+		srv.Close()
+
+		if err == nil {
+			t.Errorf("status %d: no error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), "number blocked") {
+			t.Errorf("status %d: error %q without the answer of the provider", status, err)
+		}
+	}
+}
+
+func TestHTTPSenderFailsWhenUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	sender, err := NewHTTPSender(srv.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(context.Background(), &Message{To: "+33612345678", Body: "hi"}); err == nil {
+		t.Error("no error with the provider down")
+	}
+}
+
+func TestNewHTTPSenderRejectsInvalidURLs(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:8080", "ftp://sms.example.com", "https://"} {
+		if _, err := NewHTTPSender(endpoint, "", ""); err == nil {
+			t.Errorf("%q accepted", endpoint)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sms
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySender keeps the messages in memory, used by tests
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (ms *MemorySender) Send(ctx context.Context, msg *Message) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.messages = append(ms.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far
+func (ms *MemorySender) Messages() []Message {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return append([]Message(nil), ms.messages...)
+}
+
+// Last returns the last message sent to the number
+func (ms *MemorySender) Last(to string) (Message, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i := len(ms.messages) - 1; i >= 0; i-- {
+		if ms.messages[i].To == to {
+			return ms.messages[i], true
+		}
+	}
+	return Message{}, false
+}
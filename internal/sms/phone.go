@@ -0,0 +1,54 @@
+package sms
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// NormalizeE164 turns a phone number typed by a user into the E.164 format
+// (+ followed by up to 15 digits). Spaces, dots, dashes and parentheses are
+// dropped, the 00 international prefix is accepted, a number without prefix
+// gets the default country code once its trunk 0 is removed
+func NormalizeE164(raw string, defaultCountryCode string) (string, error) {
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+
+	switch {
+	case strings.HasPrefix(number, "+"):
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case defaultCountryCode != "":
+		number = defaultCountryCode + strings.TrimPrefix(number, "0")
+	default:
+		return "", ErrInvalidPhoneNumber
+	}
+
+	// country codes don't start with 0, the shortest numbers have 7 digits
+	if len(number) < 7 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhoneNumber
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+
+	return "+" + number, nil
+}
+
+// Mask hides the middle of a number, enough is left for the user to
+// recognize it
+func Mask(number string) string {
+	if len(number) <= 6 {
+		return number
+	}
+	return number[:3] + strings.Repeat("*", len(number)-5) + number[len(number)-2:]
+}
@@ -0,0 +1,81 @@
+package sms
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeE164(t *testing.T) {
+	for _, tc := range []struct {
+		raw            string
+		defaultCountry string
+		want           string
+	}{
+		{"+33612345678", "", "+33612345678"},
+		{"+33 6 12 34 56 78", "", "+33612345678"},
+		{"+1 (415) 555-2671", "", "+14155552671"},
+		{"+44.20.7946.0958", "", "+442079460958"},
+		{"0033612345678", "", "+33612345678"},
+		{"00 1 415 555 2671", "", "+14155552671"},
+		// national numbers lose their trunk 0 and get the default country
+		{"06 12 34 56 78", "33", "+33612345678"},
+		{"612345678", "33", "+33612345678"},
+		// an international number keeps its own country
+		{"+14155552671", "33", "+14155552671"},
+		{"  +33612345678\t", "", "+33612345678"},
+		// shortest and longest lengths
+		{"+1234567", "", "+1234567"},
+		{"+123456789012345", "", "+123456789012345"},
+	} {
+		got, err := NormalizeE164(tc.raw, tc.defaultCountry)
+		if err != nil {
+			t.Errorf("%q (default %q): %v", tc.raw, tc.defaultCountry, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q (default %q) = %q, want %q", tc.raw, tc.defaultCountry, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeE164Rejects(t *testing.T) {
+	for _, tc := range []struct {
+		raw            string
+		defaultCountry string
+	}{
+		{"", ""},
+		{"", "33"},
+		// no prefix and no default country
+		{"0612345678", ""},
+		// too short, too long
+		{"+123456", ""},
+		{"+1234567890123456", ""},
+		{"123", "33"},
+		// country codes don't start with 0
+		{"+0612345678", ""},
+		{"000612345678", ""},
+		// letters and symbols
+		{"+33 6 12 AB 56 78", ""},
+		{"+33#612345678", ""},
+		{"+33612345678;ext=1", ""},
+		{"++33612345678", ""},
+		{"+٣٣612345678", ""},
+	} {
+		got, err := NormalizeE164(tc.raw, tc.defaultCountry)
+		if !errors.Is(err, ErrInvalidPhoneNumber) {
+			t.Errorf("%q (default %q) = %q, %v; want ErrInvalidPhoneNumber", tc.raw, tc.defaultCountry, got, err)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	for raw, want := range map[string]string{
+		"+33612345678": "+33*******78",
+		"+1234567":     "+12***67",
+		"+12345":       "+12345",
+	} {
+		if got := Mask(raw); got != want {
+			t.Errorf("Mask(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
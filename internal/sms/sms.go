@@ -0,0 +1,43 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BigBr41n/echoAuth/config"
+)
+
+// Message is a text message, the number is in E.164 format
+type Message struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages, implementations are picked with the
+// SMS_PROVIDER env var
+type SMSSender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New builds the sender configured in the app config (http, file or memory),
+// like the mailer there is no default: the codes must not land on disk
+// because SMS_PROVIDER was forgotten
+func New() (SMSSender, error) {
+	switch config.AppConfig.SMSProvider {
+	case "http":
+		return NewHTTPSender(
+			config.AppConfig.SMSHTTPURL,
+			config.AppConfig.SMSHTTPToken,
+			config.AppConfig.SMSFrom,
+		)
+	case "file":
+		return NewFileSender(config.AppConfig.SMSDir)
+	case "memory":
+		return NewMemorySender(), nil
+	case "":
+		return nil, errors.New("SMS_PROVIDER is not set (http, file or memory)")
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", config.AppConfig.SMSProvider)
+	}
+}
@@ -0,0 +1,30 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/BigBr41n/echoAuth/config"
+)
+
+func TestNewNeedsAProvider(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+
+	for provider, ok := range map[string]bool{
+		"":       false,
+		"memory": true,
+		"file":   true,
+		"smpp":   false,
+	} {
+		config.AppConfig.SMSProvider = provider
+		config.AppConfig.SMSDir = t.TempDir()
+
+		_, err := New()
+		if ok && err != nil {
+			t.Errorf("SMS_PROVIDER=%q: %v", provider, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("SMS_PROVIDER=%q accepted", provider)
+		}
+	}
+}
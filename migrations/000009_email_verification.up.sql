@@ -0,0 +1,6 @@
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- accounts created before the verification flow are trusted
+UPDATE users
+SET email_verified_at = created_at;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+DROP COLUMN totp_pending_secret;
\ No newline at end of file
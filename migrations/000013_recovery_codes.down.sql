@@ -0,0 +1 @@
+DROP TABLE recovery_codes;
\ No newline at end of file
@@ -0,0 +1,10 @@
+DROP TABLE oauth_consents;
+DROP TABLE oauth_authorizations;
+
+ALTER TABLE sessions
+    DROP COLUMN scope,
+    DROP COLUMN client_id;
+
+ALTER TABLE oauth_clients
+    DROP COLUMN public,
+    DROP COLUMN redirect_uris;
\ No newline at end of file
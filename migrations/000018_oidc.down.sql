@@ -0,0 +1,8 @@
+ALTER TABLE oauth_authorizations
+    DROP COLUMN auth_time,
+    DROP COLUMN amr,
+    DROP COLUMN nonce;
+
+ALTER TABLE sessions
+    DROP COLUMN auth_time,
+    DROP COLUMN amr;
\ No newline at end of file
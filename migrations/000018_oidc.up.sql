@@ -0,0 +1,8 @@
+ALTER TABLE sessions
+    ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN auth_time TIMESTAMPTZ;
+
+ALTER TABLE oauth_authorizations
+    ADD COLUMN nonce TEXT NOT NULL DEFAULT '',
+    ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN auth_time TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE oauth_clients
+    DROP COLUMN created_by,
+    DROP COLUMN service_account;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN service_account BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN created_by UUID REFERENCES users(id) ON DELETE SET NULL;
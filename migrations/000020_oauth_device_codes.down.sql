@@ -0,0 +1,4 @@
+DROP TABLE oauth_device_codes;
+
+ALTER TABLE oauth_clients
+    DROP COLUMN device_grant;
\ No newline at end of file
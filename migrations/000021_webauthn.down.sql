@@ -0,0 +1,3 @@
+DROP TABLE webauthn_challenges;
+
+DROP TABLE webauthn_credentials;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE email_otp_codes;
+
+ALTER TABLE users
+    DROP COLUMN preferred_factor,
+    DROP COLUMN email_otp_enabled;
\ No newline at end of file
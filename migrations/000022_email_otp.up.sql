@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN email_otp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN preferred_factor TEXT;
+
+CREATE TABLE email_otp_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX email_otp_codes_user_id_idx ON email_otp_codes (user_id);
@@ -0,0 +1,5 @@
+DROP TABLE sms_otp_codes;
+
+ALTER TABLE users
+    DROP COLUMN sms_otp_enabled,
+    DROP COLUMN phone_number;
\ No newline at end of file
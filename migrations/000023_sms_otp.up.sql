@@ -0,0 +1,17 @@
+ALTER TABLE users
+    ADD COLUMN phone_number TEXT,
+    ADD COLUMN sms_otp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE sms_otp_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    phone_number TEXT NOT NULL,
+    purpose TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX sms_otp_codes_user_id_idx ON sms_otp_codes (user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE webauthn_challenges
+    DROP COLUMN amr;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE webauthn_challenges
+    ADD COLUMN amr TEXT[];
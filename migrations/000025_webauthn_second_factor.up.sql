@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN webauthn_second_factor BOOLEAN NOT NULL DEFAULT FALSE;
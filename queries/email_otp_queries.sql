@@ -0,0 +1,30 @@
+-- name: CreateEmailOTP :one
+INSERT INTO email_otp_codes (user_id, code_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetActiveEmailOTP :one
+SELECT *
+FROM email_otp_codes
+WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: DeleteEmailOTPs :exec
+DELETE FROM email_otp_codes
+WHERE user_id = $1;
+
+-- name: CountEmailOTPAttempt :one
+UPDATE email_otp_codes
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts;
+
+-- name: ConsumeEmailOTP :execrows
+UPDATE email_otp_codes
+SET consumed_at = NOW()
+WHERE id = $1 AND consumed_at IS NULL AND expires_at > NOW();
+
+-- name: DeleteExpiredEmailOTPs :exec
+DELETE FROM email_otp_codes
+WHERE expires_at < @expired_before::timestamptz;
@@ -0,0 +1,28 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (key, failures, last_failure_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < sqlc.arg(window_start)::timestamptz THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING failures;
+
+-- name: LockLoginKey :exec
+UPDATE login_attempts
+SET locked_until = GREATEST(locked_until, $2)
+WHERE key = $1;
+
+-- name: GetLoginLock :one
+SELECT MAX(locked_until)::timestamptz AS locked_until
+FROM login_attempts
+WHERE key = ANY(sqlc.arg(keys)::text[]) AND locked_until > NOW();
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = ANY(sqlc.arg(keys)::text[]);
+
+-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
@@ -0,0 +1,38 @@
+-- name: CreateAuthorization :one
+INSERT INTO oauth_authorizations (client_id, redirect_uri, scope, state, code_challenge, nonce, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetPendingAuthorization :one
+SELECT *
+FROM oauth_authorizations
+WHERE id = $1 AND approved_at IS NULL AND expires_at > NOW();
+
+-- name: ApproveAuthorization :execrows
+UPDATE oauth_authorizations
+SET user_id = $2, code_hash = $3, expires_at = $4, amr = $5, auth_time = $6, approved_at = NOW()
+WHERE id = $1 AND approved_at IS NULL AND expires_at > NOW();
+
+-- name: DeleteAuthorization :exec
+DELETE FROM oauth_authorizations
+WHERE id = $1 AND approved_at IS NULL;
+
+-- name: ConsumeAuthorizationCode :one
+UPDATE oauth_authorizations
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: GetAuthorizationByCodeHash :one
+SELECT *
+FROM oauth_authorizations
+WHERE code_hash = $1;
+
+-- name: SetAuthorizationSession :exec
+UPDATE oauth_authorizations
+SET session_id = $2
+WHERE id = $1;
+
+-- name: DeleteExpiredAuthorizations :exec
+DELETE FROM oauth_authorizations
+WHERE expires_at < @expired_before::timestamptz;
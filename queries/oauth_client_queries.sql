@@ -0,0 +1,36 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (client_id, name, secret_hash, scopes, redirect_uris, public, service_account, created_by, device_grant)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE client_id = $1 AND revoked_at IS NULL;
+
+-- name: ListOAuthClients :many
+SELECT *
+FROM oauth_clients
+ORDER BY created_at;
+
+-- name: RevokeOAuthClient :execrows
+UPDATE oauth_clients
+SET revoked_at = NOW()
+WHERE client_id = $1 AND revoked_at IS NULL;
+
+-- name: ListServiceAccounts :many
+SELECT *
+FROM oauth_clients
+WHERE service_account = TRUE
+ORDER BY created_at;
+
+-- name: RotateServiceAccountSecret :one
+UPDATE oauth_clients
+SET secret_hash = $2
+WHERE client_id = $1 AND service_account = TRUE AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeServiceAccount :execrows
+UPDATE oauth_clients
+SET revoked_at = NOW()
+WHERE client_id = $1 AND service_account = TRUE AND revoked_at IS NULL;
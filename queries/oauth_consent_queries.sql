@@ -0,0 +1,10 @@
+-- name: GetConsent :one
+SELECT *
+FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2;
+
+-- name: SaveConsent :exec
+INSERT INTO oauth_consents (user_id, client_id, scopes)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, client_id)
+DO UPDATE SET scopes = EXCLUDED.scopes, updated_at = NOW();
@@ -0,0 +1,33 @@
+-- name: CreateDeviceCode :one
+INSERT INTO oauth_device_codes (client_id, device_code_hash, user_code, scope, poll_interval, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetPendingDeviceCode :one
+SELECT *
+FROM oauth_device_codes
+WHERE user_code = $1 AND status = 'pending' AND expires_at > NOW();
+
+-- name: GetDeviceCodeByHash :one
+SELECT *
+FROM oauth_device_codes
+WHERE device_code_hash = $1;
+
+-- name: RecordDeviceCodePoll :exec
+UPDATE oauth_device_codes
+SET last_polled_at = NOW(), poll_interval = $2
+WHERE id = $1;
+
+-- name: DecideDeviceCode :execrows
+UPDATE oauth_device_codes
+SET status = $2, user_id = $3, amr = $4, auth_time = $5, decided_at = NOW()
+WHERE id = $1 AND status = 'pending' AND expires_at > NOW();
+
+-- name: ConsumeDeviceCode :execrows
+UPDATE oauth_device_codes
+SET consumed_at = NOW()
+WHERE id = $1 AND status = 'approved' AND consumed_at IS NULL;
+
+-- name: DeleteExpiredDeviceCodes :exec
+DELETE FROM oauth_device_codes
+WHERE expires_at < @expired_before::timestamptz;
@@ -0,0 +1,27 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_tokens (jti, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: RevokeUserTokensBefore :exec
+INSERT INTO user_token_revocations (user_id, revoked_before)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM revoked_tokens WHERE jti = @jti AND @jti <> ''
+) OR EXISTS (
+    SELECT 1 FROM user_token_revocations
+    WHERE user_id = @user_id AND revoked_before > @issued_at::timestamptz
+) OR EXISTS (
+    SELECT 1 FROM sessions WHERE id = @session_id AND revoked_at IS NOT NULL
+) OR EXISTS (
+    SELECT 1 FROM users WHERE id = @user_id AND token_version <> @token_version::int
+) OR EXISTS (
+    SELECT 1 FROM oauth_clients WHERE client_id = @client_id AND revoked_at IS NOT NULL
+) AS revoked;
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens
+WHERE expires_at < NOW();
@@ -0,0 +1,35 @@
+-- name: CreateSession :one
+INSERT INTO sessions (user_id, user_agent, ip, protocol, client_id, scope, amr, auth_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT *
+FROM sessions
+WHERE id = $1;
+
+-- name: ListUserSessions :many
+SELECT *
+FROM sessions
+WHERE user_id = @user_id AND revoked_at IS NULL AND last_seen_at > @active_since::timestamptz
+ORDER BY last_seen_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL AND last_seen_at < NOW() - INTERVAL '1 minute';
@@ -0,0 +1,30 @@
+-- name: CreateSMSOTP :one
+INSERT INTO sms_otp_codes (user_id, phone_number, purpose, code_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetActiveSMSOTP :one
+SELECT *
+FROM sms_otp_codes
+WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: DeleteSMSOTPs :exec
+DELETE FROM sms_otp_codes
+WHERE user_id = $1 AND purpose = $2;
+
+-- name: CountSMSOTPAttempt :one
+UPDATE sms_otp_codes
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts;
+
+-- name: ConsumeSMSOTP :execrows
+UPDATE sms_otp_codes
+SET consumed_at = NOW()
+WHERE id = $1 AND consumed_at IS NULL AND expires_at > NOW();
+
+-- name: DeleteExpiredSMSOTPs :exec
+DELETE FROM sms_otp_codes
+WHERE expires_at < @expired_before::timestamptz;
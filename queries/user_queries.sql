@@ -4,7 +4,7 @@ VALUES ($1, $2, $3, $4, NOW(), NOW())
 RETURNING id, username, email, password, role, created_at, updated_at;
 
 -- name: GetUserByEmail :one
-SELECT id, username, email, password, role, two_fa_enabled 
+SELECT id, username, email, password, role, two_fa_enabled, email_verified_at, token_version, email_otp_enabled, preferred_factor, sms_otp_enabled, webauthn_second_factor
 FROM users
 WHERE email = $1;
 
@@ -14,6 +14,12 @@ FROM users
 WHERE id = $1;
 
 
+-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL;
+
+
 -- name: Set2FAStatus :one
 UPDATE users
 SET two_fa_enabled = $2
@@ -27,3 +33,68 @@ SET totp_secret = $2
 WHERE id = $1; 
 
 
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: BumpTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1, updated_at = NOW()
+WHERE id = $1
+RETURNING token_version;
+
+-- name: StorePendingSecret2FA :exec
+UPDATE users
+SET totp_pending_secret = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ActivatePendingSecret2FA :execrows
+UPDATE users
+SET totp_secret = totp_pending_secret, totp_pending_secret = NULL, totp_last_step = $3, two_fa_enabled = TRUE, updated_at = NOW()
+WHERE id = $1 AND totp_pending_secret = $2;
+
+-- name: Disable2FA :exec
+UPDATE users
+SET two_fa_enabled = FALSE, totp_secret = NULL, totp_pending_secret = NULL, totp_last_step = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: AcceptTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2);
+
+-- name: ListTOTPSecrets :many
+SELECT id, totp_secret, totp_pending_secret
+FROM users
+WHERE id > $1 AND (totp_secret IS NOT NULL OR totp_pending_secret IS NOT NULL)
+ORDER BY id
+LIMIT $2;
+
+-- name: ReplaceTOTPSecrets :execrows
+UPDATE users
+SET totp_secret = $2, totp_pending_secret = $3
+WHERE id = $1
+  AND totp_secret IS NOT DISTINCT FROM sqlc.narg(old_totp_secret)::text
+  AND totp_pending_secret IS NOT DISTINCT FROM sqlc.narg(old_totp_pending_secret)::text;
+
+-- name: SetEmailOTPStatus :exec
+UPDATE users
+SET email_otp_enabled = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetWebAuthnSecondFactor :exec
+UPDATE users
+SET webauthn_second_factor = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetPreferredFactor :exec
+UPDATE users
+SET preferred_factor = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetSMSOTP :exec
+UPDATE users
+SET phone_number = $2, sms_otp_enabled = $3, updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,15 @@
+-- name: CreateUserToken :one
+INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ConsumeUserToken :one
+UPDATE user_tokens
+SET consumed_at = NOW()
+WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidateUserTokens :exec
+UPDATE user_tokens
+SET consumed_at = NOW()
+WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL;
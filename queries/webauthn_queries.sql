@@ -0,0 +1,38 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (user_id, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, name)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: ListWebAuthnCredentials :many
+SELECT *
+FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountWebAuthnCredentials :one
+SELECT COUNT(*)
+FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: UseWebAuthnCredential :execrows
+UPDATE webauthn_credentials
+SET sign_count = $2, backup_state = $3, last_used_at = NOW()
+WHERE id = $1 AND (sign_count < $2 OR $2 = 0);
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (user_id, ceremony, session_data, expires_at, amr)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: ConsumeWebAuthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges
+WHERE expires_at < @expired_before::timestamptz;
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/BigBr41n/echoAuth/controllers"
+	ctm "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/labstack/echo/v4"
+)
+
+func RegisterAdminRoutes(api *echo.Group, admCtl controllers.AdminControllerI) {
+	adminRoute := api.Group("/admin", ctm.JwtAuthMidd, ctm.RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminLockouts), ctm.UserRateLimit(), ctm.RequireMFAPolicy(mfapolicy.Sensitive))
+
+	adminRoute.DELETE("/lockouts/users/:id", admCtl.UnlockUser)
+	adminRoute.DELETE("/lockouts/ips/:ip", admCtl.UnlockIP)
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"github.com/BigBr41n/echoAuth/controllers"
+	ctm "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterOAuthRoutes mounts the oauth endpoints at the root, their paths are
+// the ones the clients expect
+func RegisterOAuthRoutes(e *echo.Echo, oauthCtl controllers.OAuthControllerI) {
+	oauthRoute := e.Group("/oauth")
+
+	// authorization code flow, the user logs in and answers on the front
+	oauthRoute.GET("/authorize", oauthCtl.Authorize, ctm.AuthRateLimit())
+	oauthRoute.POST("/token", oauthCtl.Token, ctm.UserRateLimit())
+
+	// consent screen of the front, only with a first party token
+	requestsRoute := oauthRoute.Group("/authorize/requests", ctm.JwtAuthMidd, ctm.RequireHuman, ctm.UserRateLimit(), ctm.RequireMFAPolicy(mfapolicy.Standard))
+	requestsRoute.GET("/:id", oauthCtl.GetAuthorization)
+	requestsRoute.POST("/:id", oauthCtl.DecideAuthorization)
+
+	// device flow (RFC 8628): the device gets its codes without user, the
+	// user answers on the front with a complete login
+	oauthRoute.POST("/device/code", oauthCtl.DeviceAuthorization, ctm.AuthRateLimit())
+	deviceRoute := oauthRoute.Group("/device/requests", ctm.JwtAuthMidd, ctm.RequireHuman, ctm.UserRateLimit(), ctm.RequireMFAPolicy(mfapolicy.Standard))
+	deviceRoute.GET("", oauthCtl.GetDeviceRequest)
+	deviceRoute.POST("", oauthCtl.DecideDeviceRequest)
+
+	// resource servers call it for every request, the user limit fits better
+	// than the strict one
+	oauthRoute.POST("/introspect", oauthCtl.Introspect, ctm.UserRateLimit())
+
+	// OpenID Connect userinfo, at the root like the other providers, the
+	// token of an oauth client with the openid scope is required
+	userInfoMidd := []echo.MiddlewareFunc{ctm.OAuthBearerMidd, ctm.RequireScope("openid"), ctm.UserRateLimit()}
+	e.GET("/userinfo", oauthCtl.UserInfo, userInfoMidd...)
+	e.POST("/userinfo", oauthCtl.UserInfo, userInfoMidd...)
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/BigBr41n/echoAuth/controllers"
+	ctm "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterServiceAccountRoutes mounts the management of the service accounts,
+// reserved to the admins like the other /admin routes
+func RegisterServiceAccountRoutes(api *echo.Group, saCtl controllers.ServiceAccountControllerI) {
+	saRoute := api.Group("/admin/service-accounts", ctm.JwtAuthMidd, ctm.RequireRoleOrScope([]string{"admin"}, principal.ScopeAdminServiceAccounts), ctm.UserRateLimit(), ctm.RequireMFAPolicy(mfapolicy.Sensitive))
+
+	saRoute.GET("", saCtl.ListServiceAccounts)
+	saRoute.POST("", saCtl.CreateServiceAccount)
+	saRoute.POST("/:clientId/secret", saCtl.RotateSecret)
+	saRoute.DELETE("/:clientId", saCtl.RevokeServiceAccount)
+}
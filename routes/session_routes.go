@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/BigBr41n/echoAuth/controllers"
+	ctm "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/labstack/echo/v4"
+)
+
+func RegisterSessionRoutes(api *echo.Group, sessCtl controllers.SessionControllerI) {
+	sessionRoute := api.Group("/auth/sessions", ctm.JwtAuthMidd, ctm.RequireHuman, ctm.UserRateLimit())
+
+	// revoking a session only takes access away, a stolen device must be cut
+	// off without a step up
+	sessionRoute.GET("", sessCtl.ListSessions, ctm.RequireMFAPolicy(mfapolicy.Standard))
+	sessionRoute.DELETE("/:id", sessCtl.RevokeSession, ctm.RequireMFAPolicy(mfapolicy.Standard))
+}
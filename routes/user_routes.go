@@ -3,15 +3,68 @@ package routes
 import (
 	"github.com/BigBr41n/echoAuth/controllers"
 	ctm "github.com/BigBr41n/echoAuth/internal/custom_middlewares"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
 	"github.com/labstack/echo/v4"
 )
 
 func RegisterUserRoutes(api *echo.Group, authCtl controllers.AuthControllerI) {
 	userRoute := api.Group("/auth")
 
-	userRoute.POST("/signup", authCtl.RegisterNewUser)
-	userRoute.POST("/login", authCtl.LoginUser)
-	userRoute.POST("/refresh", authCtl.RefreshAxsToken)
-	userRoute.POST("/2FA/enable", authCtl.Enable2FA, ctm.JwtAuthMidd)
-	userRoute.POST("/validate-totp", authCtl.ValidateTOTP)
+	// strict per ip limit on the public routes, looser per user limit once authenticated
+	strictLimit := ctm.AuthRateLimit()
+	userLimit := ctm.UserRateLimit()
+
+	// the account routes are for humans, service accounts are refused
+	auth := []echo.MiddlewareFunc{ctm.JwtAuthMidd, ctm.RequireHuman, userLimit}
+	// the multi factor policy on top: member routes check the role and the
+	// session age, sensitive ones a recent login too (STEP_UP_REQUIRED). The
+	// totp enrollment, the step up and the logout stay reachable without it
+	member := []echo.MiddlewareFunc{ctm.JwtAuthMidd, ctm.RequireHuman, userLimit, ctm.RequireMFAPolicy(mfapolicy.Standard)}
+	sensitive := []echo.MiddlewareFunc{ctm.JwtAuthMidd, ctm.RequireHuman, userLimit, ctm.RequireMFAPolicy(mfapolicy.Sensitive)}
+
+	userRoute.POST("/signup", authCtl.RegisterNewUser, strictLimit)
+	userRoute.POST("/login", authCtl.LoginUser, strictLimit)
+	userRoute.POST("/magic-link", authCtl.RequestMagicLink, strictLimit)
+	userRoute.GET("/magic-link/callback", authCtl.MagicLinkCallback, strictLimit)
+	userRoute.POST("/magic-link/exchange", authCtl.ExchangeMagicLinkCode, strictLimit)
+	userRoute.POST("/refresh", authCtl.RefreshAxsToken, userLimit)
+	userRoute.POST("/logout", authCtl.Logout, auth...)
+	userRoute.POST("/logout-all", authCtl.LogoutAll, member...)
+	userRoute.POST("/password/forgot", authCtl.ForgotPassword, strictLimit)
+	userRoute.POST("/password/reset", authCtl.ResetPassword, strictLimit)
+	userRoute.POST("/password/change", authCtl.ChangePassword, sensitive...)
+	userRoute.POST("/email/verify", authCtl.VerifyEmail, strictLimit)
+	userRoute.POST("/email/resend", authCtl.ResendVerification, strictLimit)
+	userRoute.POST("/2FA/setup", authCtl.Setup2FA, auth...)
+	userRoute.POST("/2FA/confirm", authCtl.Confirm2FA, auth...)
+	userRoute.POST("/2FA/disable", authCtl.Disable2FA, sensitive...)
+	userRoute.GET("/2FA/recovery-codes", authCtl.RecoveryCodesStatus, member...)
+	userRoute.POST("/2FA/recovery-codes", authCtl.RegenerateRecoveryCodes, sensitive...)
+	userRoute.POST("/validate-totp", authCtl.ValidateTOTP, strictLimit)
+	userRoute.POST("/step-up", authCtl.StepUp, auth...)
+
+	// second factors: the login routes take the temp token of the login
+	userRoute.GET("/2FA/factors", authCtl.ListFactors, member...)
+	userRoute.PUT("/2FA/factors/preferred", authCtl.SetPreferredFactor, sensitive...)
+	userRoute.POST("/2FA/sms/enroll", authCtl.EnrollSMS, sensitive...)
+	userRoute.POST("/2FA/sms/confirm", authCtl.ConfirmSMS, sensitive...)
+	userRoute.POST("/2FA/sms/disable", authCtl.DisableSMS, sensitive...)
+	userRoute.POST("/2FA/email/enable", authCtl.EnableEmailOTP, sensitive...)
+	userRoute.POST("/2FA/email/disable", authCtl.DisableEmailOTP, sensitive...)
+	userRoute.GET("/login/factors", authCtl.LoginFactors, strictLimit)
+	userRoute.POST("/login/sms-code", authCtl.SendSMSOTP, strictLimit)
+	userRoute.POST("/validate-sms-otp", authCtl.ValidateSMSOTP, strictLimit)
+	userRoute.POST("/login/email-code", authCtl.SendEmailOTP, strictLimit)
+	userRoute.POST("/validate-email-otp", authCtl.ValidateEmailOTP, strictLimit)
+
+	// passkeys and security keys: login/begin takes the temp token of the
+	// login as a second factor (once enabled), none for a passwordless login
+	userRoute.POST("/webauthn/register/begin", authCtl.BeginWebAuthnRegistration, sensitive...)
+	userRoute.POST("/webauthn/register/finish", authCtl.FinishWebAuthnRegistration, sensitive...)
+	userRoute.GET("/webauthn/credentials", authCtl.ListWebAuthnCredentials, member...)
+	userRoute.DELETE("/webauthn/credentials/:id", authCtl.DeleteWebAuthnCredential, sensitive...)
+	userRoute.POST("/2FA/webauthn/enable", authCtl.EnableWebAuthnSecondFactor, sensitive...)
+	userRoute.POST("/2FA/webauthn/disable", authCtl.DisableWebAuthnSecondFactor, sensitive...)
+	userRoute.POST("/webauthn/login/begin", authCtl.BeginWebAuthnLogin, strictLimit)
+	userRoute.POST("/webauthn/login/finish", authCtl.FinishWebAuthnLogin, strictLimit)
 }
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/BigBr41n/echoAuth/controllers"
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterWellKnownRoutes mounts the /.well-known documents at the root,
+// outside of /api/v1 where verifiers look for them
+func RegisterWellKnownRoutes(e *echo.Echo, wkCtl controllers.WellKnownControllerI) {
+	wellKnown := e.Group("/.well-known")
+
+	wellKnown.GET("/jwks.json", wkCtl.JWKS)
+	wellKnown.GET("/openid-configuration", wkCtl.OpenIDConfiguration)
+}
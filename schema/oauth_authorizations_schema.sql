@@ -0,0 +1,18 @@
+CREATE TABLE oauth_authorizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT UNIQUE,
+    session_id UUID REFERENCES sessions(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    approved_at TIMESTAMPTZ,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    nonce TEXT NOT NULL DEFAULT '',
+    amr TEXT[] NOT NULL DEFAULT '{}',
+    auth_time TIMESTAMPTZ
+);
@@ -0,0 +1,14 @@
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ,
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    service_account BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    device_grant BOOLEAN NOT NULL DEFAULT FALSE
+);
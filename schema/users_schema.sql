@@ -6,6 +6,15 @@ CREATE TABLE users (
     role TEXT NOT NULL DEFAULT 'client',
     two_fa_enabled BOOL DEFAULT FALSE, 
     totp_secret TEXT , 
+    totp_pending_secret TEXT,
+    totp_last_step BIGINT,
+    email_verified_at TIMESTAMPTZ,
+    token_version INT NOT NULL DEFAULT 0,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    email_otp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    preferred_factor TEXT,
+    phone_number TEXT,
+    sms_otp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    webauthn_second_factor BOOLEAN NOT NULL DEFAULT FALSE
 );
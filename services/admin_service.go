@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+type AdminServiceI interface {
+	UnlockUser(ctx context.Context, by *principal.Principal, userID pgtype.UUID, client *ClientInfo) error
+	UnlockIP(ctx context.Context, by *principal.Principal, ip string) error
+}
+
+type AdminService struct {
+	queries *sqlc.Queries
+	guard   *lockout.Guard
+}
+
+func NewAdminService(qrs *sqlc.Queries, guard *lockout.Guard) AdminServiceI {
+	return &AdminService{
+		queries: qrs,
+		guard:   guard,
+	}
+}
+
+// UnlockUser clears the failed attempts and the locks of the password and
+// second factor steps of the user
+func (as *AdminService) UnlockUser(ctx context.Context, by *principal.Principal, userID pgtype.UUID, client *ClientInfo) error {
+
+	user, err := as.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &dtos.ApiErr{
+				Status:  http.StatusNotFound,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	err = as.guard.Unlock(ctx, lockout.LoginKey(user.Email), lockout.SecondFactorKey(user.ID.String()))
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// an admin or a service account granted the admin scope
+	details := map[string]any{"by": by.ID, "byKind": by.Kind}
+	if err = recordAuditEvent(ctx, as.queries, userID, auditAccountUnlocked, client, details); err != nil {
+		logger.Error("failed to record audit event",
+			zap.String("event", auditAccountUnlocked),
+			zap.Error(err),
+		)
+	}
+
+	logger.Info("account unlocked",
+		zap.String("userId", userID.String()),
+		zap.String("by", by.String()),
+	)
+	return nil
+}
+
+// UnlockIP clears the failed attempts and the lock of a client address
+func (as *AdminService) UnlockIP(ctx context.Context, by *principal.Principal, ip string) error {
+
+	if err := as.guard.Unlock(ctx, lockout.IPKey(ip)); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("ip unlocked",
+		zap.String("ip", ip),
+		zap.String("by", by.String()),
+	)
+	return nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// audit events recorded for security sensitive changes of an account
+const (
+	auditTwoFADisabled            = "2fa_disabled"
+	auditRecoveryCodeUsed         = "recovery_code_used"
+	auditRecoveryCodesRegenerated = "recovery_codes_regenerated"
+	auditAccountUnlocked          = "account_unlocked"
+	auditWebAuthnRegistered       = "webauthn_registered"
+	auditWebAuthnRemoved          = "webauthn_removed"
+	auditWebAuthnEnabled          = "webauthn_2fa_enabled"
+	auditWebAuthnDisabled         = "webauthn_2fa_disabled"
+	auditSMSOTPEnabled            = "sms_otp_enabled"
+	auditSMSOTPDisabled           = "sms_otp_disabled"
+	auditEmailOTPEnabled          = "email_otp_enabled"
+	auditEmailOTPDisabled         = "email_otp_disabled"
+	auditStepUp                   = "step_up"
+)
+
+// recordAuditEvent stores an audit event, run it in the transaction of the
+// change so the event and the change are committed together
+func recordAuditEvent(ctx context.Context, qtx *sqlc.Queries, userID pgtype.UUID, event string, client *ClientInfo, details map[string]any) error {
+
+	var rawDetails []byte
+	if details != nil {
+		var err error
+		if rawDetails, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+
+	params := sqlc.CreateAuditEventParams{
+		UserID:  userID,
+		Event:   event,
+		Details: rawDetails,
+	}
+	if client != nil {
+		params.Ip = client.IP
+		params.UserAgent = client.UserAgent
+	}
+
+	return qtx.CreateAuditEvent(ctx, params)
+}
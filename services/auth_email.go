@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+const (
+	emailVerificationPurpose = "email_verification"
+	emailVerificationTTL     = 24 * time.Hour
+	// one link per address in this delay
+	emailVerificationResendDelay = time.Minute
+)
+
+// VerifyEmail consumes the verification token and marks the address as verified
+func (usr *AuthService) VerifyEmail(ctx context.Context, token string) error {
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		logger.Error("error when startsing a transaction",
+			zap.String("context", "error in function start transaction from utils"),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	verifToken, err := qtx.ConsumeUserToken(ctx, sqlc.ConsumeUserTokenParams{
+		TokenHash: securetoken.Hash(token),
+		Purpose:   emailVerificationPurpose,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &dtos.ApiErr{
+				Status:  http.StatusBadRequest,
+				Code:    "INVALID_VERIFICATION_TOKEN",
+				Err:     "Verification token is invalid or expired",
+				Details: nil,
+			}
+		}
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = qtx.MarkEmailVerified(ctx, verifToken.UserID); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error("failed to verify email",
+			zap.String("commit", "failed"),
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("email verified",
+		zap.String("userId", verifToken.UserID.String()),
+	)
+	return nil
+}
+
+// ResendVerification emails a new verification link, the answer is the same
+// whether the email is registered, already verified or not: the link is sent
+// in the background and the delay between two links counts for every address
+func (usr *AuthService) ResendVerification(ctx context.Context, email string) error {
+
+	// counted by the rate limiter, a failing backend doesn't block the links
+	if usr.limiter != nil {
+		key := "email:" + securetoken.Hash(strings.ToLower(strings.TrimSpace(email)))
+		res, err := usr.limiter.Allow(ctx, key, ratelimit.Rule{
+			Name:   "email_verification",
+			Limit:  1,
+			Window: emailVerificationResendDelay,
+		})
+		if err != nil {
+			logger.Warn("rate limiter unavailable", zap.String("rule", "email_verification"), zap.Error(err))
+		} else if !res.Allowed {
+			seconds := int(math.Ceil(res.RetryAfter.Seconds()))
+			return &dtos.ApiErr{
+				Status:  http.StatusTooManyRequests,
+				Code:    "VERIFICATION_TOO_SOON",
+				Err:     "A link was just sent, wait before asking a new one",
+				Details: map[string]any{"retryAfter": seconds},
+				Headers: map[string]string{"Retry-After": strconv.Itoa(seconds)},
+			}
+		}
+	}
+
+	usr.runInBackground("email verification", func(ctx context.Context) error {
+		return usr.resendVerification(ctx, email)
+	})
+	return nil
+}
+
+func (usr *AuthService) resendVerification(ctx context.Context, email string) error {
+
+	user, err := usr.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Info("verification requested for an unknown email")
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		return nil
+	}
+
+	return usr.sendVerificationEmail(ctx, user.ID, user.Email, user.Username)
+}
+
+func (usr *AuthService) sendVerificationEmail(ctx context.Context, userID pgtype.UUID, email string, username string) error {
+
+	token, err := usr.issueUserToken(ctx, userID, emailVerificationPurpose, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	usr.sendMail(&mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the link below to verify your email address, it expires in %d hours:\n\n%s/verify-email?token=%s\n",
+			username,
+			int(emailVerificationTTL.Hours()),
+			config.AppConfig.AppURL,
+			url.QueryEscape(token),
+		),
+	})
+
+	return nil
+}
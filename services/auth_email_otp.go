@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+const (
+	emailOTPDigits = 6
+	emailOTPTTL    = 10 * time.Minute
+	// wrong codes accepted before the code is dropped, the lockout of the
+	// second factor still applies
+	emailOTPMaxAttempts = 5
+	// a new code can't be asked more than once a minute
+	emailOTPResendDelay = time.Minute
+)
+
+// amr of a login step done with a code or a link sent by email, not part of
+// RFC 8176
+const amrEmail = "email"
+
+func emailOTPNotEnabledErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "EMAIL_OTP_NOT_ENABLED",
+		Err:     "Email codes are not enabled for this account",
+		Details: nil,
+	}
+}
+
+func invalidEmailOTPErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "INVALID_EMAIL_OTP",
+		Err:     "Invalid or expired email code",
+		Details: nil,
+	}
+}
+
+// generateOTPCode draws a numeric code, short enough to be typed from a phone
+func generateOTPCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// otpHash binds the stored hash of a code sent by email or sms to the user,
+// the same code of two users gives two hashes
+func otpHash(userID pgtype.UUID, code string) string {
+	return securetoken.Hash(userID.String() + ":" + code)
+}
+
+// EnableEmailOTP adds the email codes as a second factor, the address must be
+// verified first
+func (usr *AuthService) EnableEmailOTP(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error {
+	return usr.setEmailOTP(ctx, claims, true, client)
+}
+
+// DisableEmailOTP removes the email codes factor and the pending codes
+func (usr *AuthService) DisableEmailOTP(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error {
+	return usr.setEmailOTP(ctx, claims, false, client)
+}
+
+func (usr *AuthService) setEmailOTP(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, enabled bool, client *ClientInfo) error {
+	user, factors, err := usr.userFactors(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailOtpEnabled == enabled {
+		if enabled {
+			return &dtos.ApiErr{
+				Status:  http.StatusConflict,
+				Code:    "EMAIL_OTP_ALREADY_ENABLED",
+				Err:     "Email codes are already enabled",
+				Details: nil,
+			}
+		}
+		return emailOTPNotEnabledErr()
+	}
+	if enabled && !user.EmailVerifiedAt.Valid {
+		return &dtos.ApiErr{
+			Status:  http.StatusForbidden,
+			Code:    "EMAIL_NOT_VERIFIED",
+			Err:     "Email address is not verified",
+			Details: nil,
+		}
+	}
+	if err := requireMFA(factors, claims); err != nil {
+		return err
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	if err := qtx.SetEmailOTPStatus(ctx, sqlc.SetEmailOTPStatusParams{
+		ID:              claims.UserID,
+		EmailOtpEnabled: enabled,
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	event := auditEmailOTPEnabled
+	if !enabled {
+		event = auditEmailOTPDisabled
+		if err := qtx.DeleteEmailOTPs(ctx, claims.UserID); err != nil {
+			return &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+	}
+	if err := recordAuditEvent(ctx, qtx, claims.UserID, event, client, nil); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("email otp changed",
+		zap.String("userId", claims.UserID.String()),
+		zap.Bool("enabled", enabled),
+	)
+	return nil
+}
+
+// SendEmailOTP emails a new code to the user of a temp token, the previous
+// code stops working
+func (usr *AuthService) SendEmailOTP(ctx context.Context, userID pgtype.UUID) error {
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if !user.EmailOtpEnabled {
+		return emailOTPNotEnabledErr()
+	}
+
+	// a mailbox can't be flooded by asking again and again
+	active, err := usr.queries.GetActiveEmailOTP(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if err == nil {
+		if wait := emailOTPResendDelay - time.Since(active.CreatedAt.Time); wait > 0 {
+			seconds := int(wait.Round(time.Second).Seconds())
+			return &dtos.ApiErr{
+				Status:  http.StatusTooManyRequests,
+				Code:    "EMAIL_OTP_TOO_SOON",
+				Err:     "A code was just sent, wait before asking a new one",
+				Details: map[string]any{"retryAfter": seconds},
+				Headers: map[string]string{"Retry-After": strconv.Itoa(seconds)},
+			}
+		}
+	}
+
+	code, err := generateOTPCode(emailOTPDigits)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	if err := qtx.DeleteEmailOTPs(ctx, userID); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if _, err := qtx.CreateEmailOTP(ctx, sqlc.CreateEmailOTPParams{
+		UserID:   userID,
+		CodeHash: otpHash(userID, code),
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(emailOTPTTL),
+			Valid: true,
+		},
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	usr.sendMail(&mailer.Message{
+		To:      user.Email,
+		Subject: "Your login code",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nYour login code is %s, it expires in %d minutes.\n\nIf you didn't try to log in, change your password.\n",
+			user.Username,
+			code,
+			int(emailOTPTTL.Minutes()),
+		),
+	})
+
+	logger.Info("email otp sent",
+		zap.String("userId", userID.String()),
+	)
+	return nil
+}
+
+// emailOTPChannel gives verifyOTPCode the emailed codes of the user
+func (usr *AuthService) emailOTPChannel(userID pgtype.UUID) *otpChannel {
+	return &otpChannel{
+		name:        "EMAIL",
+		maxAttempts: emailOTPMaxAttempts,
+		invalidErr:  invalidEmailOTPErr,
+		active: func(ctx context.Context) (pgtype.UUID, string, error) {
+			code, err := usr.queries.GetActiveEmailOTP(ctx, userID)
+			return code.ID, code.CodeHash, err
+		},
+		countAttempt: usr.queries.CountEmailOTPAttempt,
+		consume:      usr.queries.ConsumeEmailOTP,
+		drop: func(ctx context.Context) error {
+			return usr.queries.DeleteEmailOTPs(ctx, userID)
+		},
+	}
+}
+
+// ValidateEmailOTP checks the emailed code of the user of a temp token and
+// opens the session
+func (usr *AuthService) ValidateEmailOTP(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims, code string, client *ClientInfo) (string, string, error) {
+	userID := temp.UserID
+
+	// limited like the totp, the attempts counter of the code comes on top
+	lockKey := lockout.SecondFactorKey(userID.String())
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return "", "", err
+	}
+
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	// not offered after a magic link, the mailbox is already proven
+	if !user.EmailOtpEnabled || !temp.EmailOTP {
+		return "", "", emailOTPNotEnabledErr()
+	}
+
+	if err := usr.verifyOTPCode(ctx, userID, usr.emailOTPChannel(userID), code, lockKey, client); err != nil {
+		return "", "", err
+	}
+	usr.recordSuccess(ctx, lockKey)
+
+	return usr.openSession(ctx, nil, &user, withSecondFactor(temp.AMR, amrEmail), client)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResendVerificationAnswerDoesntWaitForTheLookup(t *testing.T) {
+	f := newMagicLinkFixture(t)
+	release := holdUserLookup(f.db)
+
+	for _, email := range []string{f.user.Email, "nobody@example.com"} {
+		done := make(chan error, 1)
+		go func() {
+			done <- f.usr.ResendVerification(context.Background(), email)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("the answer for %s waits for the user lookup", email)
+		}
+	}
+
+	release()
+	f.usr.jobs.Wait()
+	if n := len(f.mails.Messages()); n != 1 {
+		t.Errorf("%d emails sent, want 1", n)
+	}
+}
+
+func TestResendVerificationDelay(t *testing.T) {
+	f := newMagicLinkFixture(t)
+
+	// the delay applies to any address, it tells nothing about the accounts
+	for _, email := range []string{f.user.Email, "nobody@example.com"} {
+		if err := f.usr.ResendVerification(context.Background(), email); err != nil {
+			t.Fatal(err)
+		}
+		err := f.usr.ResendVerification(context.Background(), " "+strings.ToUpper(email))
+		if code := errCode(t, err); code != "VERIFICATION_TOO_SOON" {
+			t.Fatalf("%s: %s, want VERIFICATION_TOO_SOON", email, code)
+		}
+	}
+	f.usr.jobs.Wait()
+
+	if n := len(f.mails.Messages()); n != 1 {
+		t.Errorf("%d emails sent, want 1", n)
+	}
+}
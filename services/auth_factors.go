@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/sms"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// second factors a user can enroll besides the totp
+const (
+	factorWebAuthn = "webauthn"
+	factorSMS      = "sms"
+	factorEmail    = "email"
+)
+
+// enrolledFactors lists the second factors of a user, in the order they are
+// offered when none is preferred. The passkeys log in on their own, they are
+// a second factor only once the user opted in
+func enrolledFactors(user *sqlc.User, passkeys int64) []string {
+	factors := []string{}
+	if user.TwoFaEnabled.Bool {
+		factors = append(factors, factorTOTP)
+	}
+	if user.WebauthnSecondFactor && passkeys > 0 {
+		factors = append(factors, factorWebAuthn)
+	}
+	if user.SmsOtpEnabled {
+		factors = append(factors, factorSMS)
+	}
+	if user.EmailOtpEnabled {
+		factors = append(factors, factorEmail)
+	}
+	return factors
+}
+
+// chooseFactor returns the preferred factor while it's enrolled, the first
+// one otherwise
+func chooseFactor(factors []string, preferred pgtype.Text) string {
+	if preferred.Valid && slices.Contains(factors, preferred.String) {
+		return preferred.String
+	}
+	if len(factors) == 0 {
+		return ""
+	}
+	return factors[0]
+}
+
+// requireMFA refuses to change the second factors of an account protected by
+// one from a session opened without it
+func requireMFA(factors []string, claims *jwtImpl.CustomAccessTokenClaims) error {
+	if len(factors) > 0 && !slices.Contains(claims.AMR, amrMFA) {
+		return &dtos.ApiErr{
+			Status:  http.StatusForbidden,
+			Code:    "MFA_REQUIRED",
+			Err:     "Login again with your second factor to change the second factors",
+			Details: nil,
+		}
+	}
+	return nil
+}
+
+// withSecondFactor adds the second factor to the methods of the first step of
+// the login, temp tokens issued without them came from the password
+func withSecondFactor(first []string, method string) []string {
+	if len(first) == 0 {
+		first = []string{amrPassword}
+	}
+	amr := append([]string{}, first...)
+	return append(amr, method, amrMFA)
+}
+
+// userFactors loads a user and its enrolled second factors
+func (usr *AuthService) userFactors(ctx context.Context, userID pgtype.UUID) (*sqlc.User, []string, error) {
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, &dtos.ApiErr{
+				Status:  http.StatusNotFound,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	passkeys, err := usr.queries.CountWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &user, enrolledFactors(&user, passkeys), nil
+}
+
+// ListFactors returns the enrolled second factors and the one offered first
+// at login, the phone number is masked
+func (usr *AuthService) ListFactors(ctx context.Context, userID pgtype.UUID) (*dtos.FactorsDTO, error) {
+	user, factors, err := usr.userFactors(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	factorsDTO := &dtos.FactorsDTO{
+		Factors:   factors,
+		Preferred: chooseFactor(factors, user.PreferredFactor),
+	}
+	if user.SmsOtpEnabled {
+		factorsDTO.Phone = sms.Mask(user.PhoneNumber.String)
+	}
+	return factorsDTO, nil
+}
+
+// SetPreferredFactor picks the factor offered first at login, an sms or email
+// code is then sent as soon as the password is checked
+func (usr *AuthService) SetPreferredFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, factor string) error {
+	_, factors, err := usr.userFactors(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if err := requireMFA(factors, claims); err != nil {
+		return err
+	}
+	if !slices.Contains(factors, factor) {
+		return &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "FACTOR_NOT_ENROLLED",
+			Err:     "The factor isn't enrolled",
+			Details: nil,
+		}
+	}
+
+	if err := usr.queries.SetPreferredFactor(ctx, sqlc.SetPreferredFactorParams{
+		ID: claims.UserID,
+		PreferredFactor: pgtype.Text{
+			String: factor,
+			Valid:  true,
+		},
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("preferred factor changed",
+		zap.String("userId", claims.UserID.String()),
+		zap.String("factor", factor),
+	)
+	return nil
+}
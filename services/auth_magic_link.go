@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	magicLinkPurpose = "magic_link"
+	MagicLinkTTL     = 15 * time.Minute
+	// a new link can't be asked more than once a minute for an email
+	magicLinkResendDelay = time.Minute
+
+	// the callback hands the front a code instead of the tokens, the front
+	// exchanges it right away
+	magicLinkCodePurpose = "magic_link_code"
+	magicLinkCodeTTL     = time.Minute
+)
+
+func invalidMagicLinkErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "INVALID_MAGIC_LINK",
+		Err:     "Login link is invalid, expired or opened in another browser",
+		Details: nil,
+	}
+}
+
+// RequestMagicLink emails a single use login link. The returned nonce is kept
+// by the browser (cookie), the link only works along with it. The lookup, the
+// link and the email run in the background and the resend delay applies to
+// any address, the answer tells nothing about the email
+func (usr *AuthService) RequestMagicLink(ctx context.Context, email string) (string, error) {
+
+	// counted by the rate limiter, a failing backend doesn't block the logins
+	if usr.limiter != nil {
+		key := "email:" + securetoken.Hash(strings.ToLower(strings.TrimSpace(email)))
+		res, err := usr.limiter.Allow(ctx, key, ratelimit.Rule{
+			Name:   "magic_link",
+			Limit:  1,
+			Window: magicLinkResendDelay,
+		})
+		if err != nil {
+			logger.Warn("rate limiter unavailable", zap.String("rule", "magic_link"), zap.Error(err))
+		} else if !res.Allowed {
+			seconds := int(math.Ceil(res.RetryAfter.Seconds()))
+			return "", &dtos.ApiErr{
+				Status:  http.StatusTooManyRequests,
+				Code:    "MAGIC_LINK_TOO_SOON",
+				Err:     "A link was just sent, wait before asking a new one",
+				Details: map[string]any{"retryAfter": seconds},
+				Headers: map[string]string{"Retry-After": strconv.Itoa(seconds)},
+			}
+		}
+	}
+
+	nonce, err := securetoken.Generate()
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	usr.runInBackground("magic link", func(ctx context.Context) error {
+		return usr.sendMagicLink(ctx, email, nonce)
+	})
+	return nonce, nil
+}
+
+func (usr *AuthService) sendMagicLink(ctx context.Context, email string, nonce string) error {
+
+	user, err := usr.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Info("magic link requested for an unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := usr.issueBoundUserToken(ctx, user.ID, magicLinkPurpose, MagicLinkTTL, nonce)
+	if err != nil {
+		return err
+	}
+
+	// the link reaches this service directly, the nonce cookie is sent with it
+	err = usr.mail.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the link below to log in, it expires in %d minutes and only works in the browser where you asked for it:\n\n%s/api/v1/auth/magic-link/callback?token=%s\n\nIf you didn't ask for it, ignore this email.\n",
+			user.Username,
+			int(MagicLinkTTL.Minutes()),
+			config.AppConfig.APIURL,
+			url.QueryEscape(token),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("magic link requested",
+		zap.String("userId", user.ID.String()),
+	)
+	return nil
+}
+
+// ConsumeMagicLink consumes the link opened with the nonce of the browser
+// that asked for it and returns a one time code for the front. The callback
+// is a top level navigation, the tokens are only given to the front by
+// ExchangeMagicLinkCode
+func (usr *AuthService) ConsumeMagicLink(ctx context.Context, token string, nonce string) (string, error) {
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	// a forwarded link (or a mail scanner following it) has another nonce,
+	// the token isn't found and stays usable by its owner
+	linkToken, err := qtx.ConsumeUserToken(ctx, sqlc.ConsumeUserTokenParams{
+		TokenHash: userTokenHash(token, nonce),
+		Purpose:   magicLinkPurpose,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", invalidMagicLinkErr()
+		}
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// the link proves the address
+	if err = qtx.MarkEmailVerified(ctx, linkToken.UserID); err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// bound to the nonce too, a code leaked from the url is useless elsewhere
+	code, err := createUserToken(ctx, qtx, linkToken.UserID, magicLinkCodePurpose, magicLinkCodeTTL, nonce)
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("magic link used",
+		zap.String("userId", linkToken.UserID.String()),
+	)
+	return code, nil
+}
+
+// ExchangeMagicLinkCode consumes the code given to the front by the callback
+// and logs the user in. The link stands for the password: the second factor
+// step follows when the user has one
+func (usr *AuthService) ExchangeMagicLinkCode(ctx context.Context, code string, nonce string, client *ClientInfo) (string, string, error) {
+
+	codeToken, err := usr.queries.ConsumeUserToken(ctx, sqlc.ConsumeUserTokenParams{
+		TokenHash: userTokenHash(code, nonce),
+		Purpose:   magicLinkCodePurpose,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", invalidMagicLinkErr()
+		}
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	user, err := usr.queries.GetUserByID(ctx, codeToken.UserID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return usr.continueLogin(ctx, &user, []string{amrEmail}, client)
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+)
+
+type magicLinkFixture struct {
+	usr    *AuthService
+	db     *fakeDB
+	tokens *fakeTokens
+	store  *fakeStore
+	mails  *mailer.MemorySender
+	user   sqlc.User
+}
+
+func newMagicLinkFixture(t *testing.T) *magicLinkFixture {
+	t.Helper()
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.APIURL = "https://api.example.com"
+	config.AppConfig.OIDCIssuer = "https://issuer.example.com"
+
+	store := newFakeStore()
+	user := store.addUser(sqlc.User{Username: "alice", Email: "alice@example.com"})
+	usr, db, tokens, _ := newTestAuthService(store)
+	mails := mailer.NewMemorySender()
+	usr.mail = mails
+	usr.limiter = ratelimit.NewMemoryLimiter()
+
+	return &magicLinkFixture{usr: usr, db: db, tokens: tokens, store: store, mails: mails, user: user}
+}
+
+// request asks for a link and returns the nonce of the browser and the token
+// of the emailed link
+func (f *magicLinkFixture) request(t *testing.T) (string, string) {
+	t.Helper()
+	nonce, err := f.usr.RequestMagicLink(context.Background(), f.user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.usr.jobs.Wait()
+
+	msg, ok := f.mails.Last(f.user.Email)
+	if !ok {
+		t.Fatal("no magic link email")
+	}
+	prefix := config.AppConfig.APIURL + "/api/v1/auth/magic-link/callback?"
+	_, query, ok := strings.Cut(msg.Body, prefix)
+	if !ok {
+		t.Fatalf("no link to %s in %q", prefix, msg.Body)
+	}
+	values, err := url.ParseQuery(strings.Fields(query)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce, values.Get("token")
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	f := newMagicLinkFixture(t)
+	nonce, token := f.request(t)
+
+	// another browser, or a mail scanner
+	if _, err := f.usr.ConsumeMagicLink(context.Background(), token, "other-nonce"); errCode(t, err) != "INVALID_MAGIC_LINK" {
+		t.Fatalf("other nonce: %v, want INVALID_MAGIC_LINK", err)
+	}
+
+	code, err := f.usr.ConsumeMagicLink(context.Background(), token, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.store.users[f.user.ID].EmailVerifiedAt.Valid {
+		t.Error("the link didn't verify the address")
+	}
+	if _, err := f.usr.ConsumeMagicLink(context.Background(), token, nonce); errCode(t, err) != "INVALID_MAGIC_LINK" {
+		t.Fatalf("link replay: %v, want INVALID_MAGIC_LINK", err)
+	}
+
+	if _, _, err := f.usr.ExchangeMagicLinkCode(context.Background(), code, "other-nonce", nil); errCode(t, err) != "INVALID_MAGIC_LINK" {
+		t.Fatalf("code of another browser: %v, want INVALID_MAGIC_LINK", err)
+	}
+	if _, _, err := f.usr.ExchangeMagicLinkCode(context.Background(), code, nonce, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{amrEmail}; !slices.Equal(f.tokens.claims.AMR, want) {
+		t.Errorf("amr %v, want %v", f.tokens.claims.AMR, want)
+	}
+	if _, _, err := f.usr.ExchangeMagicLinkCode(context.Background(), code, nonce, nil); errCode(t, err) != "INVALID_MAGIC_LINK" {
+		t.Fatalf("code replay: %v, want INVALID_MAGIC_LINK", err)
+	}
+}
+
+func TestMagicLinkAnswerDoesntWaitForTheLookup(t *testing.T) {
+	f := newMagicLinkFixture(t)
+	release := holdUserLookup(f.db)
+
+	for _, email := range []string{f.user.Email, "nobody@example.com"} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := f.usr.RequestMagicLink(context.Background(), email)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("the answer for %s waits for the user lookup", email)
+		}
+	}
+
+	release()
+	f.usr.jobs.Wait()
+	if n := len(f.mails.Messages()); n != 1 {
+		t.Errorf("%d emails sent, want 1", n)
+	}
+}
+
+func TestMagicLinkResendDelay(t *testing.T) {
+	f := newMagicLinkFixture(t)
+
+	// the delay applies to any address, it tells nothing about the accounts
+	for _, email := range []string{f.user.Email, "nobody@example.com"} {
+		if _, err := f.usr.RequestMagicLink(context.Background(), email); err != nil {
+			t.Fatal(err)
+		}
+		_, err := f.usr.RequestMagicLink(context.Background(), " "+strings.ToUpper(email))
+		if code := errCode(t, err); code != "MAGIC_LINK_TOO_SOON" {
+			t.Fatalf("%s: %s, want MAGIC_LINK_TOO_SOON", email, code)
+		}
+	}
+	f.usr.jobs.Wait()
+
+	if n := len(f.mails.Messages()); n != 1 {
+		t.Errorf("%d emails sent, want 1", n)
+	}
+}
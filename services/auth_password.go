@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetPurpose = "password_reset"
+	passwordResetTTL     = 30 * time.Minute
+)
+
+// ForgotPassword emails a single use reset link. The lookup, the token and
+// the email run in the background, the answer comes as fast whether the email
+// is registered or not
+func (usr *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	usr.runInBackground("password reset", func(ctx context.Context) error {
+		return usr.sendPasswordReset(ctx, email)
+	})
+	return nil
+}
+
+func (usr *AuthService) sendPasswordReset(ctx context.Context, email string) error {
+
+	user, err := usr.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.Info("password reset requested for an unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := usr.issueUserToken(ctx, user.ID, passwordResetPurpose, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	err = usr.mail.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the link below to choose a new password, it expires in %d minutes:\n\n%s/reset-password?token=%s\n\nIf you didn't ask for it, ignore this email.\n",
+			user.Username,
+			int(passwordResetTTL.Minutes()),
+			config.AppConfig.AppURL,
+			url.QueryEscape(token),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("password reset requested",
+		zap.String("userId", user.ID.String()),
+	)
+	return nil
+}
+
+// ResetPassword consumes the reset token, sets the new password and signs
+// the user out of every session
+func (usr *AuthService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		logger.Error("error when startsing a transaction",
+			zap.String("context", "error in function start transaction from utils"),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	resetToken, err := qtx.ConsumeUserToken(ctx, sqlc.ConsumeUserTokenParams{
+		TokenHash: securetoken.Hash(token),
+		Purpose:   passwordResetPurpose,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &dtos.ApiErr{
+				Status:  http.StatusBadRequest,
+				Code:    "INVALID_RESET_TOKEN",
+				Err:     "Reset token is invalid or expired",
+				Details: nil,
+			}
+		}
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("failed to reset password",
+			zap.String("context", "error while hashing the password"),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	err = qtx.UpdateUserPassword(ctx, sqlc.UpdateUserPasswordParams{
+		ID:       resetToken.UserID,
+		Password: string(hashedPass),
+	})
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error("failed to reset password",
+			zap.String("commit", "failed"),
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// whoever knew the old password must lose access
+	if err = usr.tokens.RevokeAllSessions(ctx, resetToken.UserID); err != nil {
+		return err
+	}
+
+	logger.Info("password reset",
+		zap.String("userId", resetToken.UserID.String()),
+	)
+	return nil
+}
+
+// ChangePassword checks the current password (and the TOTP when 2FA is on),
+// sets the new one and signs out every other session, the current session
+// continues with the returned token pair
+func (usr *AuthService) ChangePassword(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, change *PasswordChange, client *ClientInfo) (string, string, error) {
+
+	// tokens issued before sessions existed can't be kept alive
+	if !claims.SessionID.Valid {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "INVALID_SESSION",
+			Err:     "Session expired, login again",
+			Details: nil,
+		}
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		logger.Error("error when startsing a transaction",
+			zap.String("context", "error in function start transaction from utils"),
+			zap.Error(err),
+		)
+
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	user, err := qtx.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusNotFound,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// a stolen session must not give unlimited guesses of the password and
+	// the totp, the keys of the login count the failures
+	loginKey := lockout.LoginKey(user.Email)
+	secondFactorKey := lockout.SecondFactorKey(user.ID.String())
+	if err := usr.checkLockouts(ctx, client, loginKey, secondFactorKey); err != nil {
+		return "", "", err
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(change.CurrentPassword)); err != nil {
+		logger.Info("failed password change, wrong current password",
+			zap.String("userId", user.ID.String()),
+		)
+		usr.recordFailure(ctx, loginKey, client)
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "INVALID_CREDENTIALS",
+			Err:     "Invalid current password",
+			Details: nil,
+		}
+	}
+	usr.recordSuccess(ctx, loginKey)
+
+	if user.TwoFaEnabled.Bool {
+		if change.TOTP == "" {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusUnauthorized,
+				Code:    "TOTP_REQUIRED",
+				Err:     "TOTP code is required",
+				Details: nil,
+			}
+		}
+		valid, err := usr.verifyTOTP(ctx, qtx, &user, change.TOTP)
+		if err != nil {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		if !valid {
+			usr.recordFailure(ctx, secondFactorKey, client)
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusUnauthorized,
+				Code:    "INVALID_TOTP",
+				Err:     "Invalid TOTP code",
+				Details: nil,
+			}
+		}
+		usr.recordSuccess(ctx, secondFactorKey)
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(change.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("failed to change password",
+			zap.String("context", "error while hashing the password"),
+			zap.Error(err),
+		)
+
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	err = qtx.UpdateUserPassword(ctx, sqlc.UpdateUserPasswordParams{
+		ID:       user.ID,
+		Password: string(hashedPass),
+	})
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// every token carrying the previous version is rejected from now on
+	tokenVersion, err := qtx.BumpTokenVersion(ctx, user.ID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = usr.tokens.RevokeOtherSessions(ctx, qtx, user.ID, claims.SessionID); err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	newClaims := &jwtImpl.CustomAccessTokenClaims{
+		UserID:       user.ID,
+		Role:         user.Role,
+		Email:        user.Email,
+		TokenVersion: tokenVersion,
+		AMR:          claims.AMR,
+		ACR:          acrFor(claims.AMR),
+		AuthTime:     claims.AuthTime,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(9 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	accessToken, refreshToken, err := usr.tokens.IssueTokens(ctx, qtx, newClaims, claims.SessionID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error("failed to change password",
+			zap.String("commit", "failed"),
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("password changed",
+		zap.String("userId", user.ID.String()),
+	)
+	return accessToken, refreshToken, nil
+}
+
+// issueUserToken creates a single use token for the purpose, the previous
+// unused ones of the same purpose are invalidated
+func (usr *AuthService) issueUserToken(ctx context.Context, userID pgtype.UUID, purpose string, ttl time.Duration) (string, error) {
+	return usr.issueBoundUserToken(ctx, userID, purpose, ttl, "")
+}
+
+// userTokenHash is the stored hash of a token, a bound token is only found
+// again with the same binding
+func userTokenHash(token string, binding string) string {
+	if binding == "" {
+		return securetoken.Hash(token)
+	}
+	return securetoken.Hash(token + ":" + binding)
+}
+
+// issueBoundUserToken is issueUserToken for a token only usable along with
+// the binding (a nonce kept by the browser)
+func (usr *AuthService) issueBoundUserToken(ctx context.Context, userID pgtype.UUID, purpose string, ttl time.Duration, binding string) (string, error) {
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	token, err := createUserToken(ctx, usr.queries.WithTx(tx), userID, purpose, ttl, binding)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// createUserToken replaces the tokens of the purpose with a new one within the
+// caller's transaction
+func createUserToken(ctx context.Context, qtx *sqlc.Queries, userID pgtype.UUID, purpose string, ttl time.Duration, binding string) (string, error) {
+
+	err := qtx.InvalidateUserTokens(ctx, sqlc.InvalidateUserTokensParams{
+		UserID:  userID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	token, err := securetoken.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = qtx.CreateUserToken(ctx, sqlc.CreateUserTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: userTokenHash(token, binding),
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(ttl),
+			Valid: true,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sendMail delivers in the background, the response time must not tell
+// anything about the recipient or the mail server
+func (usr *AuthService) sendMail(msg *mailer.Message) {
+	usr.runInBackground("email "+msg.Subject, func(ctx context.Context) error {
+		return usr.mail.Send(ctx, msg)
+	})
+}
+
+// runInBackground runs the job detached from the request, with its own
+// timeout, the failures are only logged
+func (usr *AuthService) runInBackground(name string, job func(ctx context.Context) error) {
+	usr.jobs.Add(1)
+	go func() {
+		defer usr.jobs.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := job(ctx); err != nil {
+			logger.Error("background job failed",
+				zap.String("job", name),
+				zap.Error(err),
+			)
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+)
+
+// the lookup is held until release is closed, the answer must not wait for it
+func holdUserLookup(db *fakeDB) (release func()) {
+	lookup := db.one["GetUserByEmail"]
+	held := make(chan struct{})
+	db.one["GetUserByEmail"] = func(args []any) (any, error) {
+		<-held
+		return lookup(args)
+	}
+	return func() { close(held) }
+}
+
+func TestForgotPasswordSendsLink(t *testing.T) {
+	store := newFakeStore()
+	user := store.addUser(sqlc.User{Username: "alice", Email: "alice@example.com"})
+	usr, db, _, _ := newTestAuthService(store)
+	mails := mailer.NewMemorySender()
+	usr.mail = mails
+
+	release := holdUserLookup(db)
+	done := make(chan error, 1)
+	go func() { done <- usr.ForgotPassword(context.Background(), user.Email) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the answer waits for the user lookup")
+	}
+
+	release()
+	usr.jobs.Wait()
+
+	msg, ok := mails.Last(user.Email)
+	if !ok {
+		t.Fatal("no reset email")
+	}
+	_, query, ok := strings.Cut(msg.Body, "/reset-password?")
+	if !ok {
+		t.Fatalf("no reset link in %q", msg.Body)
+	}
+	values, err := url.ParseQuery(strings.Fields(query)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.userTokens) != 1 {
+		t.Fatalf("%d user tokens, want 1", len(store.userTokens))
+	}
+	token := store.userTokens[0]
+	if token.UserID != user.ID || token.Purpose != passwordResetPurpose {
+		t.Errorf("token of %v for %q", token.UserID, token.Purpose)
+	}
+	if token.TokenHash != securetoken.Hash(values.Get("token")) {
+		t.Error("the emailed token isn't the stored one")
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	usr, db, _, _ := newTestAuthService(newFakeStore())
+	mails := mailer.NewMemorySender()
+	usr.mail = mails
+
+	release := holdUserLookup(db)
+	if err := usr.ForgotPassword(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	usr.jobs.Wait()
+
+	if n := len(mails.Messages()); n != 0 {
+		t.Errorf("%d emails sent, want 0", n)
+	}
+	if n := db.ran("CreateUserToken"); n != 0 {
+		t.Errorf("%d tokens created, want 0", n)
+	}
+}
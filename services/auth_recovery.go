@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+const (
+	// number of codes in a recovery set
+	recoveryCodeCount = 10
+	// 10 random bytes give 16 base32 characters (80 bits)
+	recoveryCodeBytes = 10
+)
+
+// second factor methods accepted by verifySecondFactor
+const (
+	factorTOTP         = "totp"
+	factorRecoveryCode = "recovery_code"
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode returns a code formatted as xxxx-xxxx-xxxx-xxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := strings.ToLower(recoveryEncoding.EncodeToString(b))
+	groups := make([]string, 0, len(raw)/4)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeRecoveryCode drops separators and case so a code typed by hand
+// matches the stored hash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// replaceRecoveryCodes drops the previous set of the user and stores a new
+// one, only the hashes are kept so the plain codes are returned once
+func replaceRecoveryCodes(ctx context.Context, qtx *sqlc.Queries, userID pgtype.UUID) ([]string, error) {
+
+	if err := qtx.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		err = qtx.CreateRecoveryCode(ctx, sqlc.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: securetoken.Hash(normalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts a code from the authenticator app or an unused
+// recovery code, a recovery code is consumed atomically so it works only once.
+// It returns the method that matched
+func (usr *AuthService) verifySecondFactor(ctx context.Context, qtx *sqlc.Queries, user *sqlc.User, code string) (string, error) {
+
+	valid, err := usr.verifyTOTP(ctx, qtx, user, code)
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if valid {
+		return factorTOTP, nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized != "" {
+		rows, err := qtx.UseRecoveryCode(ctx, sqlc.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: securetoken.Hash(normalized),
+		})
+		if err != nil {
+			return "", &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		if rows == 1 {
+			return factorRecoveryCode, nil
+		}
+	}
+
+	return "", &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "INVALID_TOTP",
+		Err:     "Invalid TOTP or recovery code",
+		Details: nil,
+	}
+}
+
+// RegenerateRecoveryCodes replaces the recovery set of the user, the previous
+// codes stop working
+func (usr *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID pgtype.UUID, TOTP string, client *ClientInfo) ([]string, error) {
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		logger.Error("error when startsing a transaction",
+			zap.String("context", "error in function start transaction from utils"),
+			zap.Error(err),
+		)
+
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	user, err := qtx.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &dtos.ApiErr{
+				Status:  404,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return nil, &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if !user.TwoFaEnabled.Bool {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusConflict,
+			Code:    "2FA_NOT_ENABLED",
+			Err:     "2FA is not enabled",
+			Details: nil,
+		}
+	}
+
+	// the code is guessed like at login
+	lockKey := lockout.SecondFactorKey(userID.String())
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return nil, err
+	}
+
+	if _, err = usr.verifySecondFactor(ctx, qtx, &user, TOTP); err != nil {
+		logger.Info("failed recovery codes regeneration, invalid code",
+			zap.String("userId", userID.String()),
+		)
+		usr.recordRejection(ctx, lockKey, client, err)
+		return nil, err
+	}
+	usr.recordSuccess(ctx, lockKey)
+
+	codes, err := replaceRecoveryCodes(ctx, qtx, userID)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = recordAuditEvent(ctx, qtx, userID, auditRecoveryCodesRegenerated, client, nil); err != nil {
+		logger.Error("failed to record audit event",
+			zap.String("event", auditRecoveryCodesRegenerated),
+			zap.Error(err),
+		)
+		return nil, &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error("failed to regenerate recovery codes",
+			zap.String("commit", "failed"),
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("recovery codes regenerated",
+		zap.String("userId", userID.String()),
+	)
+	return codes, nil
+}
+
+// RemainingRecoveryCodes counts the unused codes of the user
+func (usr *AuthService) RemainingRecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error) {
+
+	remaining, err := usr.queries.CountRemainingRecoveryCodes(ctx, userID)
+	if err != nil {
+		return 0, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return remaining, nil
+}
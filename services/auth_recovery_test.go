@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+)
+
+// withRecoveryCode makes every recovery code valid, the fake store doesn't
+// keep them
+func withRecoveryCode(usr *AuthService) *fakeDB {
+	db := usr.db.(*fakeDB)
+	db.exec["UseRecoveryCode"] = func(args []any) (int64, error) {
+		return 1, nil
+	}
+	db.one["CountRemainingRecoveryCodes"] = func(args []any) (any, error) {
+		return int64(9), nil
+	}
+	return db
+}
+
+func TestValidateTOTPRecoveryCodeKeptWhenTheSessionFails(t *testing.T) {
+	usr, _, user := newTOTPUser(t)
+	db := withRecoveryCode(usr)
+	tokens := usr.tokens.(*fakeTokens)
+	temp := &jwtImpl.TempTOTPTokenClaims{UserID: user.ID, TOTP: true, AMR: []string{amrPassword}}
+
+	tokens.err = errors.New("connection reset")
+	if _, _, err := usr.ValidateTOTP(context.Background(), temp, "abcde-12345", nil); errCode(t, err) != "INTERNAL_ERROR" {
+		t.Fatalf("got %v, want INTERNAL_ERROR", err)
+	}
+	if slices.Contains(db.committed, "UseRecoveryCode") || slices.Contains(db.committed, "CreateAuditEvent") {
+		t.Fatalf("the code was consumed without a session: %v", db.committed)
+	}
+
+	tokens.err = nil
+	if _, _, err := usr.ValidateTOTP(context.Background(), temp, "abcde-12345", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(db.committed, "UseRecoveryCode") || !slices.Contains(db.committed, "CreateAuditEvent") {
+		t.Errorf("the code isn't consumed with the session: %v", db.committed)
+	}
+}
+
+func TestStepUpRecoveryCodeConsumedWithItsAudit(t *testing.T) {
+	usr, _, user := newTOTPUser(t)
+	db := withRecoveryCode(usr)
+	claims := &jwtImpl.CustomAccessTokenClaims{UserID: user.ID, Role: user.Role, AMR: []string{amrPassword}}
+
+	// the audit event can't be stored, the step up fails and keeps the code
+	audit := db.exec["CreateAuditEvent"]
+	db.exec["CreateAuditEvent"] = func(args []any) (int64, error) {
+		return 0, errors.New("connection reset")
+	}
+	if _, _, err := usr.StepUp(context.Background(), claims, "abcde-12345", nil); errCode(t, err) != "INTERNAL_ERROR" {
+		t.Fatalf("got %v, want INTERNAL_ERROR", err)
+	}
+	if slices.Contains(db.committed, "UseRecoveryCode") {
+		t.Fatal("the code was consumed by a failed step up")
+	}
+
+	db.exec["CreateAuditEvent"] = audit
+	if _, _, err := usr.StepUp(context.Background(), claims, "abcde-12345", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(db.committed, "UseRecoveryCode") {
+		t.Errorf("the code isn't consumed with the step up: %v", db.committed)
+	}
+}
+
+func TestValidateTOTPNotOffered(t *testing.T) {
+	usr, _, user := newTOTPUser(t)
+	db := usr.db.(*fakeDB)
+	db.one["CountRemainingRecoveryCodes"] = func(args []any) (any, error) {
+		return int64(0), nil
+	}
+
+	// the password step offered another factor
+	temp := &jwtImpl.TempTOTPTokenClaims{UserID: user.ID, SMS: true, AMR: []string{amrPassword}}
+	if _, _, err := usr.ValidateTOTP(context.Background(), temp, "abcde-12345", nil); errCode(t, err) != "TOTP_NOT_ENABLED" {
+		t.Fatalf("got %v, want TOTP_NOT_ENABLED", err)
+	}
+	if n := db.ran("UseRecoveryCode"); n != 0 {
+		t.Errorf("a recovery code was tried %d times", n)
+	}
+
+	// a recovery code still answers it
+	withRecoveryCode(usr)
+	if _, _, err := usr.ValidateTOTP(context.Background(), temp, "abcde-12345", nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,39 +5,102 @@ import (
 	"database/sql"
 	"errors"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
 	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
 	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mailer"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/internal/secretbox"
+	"github.com/BigBr41n/echoAuth/internal/sms"
 	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
 	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/pquerna/otp/totp"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthServiceI interface {
 	SignUp(ctx context.Context, userData *dtos.CreateUserDTO) (pgtype.UUID, error)
-	Login(ctx context.Context, creds *Credentials) (string, string, error)
-	RefreshUserToken(reftok string, oldtok string) (string, error)
-	ValidateTOTP(ctx context.Context, userID pgtype.UUID, TOTP string) (string, string, error)
-	Enable2FA(ctx context.Context, userEmail string, userID pgtype.UUID, enable bool) (string, string, error)
+	Login(ctx context.Context, creds *Credentials, client *ClientInfo) (string, string, error)
+	RefreshUserToken(ctx context.Context, refTok string) (string, string, error)
+	Logout(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) error
+	LogoutAll(ctx context.Context, userID pgtype.UUID) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	ChangePassword(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, change *PasswordChange, client *ClientInfo) (string, string, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	ValidateTOTP(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims, TOTP string, client *ClientInfo) (string, string, error)
+	Setup2FA(ctx context.Context, userID pgtype.UUID, userEmail string, TOTP string) (string, string, error)
+	Confirm2FA(ctx context.Context, userID pgtype.UUID, TOTP string) ([]string, error)
+	Disable2FA(ctx context.Context, userID pgtype.UUID, password string, TOTP string, client *ClientInfo) error
+	RegenerateRecoveryCodes(ctx context.Context, userID pgtype.UUID, TOTP string, client *ClientInfo) ([]string, error)
+	RemainingRecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error)
+	BeginWebAuthnRegistration(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) (*dtos.WebAuthnOptionsDTO, error)
+	FinishWebAuthnRegistration(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, input *dtos.WebAuthnRegisterDTO, client *ClientInfo) (*dtos.WebAuthnCredentialDTO, error)
+	ListWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) ([]dtos.WebAuthnCredentialDTO, error)
+	DeleteWebAuthnCredential(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, credentialID pgtype.UUID, client *ClientInfo) error
+	EnableWebAuthnSecondFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error
+	DisableWebAuthnSecondFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error
+	BeginWebAuthnLogin(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims) (*dtos.WebAuthnOptionsDTO, error)
+	FinishWebAuthnLogin(ctx context.Context, input *dtos.WebAuthnLoginDTO, client *ClientInfo) (string, string, error)
+	ListFactors(ctx context.Context, userID pgtype.UUID) (*dtos.FactorsDTO, error)
+	SetPreferredFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, factor string) error
+	EnableEmailOTP(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error
+	DisableEmailOTP(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error
+	SendEmailOTP(ctx context.Context, userID pgtype.UUID) error
+	ValidateEmailOTP(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims, code string, client *ClientInfo) (string, string, error)
+	EnrollSMS(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, phoneNumber string) (string, error)
+	ConfirmSMS(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, code string, client *ClientInfo) error
+	DisableSMS(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error
+	SendSMSOTP(ctx context.Context, userID pgtype.UUID) (string, error)
+	ValidateSMSOTP(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims, code string, client *ClientInfo) (string, string, error)
+	RequestMagicLink(ctx context.Context, email string) (string, error)
+	ConsumeMagicLink(ctx context.Context, token string, nonce string) (string, error)
+	ExchangeMagicLinkCode(ctx context.Context, code string, nonce string, client *ClientInfo) (string, string, error)
+	StepUp(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, TOTP string, client *ClientInfo) (string, time.Time, error)
+	HasTOTP(ctx context.Context, userID pgtype.UUID) (bool, error)
+	PurgeChallenges(ctx context.Context) error
 }
 
 type AuthService struct {
-	queries *sqlc.Queries
-	db      *pgxpool.Pool
+	queries  *sqlc.Queries
+	db       transaction.Beginner
+	tokens   TokenServiceI
+	mail     mailer.Sender
+	secrets  *secretbox.Keyring
+	guard    *lockout.Guard
+	passkeys *webauthn.WebAuthn
+	sms      sms.SMSSender
+	// counts the codes sent to each phone number
+	limiter ratelimit.Limiter
+	// emails and lookups running after the response (runInBackground)
+	jobs sync.WaitGroup
 }
 
-func NewAuthService(qrs *sqlc.Queries, pgdb *pgxpool.Pool) AuthServiceI {
+func NewAuthService(qrs *sqlc.Queries, pgdb *pgxpool.Pool, tokSrv TokenServiceI, mail mailer.Sender, secrets *secretbox.Keyring, guard *lockout.Guard, passkeys *webauthn.WebAuthn, smsSender sms.SMSSender, limiter ratelimit.Limiter) AuthServiceI {
 	return &AuthService{
-		queries: qrs,
-		db:      pgdb,
+		queries:  qrs,
+		db:       pgdb,
+		tokens:   tokSrv,
+		mail:     mail,
+		secrets:  secrets,
+		guard:    guard,
+		passkeys: passkeys,
+		sms:      smsSender,
+		limiter:  limiter,
 	}
 }
 
@@ -46,6 +109,19 @@ type Credentials struct {
 	Password string
 }
 
+type PasswordChange struct {
+	CurrentPassword string
+	NewPassword     string
+	TOTP            string
+}
+
+// ClientInfo describes the device a session is opened from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+	Protocol  string
+}
+
 func (usr *AuthService) SignUp(ctx context.Context, userData *dtos.CreateUserDTO) (pgtype.UUID, error) {
 
 	tx, err := transaction.StartTransaction(ctx, usr.db)
@@ -132,13 +208,36 @@ func (usr *AuthService) SignUp(ctx context.Context, userData *dtos.CreateUserDTO
 		}
 	}
 
+	// the user can still ask for a new link if this one fails
+	if err = usr.sendVerificationEmail(ctx, user.ID, user.Email, user.Username); err != nil {
+		logger.Error("failed to send verification email",
+			zap.String("userId", user.ID.String()),
+			zap.Error(err),
+		)
+	}
+
 	return user.ID, nil
 }
 
-func (usr *AuthService) Login(ctx context.Context, creds *Credentials) (string, string, error) {
+func (usr *AuthService) Login(ctx context.Context, creds *Credentials, client *ClientInfo) (string, string, error) {
+
+	// too many failures on this email or from this ip
+	lockKey := lockout.LoginKey(creds.Email)
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return "", "", err
+	}
 
 	user, err := usr.queries.GetUserByEmail(ctx, creds.Email)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			usr.recordFailure(ctx, lockKey, client)
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusUnauthorized,
+				Code:    "INVALID_CREDENTIALS",
+				Err:     "Invalid email or password",
+				Details: nil,
+			}
+		}
 		logger.Error("failed to login",
 			zap.String("reason", err.Error()),
 			zap.Error(err),
@@ -157,6 +256,7 @@ func (usr *AuthService) Login(ctx context.Context, creds *Credentials) (string,
 		logger.Error("failed password checking operation",
 			zap.String("user", user.ID.String()),
 		)
+		usr.recordFailure(ctx, lockKey, client)
 		return "", "", &dtos.ApiErr{
 			Status:  http.StatusUnauthorized,
 			Code:    "INVALID_CREDENTIALS",
@@ -165,13 +265,73 @@ func (usr *AuthService) Login(ctx context.Context, creds *Credentials) (string,
 		}
 	}
 
-	// if the user has 2fa enabled
-	if user.TwoFaEnabled.Bool {
+	usr.recordSuccess(ctx, lockKey)
+
+	// the address must be confirmed before the first login
+	if config.AppConfig.RequireEmailVerification && !user.EmailVerifiedAt.Valid {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusForbidden,
+			Code:    "EMAIL_NOT_VERIFIED",
+			Err:     "Email address is not verified",
+			Details: nil,
+		}
+	}
+
+	return usr.continueLogin(ctx, &sqlc.User{
+		ID:                   user.ID,
+		Role:                 user.Role,
+		Email:                user.Email,
+		TwoFaEnabled:         user.TwoFaEnabled,
+		TokenVersion:         user.TokenVersion,
+		EmailOtpEnabled:      user.EmailOtpEnabled,
+		PreferredFactor:      user.PreferredFactor,
+		SmsOtpEnabled:        user.SmsOtpEnabled,
+		WebauthnSecondFactor: user.WebauthnSecondFactor,
+	}, []string{amrPassword}, client)
+}
+
+// continueLogin follows the first step of a login (password, magic link):
+// the user gets the temp token of the second factor step when one is
+// enrolled, the session otherwise. amr lists the methods of the first step
+func (usr *AuthService) continueLogin(ctx context.Context, user *sqlc.User, amr []string, client *ClientInfo) (string, string, error) {
+
+	// a registered passkey is a second factor too once the user opted in
+	passkeys, err := usr.queries.CountWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	factors := enrolledFactors(user, passkeys)
+
+	// a code sent to the mailbox proves nothing more after a magic link
+	if slices.Contains(amr, amrEmail) && slices.Contains(factors, factorEmail) {
+		factors = slices.DeleteFunc(factors, func(f string) bool { return f == factorEmail })
+		if len(factors) == 0 {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusForbidden,
+				Code:    "PASSWORD_REQUIRED",
+				Err:     "The email code can't be the second factor of a magic link, login with your password",
+				Details: nil,
+			}
+		}
+	}
+
+	// if the user has a second factor enrolled
+	if len(factors) > 0 {
 		claims := &jwtImpl.TempTOTPTokenClaims{
-			UserID: user.ID,
-			Role:   user.Role,
-			Email:  creds.Email,
-			TOTP:   true,
+			UserID:   user.ID,
+			Role:     user.Role,
+			Email:    user.Email,
+			TOTP:     slices.Contains(factors, factorTOTP),
+			WebAuthn: slices.Contains(factors, factorWebAuthn),
+			SMS:      slices.Contains(factors, factorSMS),
+			EmailOTP: slices.Contains(factors, factorEmail),
+			AMR:      amr,
 			RegisteredClaims: jwt.RegisteredClaims{
 				ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
 				IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -193,20 +353,53 @@ func (usr *AuthService) Login(ctx context.Context, creds *Credentials) (string,
 			}
 		}
 
-		return tempToken, "TOTP", nil
+		// the code of the preferred factor is sent right away, the user can
+		// ask for it later when another factor is offered first
+		factor := chooseFactor(factors, user.PreferredFactor)
+		switch factor {
+		case factorSMS:
+			if _, err := usr.SendSMSOTP(ctx, user.ID); err != nil {
+				logger.Error("failed to send the sms otp",
+					zap.String("userId", user.ID.String()),
+					zap.Error(err),
+				)
+			}
+		case factorEmail:
+			if err := usr.SendEmailOTP(ctx, user.ID); err != nil {
+				logger.Error("failed to send the email otp",
+					zap.String("userId", user.ID.String()),
+					zap.Error(err),
+				)
+			}
+		}
+
+		// the temp token is accepted by /validate-totp, /webauthn/login,
+		// /validate-sms-otp and /validate-email-otp
+		return tempToken, strings.ToUpper(factor), nil
 	}
 
+	return usr.openSession(ctx, nil, user, amr, client)
+}
+
+// openSession issues the token pair of a completed login, amr lists the
+// methods the user went through. qtx is the transaction of the second factor
+// step when it consumed something, nil otherwise
+func (usr *AuthService) openSession(ctx context.Context, qtx *sqlc.Queries, user *sqlc.User, amr []string, client *ClientInfo) (string, string, error) {
 	claims := &jwtImpl.CustomAccessTokenClaims{
-		UserID: user.ID,
-		Role:   user.Role,
-		Email:  user.Email,
+		UserID:       user.ID,
+		Role:         user.Role,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		AMR:          amr,
+		ACR:          acrFor(amr),
+		AuthTime:     jwt.NewNumericDate(time.Now()),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(9 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	accessToken, refreshToken, err := jwtImpl.GenerateToken(claims)
+	accessToken, refreshToken, err := usr.tokens.StartSession(ctx, qtx, claims, client)
 	if err != nil {
 		logger.Error("failed to login",
 			zap.String("reason", err.Error()),
@@ -222,32 +415,141 @@ func (usr *AuthService) Login(ctx context.Context, creds *Credentials) (string,
 
 	logger.Info("User logged in",
 		zap.String("userId", user.ID.String()),
+		zap.Strings("amr", amr),
 	)
 	return accessToken, refreshToken, nil
 }
 
-func (usr *AuthService) RefreshUserToken(refTok string, oldTok string) (string, error) {
-	newRefTok, err := jwtImpl.RefreshAccessToken(refTok, oldTok)
+func (usr *AuthService) RefreshUserToken(ctx context.Context, refTok string) (string, string, error) {
+	// tokens of oauth clients are refreshed by /oauth/token
+	return usr.tokens.RotateRefreshToken(ctx, refTok, "")
+}
+
+func (usr *AuthService) Logout(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) error {
+	if err := usr.tokens.RevokeSession(ctx, claims); err != nil {
+		return err
+	}
+
+	logger.Info("User logged out",
+		zap.String("userId", claims.UserID.String()),
+	)
+	return nil
+}
+
+func (usr *AuthService) LogoutAll(ctx context.Context, userID pgtype.UUID) error {
+	if err := usr.tokens.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	logger.Info("User logged out from all sessions",
+		zap.String("userId", userID.String()),
+	)
+	return nil
+}
+
+// Setup2FA generates a new TOTP secret kept as pending until it's confirmed,
+// replacing an active secret requires a valid code from it
+func (usr *AuthService) Setup2FA(ctx context.Context, userID pgtype.UUID, userEmail string, TOTP string) (string, string, error) {
 
+	user, err := usr.queries.GetUserByID(ctx, userID)
 	if err != nil {
-		logger.Error("failed to refresh the token",
-			zap.String("reason", err.Error()),
-			zap.Error(err),
-		)
-		return "", &dtos.ApiErr{
-			Status:  http.StatusInternalServerError,
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", &dtos.ApiErr{
+				Status:  404,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return "", "", &dtos.ApiErr{
+			Status:  500,
 			Code:    "INTERNAL_ERROR",
 			Err:     err.Error(),
 			Details: nil,
 		}
 	}
 
-	return newRefTok, nil
+	// re-enrollment over an active secret, prove the old one is still owned
+	if user.TwoFaEnabled.Bool {
+		if TOTP == "" {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusUnauthorized,
+				Code:    "TOTP_REQUIRED",
+				Err:     "2FA is already enabled, a code from the current authenticator is required",
+				Details: nil,
+			}
+		}
+		valid, err := usr.verifyTOTP(ctx, usr.queries, &user, TOTP)
+		if err != nil {
+			return "", "", &dtos.ApiErr{
+				Status:  500,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		if !valid {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusUnauthorized,
+				Code:    "INVALID_TOTP",
+				Err:     "Invalid TOTP code",
+				Details: nil,
+			}
+		}
+	}
+
+	// genrating the totp
+	key, err := generateTOTPKey(userEmail)
+
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	secretKey := key.Secret()
+	qrCode := key.URL()
+
+	// only the encrypted secret is stored
+	sealedSecret, err := usr.sealTOTPSecret(userID, secretKey)
+	if err != nil {
+		logger.Error("failed to encrypt the totp secret", zap.Error(err))
+		return "", "", &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// stays pending, 2FA is enabled only once a code from it is confirmed
+	err = usr.queries.StorePendingSecret2FA(ctx, sqlc.StorePendingSecret2FAParams{
+		ID: userID,
+		TotpPendingSecret: pgtype.Text{
+			String: sealedSecret,
+			Valid:  true,
+		},
+	})
+
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return secretKey, qrCode, nil
 }
 
-func (usr *AuthService) Enable2FA(ctx context.Context, userEmail string, userID pgtype.UUID, enable bool) (string, string, error) {
+// Confirm2FA activates the pending secret once a valid code from it is given,
+// the recovery codes returned are shown to the user only once
+func (usr *AuthService) Confirm2FA(ctx context.Context, userID pgtype.UUID, TOTP string) ([]string, error) {
 
-	// start a transaction
 	tx, err := transaction.StartTransaction(ctx, usr.db)
 	if err != nil {
 		logger.Error("error when startsing a transaction",
@@ -255,7 +557,7 @@ func (usr *AuthService) Enable2FA(ctx context.Context, userEmail string, userID
 			zap.Error(err),
 		)
 
-		return "", "", &dtos.ApiErr{
+		return nil, &dtos.ApiErr{
 			Status:  http.StatusInternalServerError,
 			Code:    "INTERNAL_ERROR",
 			Err:     err.Error(),
@@ -265,26 +567,17 @@ func (usr *AuthService) Enable2FA(ctx context.Context, userEmail string, userID
 	defer tx.Rollback(ctx)
 	qtx := usr.queries.WithTx(tx)
 
-	// enable 2FA in the DB
-	_, err = qtx.Set2FAStatus(ctx, sqlc.Set2FAStatusParams{
-		ID: userID,
-		TwoFaEnabled: pgtype.Bool{
-			Bool:  enable,
-			Valid: true,
-		},
-	})
-
+	user, err := qtx.GetUserByID(ctx, userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", "", &dtos.ApiErr{
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &dtos.ApiErr{
 				Status:  404,
 				Code:    "USER_NOT_FOUND",
-				Err:     "User not found or no update occurred",
+				Err:     "User not found",
 				Details: nil,
 			}
 		}
-
-		return "", "", &dtos.ApiErr{
+		return nil, &dtos.ApiErr{
 			Status:  500,
 			Code:    "INTERNAL_ERROR",
 			Err:     err.Error(),
@@ -292,14 +585,19 @@ func (usr *AuthService) Enable2FA(ctx context.Context, userEmail string, userID
 		}
 	}
 
-	// genrating the totp
-	key, err := totp.Generate(totp.GenerateOpts{
-		Issuer:      "goEchoAuthApp",
-		AccountName: userEmail,
-	})
+	if !user.TotpPendingSecret.Valid {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusConflict,
+			Code:    "NO_PENDING_2FA",
+			Err:     "No pending 2FA setup, start with /2FA/setup",
+			Details: nil,
+		}
+	}
 
+	pendingSecret, err := usr.openTOTPSecret(userID, user.TotpPendingSecret)
 	if err != nil {
-		return "", "", &dtos.ApiErr{
+		logger.Error("failed to decrypt the pending totp secret", zap.Error(err))
+		return nil, &dtos.ApiErr{
 			Status:  500,
 			Code:    "INTERNAL_ERROR",
 			Err:     err.Error(),
@@ -307,35 +605,63 @@ func (usr *AuthService) Enable2FA(ctx context.Context, userEmail string, userID
 		}
 	}
 
-	secretKey := key.Secret()
-	qrCode := key.URL()
+	step, valid := matchTOTPStep(TOTP, pendingSecret, time.Now())
+	if !valid {
+		logger.Info("Invalid 2FA confirmation", zap.String("userID", userID.String()))
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "INVALID_TOTP",
+			Err:     "Invalid TOTP code",
+			Details: nil,
+		}
+	}
 
-	err = qtx.StoreSecret2FA(ctx, sqlc.StoreSecret2FAParams{
-		ID: userID,
-		TotpSecret: pgtype.Text{
-			String: secretKey,
-			Valid:  true,
+	// activate only the secret the code was checked against
+	rows, err := qtx.ActivatePendingSecret2FA(ctx, sqlc.ActivatePendingSecret2FAParams{
+		ID:                userID,
+		TotpPendingSecret: user.TotpPendingSecret,
+		// the confirmation code can't be replayed on the new secret
+		TotpLastStep: pgtype.Int8{
+			Int64: step,
+			Valid: true,
 		},
 	})
-
 	if err != nil {
-		return "", "", &dtos.ApiErr{
+		return nil, &dtos.ApiErr{
 			Status:  500,
 			Code:    "INTERNAL_ERROR",
 			Err:     err.Error(),
 			Details: nil,
 		}
 	}
+	if rows == 0 {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusConflict,
+			Code:    "NO_PENDING_2FA",
+			Err:     "The pending 2FA setup changed, start again",
+			Details: nil,
+		}
+	}
 
-	err = tx.Commit(ctx)
+	// a new secret gets a new recovery set
+	codes, err := replaceRecoveryCodes(ctx, qtx, userID)
 	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
 		logger.Error("failed to enable 2fa",
 			zap.String("commit", "failed"),
 			zap.String("reason", err.Error()),
 			zap.Error(err),
 		)
 
-		return "", "", &dtos.ApiErr{
+		return nil, &dtos.ApiErr{
 			Status:  http.StatusInternalServerError,
 			Code:    "INTERNAL_ERROR",
 			Err:     err.Error(),
@@ -343,10 +669,165 @@ func (usr *AuthService) Enable2FA(ctx context.Context, userEmail string, userID
 		}
 	}
 
-	return secretKey, qrCode, nil
+	logger.Info("2FA enabled",
+		zap.String("userId", userID.String()),
+	)
+	return codes, nil
+}
+
+// Disable2FA turns 2FA off after checking the password and a code or a
+// recovery code, every session of the user is revoked
+func (usr *AuthService) Disable2FA(ctx context.Context, userID pgtype.UUID, password string, TOTP string, client *ClientInfo) error {
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		logger.Error("error when startsing a transaction",
+			zap.String("context", "error in function start transaction from utils"),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	user, err := qtx.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &dtos.ApiErr{
+				Status:  404,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// the password and the code are guessed like at login, the same keys
+	// count the failures
+	loginKey := lockout.LoginKey(user.Email)
+	secondFactorKey := lockout.SecondFactorKey(userID.String())
+	if err := usr.checkLockouts(ctx, client, loginKey, secondFactorKey); err != nil {
+		return err
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		logger.Info("failed 2FA disable, wrong password",
+			zap.String("userId", userID.String()),
+		)
+		usr.recordFailure(ctx, loginKey, client)
+		return &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    "INVALID_CREDENTIALS",
+			Err:     "Invalid password",
+			Details: nil,
+		}
+	}
+	usr.recordSuccess(ctx, loginKey)
+
+	if !user.TwoFaEnabled.Bool {
+		return &dtos.ApiErr{
+			Status:  http.StatusConflict,
+			Code:    "2FA_NOT_ENABLED",
+			Err:     "2FA is not enabled",
+			Details: nil,
+		}
+	}
+
+	if _, err = usr.verifySecondFactor(ctx, qtx, &user, TOTP); err != nil {
+		logger.Info("failed 2FA disable, invalid code",
+			zap.String("userId", userID.String()),
+		)
+		usr.recordRejection(ctx, secondFactorKey, client, err)
+		return err
+	}
+	usr.recordSuccess(ctx, secondFactorKey)
+
+	if err = qtx.Disable2FA(ctx, userID); err != nil {
+		return &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = qtx.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = recordAuditEvent(ctx, qtx, userID, auditTwoFADisabled, client, nil); err != nil {
+		logger.Error("failed to record audit event",
+			zap.String("event", auditTwoFADisabled),
+			zap.Error(err),
+		)
+		return &dtos.ApiErr{
+			Status:  500,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error("failed to disable 2fa",
+			zap.String("commit", "failed"),
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// the sessions were opened with the second factor, end them all
+	if err = usr.tokens.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	logger.Info("2FA disabled",
+		zap.String("userId", userID.String()),
+	)
+	return nil
+}
+
+func totpNotEnabledErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "TOTP_NOT_ENABLED",
+		Err:     "Authenticator codes are not enabled for this account",
+		Details: nil,
+	}
 }
 
-func (usr *AuthService) ValidateTOTP(ctx context.Context, userID pgtype.UUID, TOTP string) (string, string, error) {
+func (usr *AuthService) ValidateTOTP(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims, TOTP string, client *ClientInfo) (string, string, error) {
+	userID := temp.UserID
+
+	// a 6 digits code can't be guessed within the temp token lifetime
+	lockKey := lockout.SecondFactorKey(userID.String())
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return "", "", err
+	}
 
 	user, err := usr.queries.GetUserByID(ctx, userID)
 
@@ -366,35 +847,74 @@ func (usr *AuthService) ValidateTOTP(ctx context.Context, userID pgtype.UUID, TO
 			Details: nil,
 		}
 	}
-	// validate the totp
-	valid := totp.Validate(TOTP, user.TotpSecret.String)
-	if !valid {
-		logger.Info("Invalid login", zap.String("userID", userID.String()), zap.String("user OTP", TOTP))
+
+	// only when the password step offered it, like the sms and email codes;
+	// the recovery codes stay usable when the other factor is lost
+	if !temp.TOTP {
+		remaining, err := usr.queries.CountRemainingRecoveryCodes(ctx, userID)
+		if err != nil {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		if remaining == 0 {
+			return "", "", totpNotEnabledErr()
+		}
+	}
+
+	// the recovery code (or the totp step) is consumed along with the
+	// session, a failed login leaves it usable
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
 		return "", "", &dtos.ApiErr{
-			Status:  http.StatusUnauthorized,
-			Code:    "INVALID_TOTP",
-			Err:     "Invalid TOTP code",
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
 			Details: nil,
 		}
 	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
 
-	claims := &jwtImpl.CustomAccessTokenClaims{
-		UserID: user.ID,
-		Role:   user.Role,
-		Email:  user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(9 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	// validate the totp or consume a recovery code
+	method, err := usr.verifySecondFactor(ctx, qtx, &user, TOTP)
+	if err != nil {
+		logger.Info("Invalid login", zap.String("userID", userID.String()))
+		usr.recordRejection(ctx, lockKey, client, err)
+		return "", "", err
 	}
+	usr.recordSuccess(ctx, lockKey)
 
-	// generate the auth tokens (access & refresh)
-	accessToken, refreshToken, err := jwtImpl.GenerateToken(claims)
-	if err != nil {
-		logger.Error("failed to login",
-			zap.String("reason", err.Error()),
-			zap.Error(err),
+	if method == factorRecoveryCode {
+		remaining, err := qtx.CountRemainingRecoveryCodes(ctx, userID)
+		if err != nil {
+			logger.Warn("failed to count recovery codes", zap.Error(err))
+		}
+		logger.Warn("recovery code used to login",
+			zap.String("userId", userID.String()),
+			zap.Int64("remaining", remaining),
 		)
+		details := map[string]any{"remaining": remaining}
+		if err = recordAuditEvent(ctx, qtx, userID, auditRecoveryCodeUsed, client, details); err != nil {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+	}
+
+	// recovery codes are one time passwords too
+	accessToken, refreshToken, err := usr.openSession(ctx, qtx, &user, withSecondFactor(temp.AMR, amrOTP), client)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
 		return "", "", &dtos.ApiErr{
 			Status:  http.StatusInternalServerError,
 			Code:    "INTERNAL_ERROR",
@@ -402,9 +922,5 @@ func (usr *AuthService) ValidateTOTP(ctx context.Context, userID pgtype.UUID, TO
 			Details: nil,
 		}
 	}
-
-	logger.Error("User logged in",
-		zap.String("userId", user.ID.String()),
-	)
 	return accessToken, refreshToken, nil
 }
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/ratelimit"
+	"github.com/BigBr41n/echoAuth/internal/sms"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+const (
+	smsOTPDigits = 6
+	smsOTPTTL    = 10 * time.Minute
+	// wrong codes accepted before the code is dropped, the lockout of the
+	// second factor still applies
+	smsOTPMaxAttempts = 5
+	// a new code can't be asked more than once a minute
+	smsOTPResendDelay = time.Minute
+)
+
+// a code proves the number while enrolling it, or finishes a login
+const (
+	smsPurposeEnroll = "enroll"
+	smsPurposeLogin  = "login"
+)
+
+// amr of a login finished with a code sent by sms (RFC 8176)
+const amrSMS = "sms"
+
+func smsOTPNotEnabledErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "SMS_OTP_NOT_ENABLED",
+		Err:     "Sms codes are not enabled for this account",
+		Details: nil,
+	}
+}
+
+func invalidSMSOTPErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "INVALID_SMS_OTP",
+		Err:     "Invalid or expired sms code",
+		Details: nil,
+	}
+}
+
+func tooManySMSErr(code string, msg string, wait time.Duration) *dtos.ApiErr {
+	seconds := int(math.Ceil(wait.Seconds()))
+	return &dtos.ApiErr{
+		Status:  http.StatusTooManyRequests,
+		Code:    code,
+		Err:     msg,
+		Details: map[string]any{"retryAfter": seconds},
+		Headers: map[string]string{"Retry-After": strconv.Itoa(seconds)},
+	}
+}
+
+// EnrollSMS sends a code to the number to prove the user owns it, the factor
+// is enabled by ConfirmSMS. It returns the normalized number, masked
+func (usr *AuthService) EnrollSMS(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, phoneNumber string) (string, error) {
+	_, factors, err := usr.userFactors(ctx, claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	if err := requireMFA(factors, claims); err != nil {
+		return "", err
+	}
+
+	number, err := sms.NormalizeE164(phoneNumber, config.AppConfig.SMSDefaultCountryCode)
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "INVALID_PHONE_NUMBER",
+			Err:     "Invalid phone number, use the international format (+33612345678)",
+			Details: nil,
+		}
+	}
+
+	if err := usr.sendSMSOTP(ctx, claims.UserID, number, smsPurposeEnroll); err != nil {
+		return "", err
+	}
+	return sms.Mask(number), nil
+}
+
+// ConfirmSMS checks the code sent by EnrollSMS, the number becomes the one of
+// the sms codes
+func (usr *AuthService) ConfirmSMS(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, code string, client *ClientInfo) error {
+
+	// limited like the totp, the attempts counter of the code comes on top
+	lockKey := lockout.SecondFactorKey(claims.UserID.String())
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return err
+	}
+
+	smsCode, err := usr.verifySMSOTP(ctx, claims.UserID, smsPurposeEnroll, code, lockKey, client)
+	if err != nil {
+		return err
+	}
+	usr.recordSuccess(ctx, lockKey)
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	if err := qtx.SetSMSOTP(ctx, sqlc.SetSMSOTPParams{
+		ID: claims.UserID,
+		PhoneNumber: pgtype.Text{
+			String: smsCode.PhoneNumber,
+			Valid:  true,
+		},
+		SmsOtpEnabled: true,
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	details := map[string]any{"phone": sms.Mask(smsCode.PhoneNumber)}
+	if err := recordAuditEvent(ctx, qtx, claims.UserID, auditSMSOTPEnabled, client, details); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("sms otp enabled",
+		zap.String("userId", claims.UserID.String()),
+	)
+	return nil
+}
+
+// DisableSMS removes the sms codes factor, the number and the pending codes
+func (usr *AuthService) DisableSMS(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error {
+	user, factors, err := usr.userFactors(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.SmsOtpEnabled {
+		return smsOTPNotEnabledErr()
+	}
+	if err := requireMFA(factors, claims); err != nil {
+		return err
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	if err := qtx.SetSMSOTP(ctx, sqlc.SetSMSOTPParams{
+		ID:            claims.UserID,
+		PhoneNumber:   pgtype.Text{},
+		SmsOtpEnabled: false,
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	for _, purpose := range []string{smsPurposeEnroll, smsPurposeLogin} {
+		if err := qtx.DeleteSMSOTPs(ctx, sqlc.DeleteSMSOTPsParams{
+			UserID:  claims.UserID,
+			Purpose: purpose,
+		}); err != nil {
+			return &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+	}
+	if err := recordAuditEvent(ctx, qtx, claims.UserID, auditSMSOTPDisabled, client, nil); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("sms otp disabled",
+		zap.String("userId", claims.UserID.String()),
+	)
+	return nil
+}
+
+// SendSMSOTP texts a new login code to the user of a temp token, the previous
+// code stops working. It returns the number, masked
+func (usr *AuthService) SendSMSOTP(ctx context.Context, userID pgtype.UUID) (string, error) {
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if !user.SmsOtpEnabled || !user.PhoneNumber.Valid {
+		return "", smsOTPNotEnabledErr()
+	}
+
+	if err := usr.sendSMSOTP(ctx, userID, user.PhoneNumber.String, smsPurposeLogin); err != nil {
+		return "", err
+	}
+	return sms.Mask(user.PhoneNumber.String), nil
+}
+
+// ValidateSMSOTP checks the texted code of the user of a temp token and
+// opens the session
+func (usr *AuthService) ValidateSMSOTP(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims, code string, client *ClientInfo) (string, string, error) {
+	userID := temp.UserID
+
+	lockKey := lockout.SecondFactorKey(userID.String())
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return "", "", err
+	}
+
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	// only when the password step offered it, like the email codes
+	if !user.SmsOtpEnabled || !temp.SMS {
+		return "", "", smsOTPNotEnabledErr()
+	}
+
+	if _, err := usr.verifySMSOTP(ctx, userID, smsPurposeLogin, code, lockKey, client); err != nil {
+		return "", "", err
+	}
+	usr.recordSuccess(ctx, lockKey)
+
+	return usr.openSession(ctx, nil, &user, withSecondFactor(temp.AMR, amrSMS), client)
+}
+
+// sendSMSOTP replaces the codes of the user for the purpose with a new one texted to the
+// number. A number gets a limited count of codes per window whoever asks,
+// which keeps the sms bill and the annoyance of the owner low
+func (usr *AuthService) sendSMSOTP(ctx context.Context, userID pgtype.UUID, number string, purpose string) error {
+
+	active, err := usr.queries.GetActiveSMSOTP(ctx, sqlc.GetActiveSMSOTPParams{
+		UserID:  userID,
+		Purpose: purpose,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if err == nil && active.PhoneNumber == number {
+		if wait := smsOTPResendDelay - time.Since(active.CreatedAt.Time); wait > 0 {
+			return tooManySMSErr("SMS_OTP_TOO_SOON", "A code was just sent, wait before asking a new one", wait)
+		}
+	}
+
+	// the counter is kept by the rate limiter, a failing backend doesn't
+	// block the logins
+	if usr.limiter != nil && config.AppConfig.SMSRateLimit > 0 {
+		res, err := usr.limiter.Allow(ctx, "phone:"+securetoken.Hash(number), ratelimit.Rule{
+			Name:   "sms",
+			Limit:  config.AppConfig.SMSRateLimit,
+			Window: config.AppConfig.SMSRateWindow,
+		})
+		if err != nil {
+			logger.Warn("rate limiter unavailable", zap.String("rule", "sms"), zap.Error(err))
+		} else if !res.Allowed {
+			return tooManySMSErr("SMS_RATE_LIMITED", "Too many codes sent to this number, try again later", res.RetryAfter)
+		}
+	}
+
+	code, err := generateOTPCode(smsOTPDigits)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	if err := qtx.DeleteSMSOTPs(ctx, sqlc.DeleteSMSOTPsParams{
+		UserID:  userID,
+		Purpose: purpose,
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if _, err := qtx.CreateSMSOTP(ctx, sqlc.CreateSMSOTPParams{
+		UserID:      userID,
+		PhoneNumber: number,
+		Purpose:     purpose,
+		CodeHash:    otpHash(userID, code),
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(smsOTPTTL),
+			Valid: true,
+		},
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	usr.sendSMS(&sms.Message{
+		To: number,
+		Body: fmt.Sprintf("%s code: %s, valid %d minutes. Don't share it.",
+			config.AppConfig.TOTPIssuer,
+			code,
+			int(smsOTPTTL.Minutes()),
+		),
+	})
+
+	logger.Info("sms otp sent",
+		zap.String("userId", userID.String()),
+		zap.String("purpose", purpose),
+	)
+	return nil
+}
+
+// verifySMSOTP checks a code against the active one of the purpose and
+// consumes it, it returns the code to read its number
+func (usr *AuthService) verifySMSOTP(ctx context.Context, userID pgtype.UUID, purpose string, code string, lockKey string, client *ClientInfo) (*sqlc.SmsOtpCode, error) {
+	var active sqlc.SmsOtpCode
+	ch := &otpChannel{
+		name:        "SMS",
+		maxAttempts: smsOTPMaxAttempts,
+		invalidErr:  invalidSMSOTPErr,
+		active: func(ctx context.Context) (pgtype.UUID, string, error) {
+			var err error
+			active, err = usr.queries.GetActiveSMSOTP(ctx, sqlc.GetActiveSMSOTPParams{
+				UserID:  userID,
+				Purpose: purpose,
+			})
+			return active.ID, active.CodeHash, err
+		},
+		countAttempt: usr.queries.CountSMSOTPAttempt,
+		consume:      usr.queries.ConsumeSMSOTP,
+		drop: func(ctx context.Context) error {
+			return usr.queries.DeleteSMSOTPs(ctx, sqlc.DeleteSMSOTPsParams{
+				UserID:  userID,
+				Purpose: purpose,
+			})
+		},
+	}
+
+	if err := usr.verifyOTPCode(ctx, userID, ch, code, lockKey, client); err != nil {
+		return nil, err
+	}
+	return &active, nil
+}
+
+// sendSMS delivers the message in the background, like the emails
+func (usr *AuthService) sendSMS(msg *sms.Message) {
+	usr.runInBackground("sms to "+sms.Mask(msg.To), func(ctx context.Context) error {
+		return usr.sms.Send(ctx, msg)
+	})
+}
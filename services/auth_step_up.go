@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/mfapolicy"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// StepUp confirms the session with a fresh totp (or a recovery code) and
+// mints a short lived access token of the same session, its login time is now
+// and its methods include the totp. The sensitive routes and the roles bound
+// to a totp accept it, the session and its refresh token are unchanged
+func (usr *AuthService) StepUp(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, TOTP string, client *ClientInfo) (string, time.Time, error) {
+	userID := claims.UserID
+
+	lockKey := lockout.SecondFactorKey(userID.String())
+	if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+		return "", time.Time{}, err
+	}
+
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", time.Time{}, &dtos.ApiErr{
+				Status:  http.StatusNotFound,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// the step up is answered with the authenticator app, /2FA/setup first
+	if !user.TwoFaEnabled.Bool {
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusConflict,
+			Code:    mfapolicy.TOTPEnrollmentRequired,
+			Err:     "Set up your authenticator app on /api/v1/auth/2FA/setup to confirm sensitive actions",
+			Details: map[string]any{"setup": "/api/v1/auth/2FA/setup"},
+		}
+	}
+
+	// a recovery code is consumed only along with its audit event, once the
+	// token is signed
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	method, err := usr.verifySecondFactor(ctx, qtx, &user, TOTP)
+	if err != nil {
+		logger.Info("failed step up, invalid code", zap.String("userId", userID.String()))
+		usr.recordRejection(ctx, lockKey, client, err)
+		return "", time.Time{}, err
+	}
+	usr.recordSuccess(ctx, lockKey)
+
+	amr := slices.Clone(claims.AMR)
+	for _, m := range []string{amrOTP, amrMFA} {
+		if !slices.Contains(amr, m) {
+			amr = append(amr, m)
+		}
+	}
+
+	// its own jti, a logout with it revokes this token only
+	jti, err := securetoken.Generate()
+	if err != nil {
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(config.AppConfig.StepUpTokenTTL)
+	elevated := &jwtImpl.CustomAccessTokenClaims{
+		UserID:       user.ID,
+		Role:         user.Role,
+		Email:        user.Email,
+		SessionID:    claims.SessionID,
+		TokenVersion: claims.TokenVersion,
+		AMR:          amr,
+		ACR:          acrFor(amr),
+		AuthTime:     jwt.NewNumericDate(now),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	accessToken, err := jwtImpl.GenerateAccessToken(elevated)
+	if err != nil {
+		logger.Error("failed to sign the step up token",
+			zap.String("userId", userID.String()),
+			zap.Error(err),
+		)
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	details := map[string]any{"method": method}
+	if err = recordAuditEvent(ctx, qtx, userID, auditStepUp, client, details); err != nil {
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", time.Time{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("session stepped up",
+		zap.String("userId", userID.String()),
+		zap.String("method", method),
+	)
+	return accessToken, expiresAt, nil
+}
+
+// HasTOTP tells whether the user can answer a step up, the policy middleware
+// sends the others to the totp setup
+func (usr *AuthService) HasTOTP(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.TwoFaEnabled.Bool, nil
+}
@@ -0,0 +1,744 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeDB answers the sqlc queries the tests go through by their name, the
+// rows are the sqlc models (their fields are scanned in order). A query
+// without handler fails the test with its name
+type fakeDB struct {
+	mu sync.Mutex
+
+	one  map[string]func(args []any) (any, error)
+	many map[string]func(args []any) ([]any, error)
+	exec map[string]func(args []any) (int64, error)
+
+	// names of the queries run, in order
+	calls []string
+	// queries run by the committed transactions and outside of them
+	committed []string
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		one:  map[string]func(args []any) (any, error){},
+		many: map[string]func(args []any) ([]any, error){},
+		exec: map[string]func(args []any) (int64, error){},
+	}
+}
+
+// queryName reads the name sqlc writes at the top of every query
+func queryName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) < 3 || fields[0] != "--" || fields[1] != "name:" {
+		return sql
+	}
+	return fields[2]
+}
+
+func (db *fakeDB) record(name string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = append(db.calls, name)
+}
+
+func (db *fakeDB) ran(name string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n := 0
+	for _, call := range db.calls {
+		if call == name {
+			n++
+		}
+	}
+	return n
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return db.execIn(nil, sql, args)
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	name := queryName(sql)
+	db.record(name)
+	handler, ok := db.many[name]
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unexpected query %s", name)
+	}
+	rows, err := handler(args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows, i: -1}, nil
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return db.queryRowIn(nil, sql, args)
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+func (db *fakeDB) execIn(tx *fakeTx, sql string, args []any) (pgconn.CommandTag, error) {
+	name := queryName(sql)
+	db.record(name)
+	handler, ok := db.exec[name]
+	if !ok {
+		return pgconn.CommandTag{}, fmt.Errorf("fakedb: unexpected query %s", name)
+	}
+	rows, err := handler(args)
+	if err == nil {
+		db.done(tx, name)
+	}
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", rows)), err
+}
+
+func (db *fakeDB) queryRowIn(tx *fakeTx, sql string, args []any) pgx.Row {
+	name := queryName(sql)
+	db.record(name)
+	handler, ok := db.one[name]
+	if !ok {
+		return &fakeRow{err: fmt.Errorf("fakedb: unexpected query %s", name)}
+	}
+	row, err := handler(args)
+	if err == nil {
+		db.done(tx, name)
+	}
+	return &fakeRow{row: row, err: err}
+}
+
+// done keeps the queries of a transaction until its commit
+func (db *fakeDB) done(tx *fakeTx, name string) {
+	if tx != nil {
+		tx.pending = append(tx.pending, name)
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.committed = append(db.committed, name)
+}
+
+// fakeTx runs its queries on the fake DB, the tests check what was committed
+type fakeTx struct {
+	pgx.Tx
+	db      *fakeDB
+	pending []string
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return tx.db.execIn(tx, sql, args)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.queryRowIn(tx, sql, args)
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.committed = append(tx.db.committed, tx.pending...)
+	tx.pending = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.pending = nil
+	return nil
+}
+
+// scanStruct copies the fields of a model to the scan destinations
+func scanStruct(row any, dest []any) error {
+	v := reflect.ValueOf(row)
+	if v.Kind() != reflect.Struct {
+		if len(dest) != 1 {
+			return fmt.Errorf("fakedb: scanning %T into %d values", row, len(dest))
+		}
+		reflect.ValueOf(dest[0]).Elem().Set(v)
+		return nil
+	}
+	if v.NumField() != len(dest) {
+		return fmt.Errorf("fakedb: scanning %T (%d fields) into %d values", row, v.NumField(), len(dest))
+	}
+	for i := range dest {
+		reflect.ValueOf(dest[i]).Elem().Set(v.Field(i))
+	}
+	return nil
+}
+
+type fakeRow struct {
+	row any
+	err error
+}
+
+func (r *fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanStruct(r.row, dest)
+}
+
+type fakeRows struct {
+	pgx.Rows
+	rows []any
+	i    int
+}
+
+func (r *fakeRows) Next() bool {
+	r.i++
+	return r.i < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return scanStruct(r.rows[r.i], dest)
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+// fakeTokens opens sessions without storing them, the claims of the last one
+// are kept. err makes the sessions fail
+type fakeTokens struct {
+	TokenServiceI
+	claims *jwtImpl.CustomAccessTokenClaims
+	err    error
+}
+
+func (ft *fakeTokens) StartSession(ctx context.Context, qtx *sqlc.Queries, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) (string, string, error) {
+	if ft.err != nil {
+		return "", "", ft.err
+	}
+	ft.claims = claims
+	return "access-token", "refresh-token", nil
+}
+
+// memoryLockoutStore counts the failures, the locks are only set by the tests
+// (the policy of the test config never locks)
+type memoryLockoutStore struct {
+	mu       sync.Mutex
+	failures map[string]int
+	locks    map[string]time.Time
+}
+
+func newMemoryLockoutStore() *memoryLockoutStore {
+	return &memoryLockoutStore{failures: map[string]int{}, locks: map[string]time.Time{}}
+}
+
+func (ms *memoryLockoutStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.failures[key]++
+	return ms.failures[key], nil
+}
+
+func (ms *memoryLockoutStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.locks[key] = until
+	return nil
+}
+
+func (ms *memoryLockoutStore) LockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var until time.Time
+	for _, key := range keys {
+		if ms.locks[key].After(until) {
+			until = ms.locks[key]
+		}
+	}
+	return until, nil
+}
+
+func (ms *memoryLockoutStore) Reset(ctx context.Context, keys ...string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, key := range keys {
+		delete(ms.failures, key)
+		delete(ms.locks, key)
+	}
+	return nil
+}
+
+func (ms *memoryLockoutStore) Purge(ctx context.Context, window time.Duration) error {
+	return nil
+}
+
+func (ms *memoryLockoutStore) count(key string) int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.failures[key]
+}
+
+// fakeStore keeps the rows of the tables the tests touch
+type fakeStore struct {
+	mu          sync.Mutex
+	users       map[pgtype.UUID]sqlc.User
+	credentials []sqlc.WebauthnCredential
+	challenges  map[pgtype.UUID]sqlc.WebauthnChallenge
+	userTokens  []sqlc.UserToken
+	emailCodes  []sqlc.EmailOtpCode
+	smsCodes    []sqlc.SmsOtpCode
+	audit       []string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:      map[pgtype.UUID]sqlc.User{},
+		challenges: map[pgtype.UUID]sqlc.WebauthnChallenge{},
+	}
+}
+
+func newUUID() pgtype.UUID {
+	id := pgtype.UUID{Valid: true}
+	rand.Read(id.Bytes[:])
+	return id
+}
+
+func timestampNow() pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: time.Now(), Valid: true}
+}
+
+// newTestAuthService wires an AuthService on the fake DB and store
+func newTestAuthService(store *fakeStore) (*AuthService, *fakeDB, *fakeTokens, *memoryLockoutStore) {
+	db := newFakeDB()
+	store.register(db)
+
+	tokens := &fakeTokens{}
+	locks := newMemoryLockoutStore()
+	usr := &AuthService{
+		queries: sqlc.New(db),
+		db:      db,
+		tokens:  tokens,
+		guard:   lockout.NewGuard(locks),
+	}
+	return usr, db, tokens, locks
+}
+
+// newTestOAuthService wires an OAuthService on the fake DB and store
+func newTestOAuthService(store *fakeStore) (*OAuthService, *fakeDB, *fakeTokens) {
+	db := newFakeDB()
+	store.register(db)
+
+	tokens := &fakeTokens{}
+	oas := &OAuthService{
+		queries: sqlc.New(db),
+		db:      db,
+		tokens:  tokens,
+	}
+	return oas, db, tokens
+}
+
+// register answers the user, user token, otp code, webauthn and audit
+// queries from the store
+func (fs *fakeStore) register(db *fakeDB) {
+	db.one["GetUserByID"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		user, ok := fs.users[args[0].(pgtype.UUID)]
+		if !ok {
+			return nil, pgx.ErrNoRows
+		}
+		return user, nil
+	}
+
+	db.one["GetUserByEmail"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for _, user := range fs.users {
+			if user.Email == args[0].(string) {
+				return sqlc.GetUserByEmailRow{
+					ID:                   user.ID,
+					Username:             user.Username,
+					Email:                user.Email,
+					Password:             user.Password,
+					Role:                 user.Role,
+					TwoFaEnabled:         user.TwoFaEnabled,
+					EmailVerifiedAt:      user.EmailVerifiedAt,
+					TokenVersion:         user.TokenVersion,
+					EmailOtpEnabled:      user.EmailOtpEnabled,
+					PreferredFactor:      user.PreferredFactor,
+					SmsOtpEnabled:        user.SmsOtpEnabled,
+					WebauthnSecondFactor: user.WebauthnSecondFactor,
+				}, nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	}
+
+	db.exec["InvalidateUserTokens"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		var rows int64
+		for i, token := range fs.userTokens {
+			if token.UserID == args[0].(pgtype.UUID) && token.Purpose == args[1].(string) && !token.ConsumedAt.Valid {
+				fs.userTokens[i].ConsumedAt = timestampNow()
+				rows++
+			}
+		}
+		return rows, nil
+	}
+
+	db.one["CreateUserToken"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		token := sqlc.UserToken{
+			ID:        newUUID(),
+			UserID:    args[0].(pgtype.UUID),
+			Purpose:   args[1].(string),
+			TokenHash: args[2].(string),
+			ExpiresAt: args[3].(pgtype.Timestamptz),
+			CreatedAt: timestampNow(),
+		}
+		fs.userTokens = append(fs.userTokens, token)
+		return token, nil
+	}
+
+	db.one["ConsumeUserToken"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i, token := range fs.userTokens {
+			if token.TokenHash == args[0].(string) && token.Purpose == args[1].(string) && !token.ConsumedAt.Valid && token.ExpiresAt.Time.After(time.Now()) {
+				fs.userTokens[i].ConsumedAt = timestampNow()
+				return fs.userTokens[i], nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	}
+
+	db.exec["MarkEmailVerified"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		user, ok := fs.users[args[0].(pgtype.UUID)]
+		if !ok || user.EmailVerifiedAt.Valid {
+			return 0, nil
+		}
+		user.EmailVerifiedAt = timestampNow()
+		fs.users[user.ID] = user
+		return 1, nil
+	}
+
+	db.one["GetActiveEmailOTP"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := len(fs.emailCodes) - 1; i >= 0; i-- {
+			code := fs.emailCodes[i]
+			if code.UserID == args[0].(pgtype.UUID) && !code.ConsumedAt.Valid && code.ExpiresAt.Time.After(time.Now()) {
+				return code, nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	}
+
+	db.one["CountEmailOTPAttempt"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := range fs.emailCodes {
+			if fs.emailCodes[i].ID == args[0].(pgtype.UUID) {
+				fs.emailCodes[i].Attempts++
+				return fs.emailCodes[i].Attempts, nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	}
+
+	db.exec["ConsumeEmailOTP"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := range fs.emailCodes {
+			if fs.emailCodes[i].ID == args[0].(pgtype.UUID) && !fs.emailCodes[i].ConsumedAt.Valid {
+				fs.emailCodes[i].ConsumedAt = timestampNow()
+				return 1, nil
+			}
+		}
+		return 0, nil
+	}
+
+	db.exec["DeleteEmailOTPs"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		kept := fs.emailCodes[:0]
+		for _, code := range fs.emailCodes {
+			if code.UserID != args[0].(pgtype.UUID) {
+				kept = append(kept, code)
+			}
+		}
+		deleted := int64(len(fs.emailCodes) - len(kept))
+		fs.emailCodes = kept
+		return deleted, nil
+	}
+
+	db.one["GetActiveSMSOTP"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := len(fs.smsCodes) - 1; i >= 0; i-- {
+			code := fs.smsCodes[i]
+			if code.UserID == args[0].(pgtype.UUID) && code.Purpose == args[1].(string) && !code.ConsumedAt.Valid && code.ExpiresAt.Time.After(time.Now()) {
+				return code, nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	}
+
+	db.one["CountSMSOTPAttempt"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := range fs.smsCodes {
+			if fs.smsCodes[i].ID == args[0].(pgtype.UUID) {
+				fs.smsCodes[i].Attempts++
+				return fs.smsCodes[i].Attempts, nil
+			}
+		}
+		return nil, pgx.ErrNoRows
+	}
+
+	db.exec["ConsumeSMSOTP"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := range fs.smsCodes {
+			if fs.smsCodes[i].ID == args[0].(pgtype.UUID) && !fs.smsCodes[i].ConsumedAt.Valid {
+				fs.smsCodes[i].ConsumedAt = timestampNow()
+				return 1, nil
+			}
+		}
+		return 0, nil
+	}
+
+	db.one["CreateSMSOTP"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		code := sqlc.SmsOtpCode{
+			ID:          newUUID(),
+			UserID:      args[0].(pgtype.UUID),
+			PhoneNumber: args[1].(string),
+			Purpose:     args[2].(string),
+			CodeHash:    args[3].(string),
+			ExpiresAt:   args[4].(pgtype.Timestamptz),
+			CreatedAt:   timestampNow(),
+		}
+		fs.smsCodes = append(fs.smsCodes, code)
+		return code, nil
+	}
+
+	db.exec["DeleteSMSOTPs"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		kept := fs.smsCodes[:0]
+		for _, code := range fs.smsCodes {
+			if code.UserID != args[0].(pgtype.UUID) || code.Purpose != args[1].(string) {
+				kept = append(kept, code)
+			}
+		}
+		deleted := int64(len(fs.smsCodes) - len(kept))
+		fs.smsCodes = kept
+		return deleted, nil
+	}
+
+	// the tests don't hand out recovery codes
+	db.exec["UseRecoveryCode"] = func(args []any) (int64, error) {
+		return 0, nil
+	}
+
+	db.exec["AcceptTOTPStep"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		user := fs.users[args[0].(pgtype.UUID)]
+		step := args[1].(pgtype.Int8)
+		if user.TotpLastStep.Valid && user.TotpLastStep.Int64 >= step.Int64 {
+			return 0, nil
+		}
+		user.TotpLastStep = step
+		fs.users[user.ID] = user
+		return 1, nil
+	}
+
+	db.many["ListWebAuthnCredentials"] = func(args []any) ([]any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		rows := []any{}
+		for _, cred := range fs.credentials {
+			if cred.UserID == args[0].(pgtype.UUID) {
+				rows = append(rows, cred)
+			}
+		}
+		return rows, nil
+	}
+
+	db.one["CountWebAuthnCredentials"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		var n int64
+		for _, cred := range fs.credentials {
+			if cred.UserID == args[0].(pgtype.UUID) {
+				n++
+			}
+		}
+		return n, nil
+	}
+
+	db.exec["DeleteWebAuthnCredential"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i, cred := range fs.credentials {
+			if cred.ID == args[0].(pgtype.UUID) && cred.UserID == args[1].(pgtype.UUID) {
+				fs.credentials = slices.Delete(fs.credentials, i, i+1)
+				return 1, nil
+			}
+		}
+		return 0, nil
+	}
+
+	db.one["CreateWebAuthnChallenge"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		challenge := sqlc.WebauthnChallenge{
+			ID:          newUUID(),
+			UserID:      args[0].(pgtype.UUID),
+			Ceremony:    args[1].(string),
+			SessionData: args[2].([]byte),
+			ExpiresAt:   args[3].(pgtype.Timestamptz),
+			CreatedAt:   timestampNow(),
+			Amr:         args[4].([]string),
+		}
+		fs.challenges[challenge.ID] = challenge
+		return challenge, nil
+	}
+
+	// deleted as it's read, the expired ones aren't found
+	db.one["ConsumeWebAuthnChallenge"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		id := args[0].(pgtype.UUID)
+		challenge, ok := fs.challenges[id]
+		if !ok || challenge.Ceremony != args[1].(string) || !challenge.ExpiresAt.Time.After(time.Now()) {
+			return nil, pgx.ErrNoRows
+		}
+		delete(fs.challenges, id)
+		return challenge, nil
+	}
+
+	db.one["CreateWebAuthnCredential"] = func(args []any) (any, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		cred := sqlc.WebauthnCredential{
+			ID:              newUUID(),
+			UserID:          args[0].(pgtype.UUID),
+			CredentialID:    args[1].([]byte),
+			PublicKey:       args[2].([]byte),
+			AttestationType: args[3].(string),
+			Aaguid:          args[4].([]byte),
+			SignCount:       args[5].(int64),
+			Transports:      args[6].([]string),
+			BackupEligible:  args[7].(bool),
+			BackupState:     args[8].(bool),
+			Name:            args[9].(string),
+			CreatedAt:       timestampNow(),
+		}
+		fs.credentials = append(fs.credentials, cred)
+		return cred, nil
+	}
+
+	db.exec["SetWebAuthnSecondFactor"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		user, ok := fs.users[args[0].(pgtype.UUID)]
+		if !ok {
+			return 0, nil
+		}
+		user.WebauthnSecondFactor = args[1].(bool)
+		fs.users[user.ID] = user
+		return 1, nil
+	}
+
+	db.exec["UseWebAuthnCredential"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		for i := range fs.credentials {
+			signCount := args[1].(int64)
+			if fs.credentials[i].ID == args[0].(pgtype.UUID) && (fs.credentials[i].SignCount < signCount || signCount == 0) {
+				fs.credentials[i].SignCount = signCount
+				fs.credentials[i].BackupState = args[2].(bool)
+				fs.credentials[i].LastUsedAt = timestampNow()
+				return 1, nil
+			}
+		}
+		return 0, nil
+	}
+
+	db.exec["CreateAuditEvent"] = func(args []any) (int64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		fs.audit = append(fs.audit, args[1].(string))
+		return 1, nil
+	}
+}
+
+func (fs *fakeStore) addUser(user sqlc.User) sqlc.User {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !user.ID.Valid {
+		user.ID = newUUID()
+	}
+	if user.Role == "" {
+		user.Role = "client"
+	}
+	fs.users[user.ID] = user
+	return user
+}
+
+func (fs *fakeStore) credential(i int) sqlc.WebauthnCredential {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.credentials[i]
+}
+
+// addEmailCode stores a code emailed to the user, valid 10 minutes
+func (fs *fakeStore) addEmailCode(userID pgtype.UUID, code string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.emailCodes = append(fs.emailCodes, sqlc.EmailOtpCode{
+		ID:        newUUID(),
+		UserID:    userID,
+		CodeHash:  otpHash(userID, code),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(10 * time.Minute), Valid: true},
+		CreatedAt: timestampNow(),
+	})
+}
+
+// addSMSCode stores a code texted to the user for the purpose, valid 10
+// minutes
+func (fs *fakeStore) addSMSCode(userID pgtype.UUID, number string, purpose string, code string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.smsCodes = append(fs.smsCodes, sqlc.SmsOtpCode{
+		ID:          newUUID(),
+		UserID:      userID,
+		PhoneNumber: number,
+		Purpose:     purpose,
+		CodeHash:    otpHash(userID, code),
+		ExpiresAt:   pgtype.Timestamptz{Time: time.Now().Add(10 * time.Minute), Valid: true},
+		CreatedAt:   timestampNow(),
+	})
+}
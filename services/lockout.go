@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"go.uber.org/zap"
+)
+
+// accountLockedErr tells the client when it can try again
+func accountLockedErr(retry time.Duration) *dtos.ApiErr {
+	seconds := int(math.Ceil(retry.Seconds()))
+	return &dtos.ApiErr{
+		Status:  http.StatusTooManyRequests,
+		Code:    "ACCOUNT_LOCKED",
+		Err:     "Too many failed attempts, try again later",
+		Details: map[string]any{"retryAfter": seconds},
+		Headers: map[string]string{"Retry-After": strconv.Itoa(seconds)},
+	}
+}
+
+func clientIP(client *ClientInfo) string {
+	if client == nil {
+		return ""
+	}
+	return client.IP
+}
+
+// checkLockout rejects the attempt while the account key or the ip is locked
+func (usr *AuthService) checkLockout(ctx context.Context, accountKey string, client *ClientInfo) error {
+	retry, err := usr.guard.Check(ctx, accountKey, clientIP(client))
+	if err != nil {
+		logger.Error("failed to check lockout", zap.Error(err))
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if retry > 0 {
+		logger.Warn("attempt on a locked key",
+			zap.String("key", accountKey),
+			zap.String("ip", clientIP(client)),
+		)
+		return accountLockedErr(retry)
+	}
+	return nil
+}
+
+// checkLockouts is checkLockout for the steps checking several secrets (a
+// password and a code), every key must be free
+func (usr *AuthService) checkLockouts(ctx context.Context, client *ClientInfo, accountKeys ...string) error {
+	for _, key := range accountKeys {
+		if err := usr.checkLockout(ctx, key, client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt, errors are only logged so the caller
+// still answers with its own error
+func (usr *AuthService) recordFailure(ctx context.Context, accountKey string, client *ClientInfo) {
+	delay, err := usr.guard.Fail(ctx, accountKey, clientIP(client))
+	if err != nil {
+		logger.Error("failed to record failed attempt", zap.Error(err))
+		return
+	}
+	if delay > 0 {
+		logger.Warn("key locked after failed attempts",
+			zap.String("key", accountKey),
+			zap.String("ip", clientIP(client)),
+			zap.Duration("delay", delay),
+		)
+	}
+}
+
+// recordRejection counts a failure when err rejects the code or the password
+// (401), the server errors don't count
+func (usr *AuthService) recordRejection(ctx context.Context, accountKey string, client *ClientInfo, err error) {
+	var apiErr *dtos.ApiErr
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+		usr.recordFailure(ctx, accountKey, client)
+	}
+}
+
+// recordSuccess clears the failures of the account key
+func (usr *AuthService) recordSuccess(ctx context.Context, accountKey string) {
+	if err := usr.guard.Succeed(ctx, accountKey); err != nil {
+		logger.Error("failed to reset failed attempts", zap.Error(err))
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testPassword   = "correct horse battery staple"
+	testTOTPSecret = "JBSWY3DPEHPK3PXP"
+)
+
+// newTOTPUser has a password and the 2FA on, its secret is stored in
+// plaintext (no encryption key in the tests)
+func newTOTPUser(t *testing.T) (*AuthService, *memoryLockoutStore, sqlc.User) {
+	t.Helper()
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.TOTPPeriod = 30
+	config.AppConfig.TOTPDigits = 6
+	config.AppConfig.TOTPSkew = 1
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newFakeStore()
+	user := store.addUser(sqlc.User{
+		Username:     "alice",
+		Email:        "alice@example.com",
+		Password:     string(hash),
+		TwoFaEnabled: pgtype.Bool{Bool: true, Valid: true},
+		TotpSecret:   pgtype.Text{String: testTOTPSecret, Valid: true},
+	})
+	usr, _, _, locks := newTestAuthService(store)
+	return usr, locks, user
+}
+
+// wrongTOTP is a code of the right length that isn't the current one
+func wrongTOTP(t *testing.T) string {
+	t.Helper()
+	code, err := totp.GenerateCode(testTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(code)
+	return fmt.Sprintf("%06d", (n+500000)%1000000)
+}
+
+func TestDisable2FALockout(t *testing.T) {
+	usr, locks, user := newTOTPUser(t)
+	loginKey := lockout.LoginKey(user.Email)
+	secondFactorKey := lockout.SecondFactorKey(user.ID.String())
+
+	err := usr.Disable2FA(context.Background(), user.ID, "wrong password", wrongTOTP(t), nil)
+	if code := errCode(t, err); code != "INVALID_CREDENTIALS" {
+		t.Fatalf("%s, want INVALID_CREDENTIALS", code)
+	}
+	if n := locks.count(loginKey); n != 1 {
+		t.Errorf("%d password failures, want 1", n)
+	}
+
+	err = usr.Disable2FA(context.Background(), user.ID, testPassword, wrongTOTP(t), nil)
+	if code := errCode(t, err); code != "INVALID_TOTP" {
+		t.Fatalf("%s, want INVALID_TOTP", code)
+	}
+	if n := locks.count(secondFactorKey); n != 1 {
+		t.Errorf("%d code failures, want 1", n)
+	}
+	if n := locks.count(loginKey); n != 0 {
+		t.Errorf("%d password failures after the right password, want 0", n)
+	}
+
+	for _, key := range []string{loginKey, secondFactorKey} {
+		locks.Lock(context.Background(), key, time.Now().Add(time.Minute))
+		err = usr.Disable2FA(context.Background(), user.ID, testPassword, wrongTOTP(t), nil)
+		if code := errCode(t, err); code != "ACCOUNT_LOCKED" {
+			t.Fatalf("%s locked: %s, want ACCOUNT_LOCKED", key, code)
+		}
+		locks.Reset(context.Background(), key)
+	}
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	usr, locks, user := newTOTPUser(t)
+	loginKey := lockout.LoginKey(user.Email)
+	secondFactorKey := lockout.SecondFactorKey(user.ID.String())
+
+	claims := &jwtImpl.CustomAccessTokenClaims{UserID: user.ID, SessionID: newUUID()}
+	change := func(current string) error {
+		_, _, err := usr.ChangePassword(context.Background(), claims, &PasswordChange{
+			CurrentPassword: current,
+			NewPassword:     "a new password",
+			TOTP:            wrongTOTP(t),
+		}, nil)
+		return err
+	}
+
+	if code := errCode(t, change("wrong password")); code != "INVALID_CREDENTIALS" {
+		t.Fatalf("%s, want INVALID_CREDENTIALS", code)
+	}
+	if n := locks.count(loginKey); n != 1 {
+		t.Errorf("%d password failures, want 1", n)
+	}
+
+	if code := errCode(t, change(testPassword)); code != "INVALID_TOTP" {
+		t.Fatalf("%s, want INVALID_TOTP", code)
+	}
+	if n := locks.count(secondFactorKey); n != 1 {
+		t.Errorf("%d code failures, want 1", n)
+	}
+
+	for _, key := range []string{loginKey, secondFactorKey} {
+		locks.Lock(context.Background(), key, time.Now().Add(time.Minute))
+		if code := errCode(t, change(testPassword)); code != "ACCOUNT_LOCKED" {
+			t.Fatalf("%s locked: %s, want ACCOUNT_LOCKED", key, code)
+		}
+		locks.Reset(context.Background(), key)
+	}
+}
+
+func TestRegenerateRecoveryCodesLockout(t *testing.T) {
+	usr, locks, user := newTOTPUser(t)
+	secondFactorKey := lockout.SecondFactorKey(user.ID.String())
+
+	_, err := usr.RegenerateRecoveryCodes(context.Background(), user.ID, wrongTOTP(t), nil)
+	if code := errCode(t, err); code != "INVALID_TOTP" {
+		t.Fatalf("%s, want INVALID_TOTP", code)
+	}
+	if n := locks.count(secondFactorKey); n != 1 {
+		t.Errorf("%d code failures, want 1", n)
+	}
+
+	locks.Lock(context.Background(), secondFactorKey, time.Now().Add(time.Minute))
+	_, err = usr.RegenerateRecoveryCodes(context.Background(), user.ID, wrongTOTP(t), nil)
+	if code := errCode(t, err); code != "ACCOUNT_LOCKED" {
+		t.Fatalf("%s, want ACCOUNT_LOCKED", code)
+	}
+}
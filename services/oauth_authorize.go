@@ -0,0 +1,561 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+const (
+	// time left to the user to log in and approve the client
+	authorizationRequestTTL = 10 * time.Minute
+	// codes are exchanged right after the redirect
+	authorizationCodeTTL = time.Minute
+	// access tokens of the oauth clients, the refresh keeps the same lifetime
+	oauthAccessTokenTTL = 15 * time.Minute
+	// used codes are kept so a replay can be detected
+	authorizationRetention = 24 * time.Hour
+)
+
+// code verifier of RFC 7636: 43 to 128 unreserved characters
+var codeVerifierRe = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+func invalidGrantErr(msg string) *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "invalid_grant",
+		Err:     msg,
+		Details: nil,
+	}
+}
+
+func authorizationNotFoundErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusNotFound,
+		Code:    "AUTHORIZATION_NOT_FOUND",
+		Err:     "The authorization request is unknown or expired, start again from the app",
+		Details: nil,
+	}
+}
+
+// StartAuthorization checks an authorization request and returns where to
+// send the user agent: the consent page of the front, or the client with an
+// error. The client and the redirect uri are checked first, without them the
+// error can't be sent back to the client
+func (oas *OAuthService) StartAuthorization(ctx context.Context, req *dtos.AuthorizeRequest) (string, error) {
+	client, err := oas.queries.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", &dtos.ApiErr{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_request",
+				Err:     "Unknown client_id",
+				Details: nil,
+			}
+		}
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if !matchRedirectURI(client.RedirectUris, req.RedirectURI) {
+		logger.Warn("unregistered redirect uri",
+			zap.String("clientId", client.ClientID),
+			zap.String("redirectUri", req.RedirectURI),
+		)
+		return "", &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+			Err:     "The redirect_uri isn't registered for the client",
+			Details: nil,
+		}
+	}
+
+	redirectErr := func(code string, description string) (string, error) {
+		return withQuery(req.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		}), nil
+	}
+
+	if req.ResponseType != "code" {
+		return redirectErr("unsupported_response_type", "Only the code response type is supported")
+	}
+	// pkce is mandatory in oauth 2.1, plain is refused
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return redirectErr("invalid_request", "A S256 code_challenge is required")
+	}
+	scopes, ok := grantableScopes(client.Scopes, req.Scope)
+	if !ok {
+		return redirectErr("invalid_scope", "The client can't request these scopes")
+	}
+	// relying parties can't check an HS256 ID token
+	if slices.Contains(scopes, ScopeOpenID) && jwtImpl.SigningAlgorithm() == "" {
+		logger.Warn("openid requested without an asymmetric signing key",
+			zap.String("clientId", client.ClientID),
+		)
+		return redirectErr("invalid_scope", "OpenID Connect isn't available")
+	}
+
+	authz, err := oas.queries.CreateAuthorization(ctx, sqlc.CreateAuthorizationParams{
+		ClientID:      client.ClientID,
+		RedirectUri:   req.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		State:         req.State,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(authorizationRequestTTL),
+			Valid: true,
+		},
+	})
+	if err != nil {
+		logger.Error("failed to store the authorization request", zap.Error(err))
+		return redirectErr("server_error", "Try again later")
+	}
+
+	return withQuery(config.AppConfig.OAuthConsentURL, url.Values{
+		"request_id": {authz.ID.String()},
+	}), nil
+}
+
+// GetAuthorization describes a pending request to the logged in user, the
+// front can skip the consent screen when the scopes were already granted
+func (oas *OAuthService) GetAuthorization(ctx context.Context, userID pgtype.UUID, id pgtype.UUID) (*dtos.AuthorizationDTO, error) {
+	authz, client, err := oas.pendingAuthorization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := strings.Fields(authz.Scope)
+	consentGiven := false
+	consent, err := oas.queries.GetConsent(ctx, sqlc.GetConsentParams{
+		UserID:   userID,
+		ClientID: client.ClientID,
+	})
+	switch {
+	case err == nil:
+		consentGiven = !slices.ContainsFunc(scopes, func(scope string) bool {
+			return !slices.Contains(consent.Scopes, scope)
+		})
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &dtos.AuthorizationDTO{
+		ID:           authz.ID.String(),
+		ClientID:     client.ClientID,
+		ClientName:   client.Name,
+		Scopes:       scopes,
+		RedirectURI:  authz.RedirectUri,
+		ConsentGiven: consentGiven,
+	}, nil
+}
+
+// DecideAuthorization records the answer of the user and returns the redirect
+// to the client: a one time code when approved, access_denied otherwise. The
+// login of the user (amr, auth_time) is kept for the ID token
+func (oas *OAuthService) DecideAuthorization(ctx context.Context, user *jwtImpl.CustomAccessTokenClaims, id pgtype.UUID, approve bool) (string, error) {
+	userID := user.UserID
+	authz, client, err := oas.pendingAuthorization(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if !approve {
+		if err := oas.queries.DeleteAuthorization(ctx, authz.ID); err != nil {
+			logger.Error("failed to delete the authorization request", zap.Error(err))
+		}
+		return withQuery(authz.RedirectUri, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"The user denied the request"},
+			"state":             {authz.State},
+		}), nil
+	}
+
+	code, err := securetoken.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := oas.queries.ApproveAuthorization(ctx, sqlc.ApproveAuthorizationParams{
+		ID:     authz.ID,
+		UserID: userID,
+		CodeHash: pgtype.Text{
+			String: securetoken.Hash(code),
+			Valid:  true,
+		},
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(authorizationCodeTTL),
+			Valid: true,
+		},
+		Amr:      append([]string{}, user.AMR...),
+		AuthTime: timestamptz(user.AuthTime),
+	})
+	if err != nil {
+		return "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	// approved in another tab meanwhile
+	if rows == 0 {
+		return "", authorizationNotFoundErr()
+	}
+
+	// the next request of the client for the same scopes skips the screen
+	if err := oas.queries.SaveConsent(ctx, sqlc.SaveConsentParams{
+		UserID:   userID,
+		ClientID: client.ClientID,
+		Scopes:   strings.Fields(authz.Scope),
+	}); err != nil {
+		logger.Error("failed to save the consent", zap.Error(err))
+	}
+
+	logger.Info("oauth authorization approved",
+		zap.String("userId", userID.String()),
+		zap.String("clientId", client.ClientID),
+		zap.String("scope", authz.Scope),
+	)
+	return withQuery(authz.RedirectUri, url.Values{
+		"code":  {code},
+		"state": {authz.State},
+	}), nil
+}
+
+// ExchangeCode redeems an authorization code for a token pair. A code can be
+// used once, presenting it again ends the session it opened
+func (oas *OAuthService) ExchangeCode(ctx context.Context, client *sqlc.OauthClient, code string, redirectURI string, verifier string, info *ClientInfo) (*dtos.TokenResponse, error) {
+	codeHash := pgtype.Text{
+		String: securetoken.Hash(code),
+		Valid:  true,
+	}
+
+	authz, err := oas.queries.ConsumeAuthorizationCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			oas.revokeReplayedCode(ctx, codeHash)
+			return nil, invalidGrantErr("The code is invalid, expired or already used")
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if authz.ClientID != client.ClientID || authz.RedirectUri != redirectURI {
+		return nil, invalidGrantErr("The code was issued to another client or redirect_uri")
+	}
+	if !verifyCodeChallenge(verifier, authz.CodeChallenge) {
+		return nil, invalidGrantErr("The code_verifier doesn't match the code_challenge")
+	}
+
+	resp, sessionID, err := oas.issueDelegatedTokens(ctx, nil, client, &delegatedGrant{
+		UserID:   authz.UserID,
+		Scope:    authz.Scope,
+		Nonce:    authz.Nonce,
+		Amr:      authz.Amr,
+		AuthTime: authz.AuthTime,
+	}, info)
+	if err != nil {
+		return nil, err
+	}
+
+	// kept so a replay of the code ends this session
+	if err := oas.queries.SetAuthorizationSession(ctx, sqlc.SetAuthorizationSessionParams{
+		ID:        authz.ID,
+		SessionID: sessionID,
+	}); err != nil {
+		logger.Error("failed to link the code to its session", zap.Error(err))
+	}
+
+	logger.Info("oauth code exchanged",
+		zap.String("userId", authz.UserID.String()),
+		zap.String("clientId", client.ClientID),
+	)
+	return resp, nil
+}
+
+// delegatedGrant is what a user approved for a client, by the authorization
+// code or the device flow
+type delegatedGrant struct {
+	UserID pgtype.UUID
+	Scope  string
+	Nonce  string
+	// login of the user when approving
+	Amr      []string
+	AuthTime pgtype.Timestamptz
+}
+
+// issueDelegatedTokens opens a session of the user for the client and returns
+// its tokens, with an ID token when openid was granted. The session is opened
+// in the transaction of qtx, or its own one when qtx is nil
+func (oas *OAuthService) issueDelegatedTokens(ctx context.Context, qtx *sqlc.Queries, client *sqlc.OauthClient, grant *delegatedGrant, info *ClientInfo) (*dtos.TokenResponse, pgtype.UUID, error) {
+	user, err := oas.queries.GetUserByID(ctx, grant.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, pgtype.UUID{}, invalidGrantErr("The user doesn't exist anymore")
+		}
+		return nil, pgtype.UUID{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	claims := &jwtImpl.CustomAccessTokenClaims{
+		UserID:       user.ID,
+		Role:         user.Role,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		Scope:        grant.Scope,
+		ClientID:     client.ClientID,
+		AMR:          grant.Amr,
+		ACR:          acrFor(grant.Amr),
+		AuthTime:     numericDate(grant.AuthTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oauthAccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	// signed before the session is opened, a failure leaves nothing behind
+	var signedIDToken string
+	if slices.Contains(strings.Fields(grant.Scope), ScopeOpenID) {
+		if signedIDToken, err = idToken(&user, client.ClientID, grant); err != nil {
+			logger.Error("failed to sign the id token", zap.Error(err))
+			return nil, pgtype.UUID{}, &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "server_error",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+	}
+
+	accessToken, refreshToken, err := oas.tokens.StartSession(ctx, qtx, claims, info)
+	if err != nil {
+		logger.Error("failed to issue the oauth tokens", zap.Error(err))
+		return nil, pgtype.UUID{}, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &dtos.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        grant.Scope,
+		IDToken:      signedIDToken,
+	}, claims.SessionID, nil
+}
+
+// RefreshClientToken rotates a refresh token issued to the client, the scopes
+// of the session are kept
+func (oas *OAuthService) RefreshClientToken(ctx context.Context, client *sqlc.OauthClient, refreshToken string) (*dtos.TokenResponse, error) {
+	accessToken, newRefreshToken, err := oas.tokens.RotateRefreshToken(ctx, refreshToken, client.ClientID)
+	if err != nil {
+		var apiErr *dtos.ApiErr
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			return nil, invalidGrantErr(apiErr.Err)
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &dtos.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+// PurgeAuthorizations drops the expired requests and codes, the device codes
+// included
+func (oas *OAuthService) PurgeAuthorizations(ctx context.Context) error {
+	expiredBefore := pgtype.Timestamptz{
+		Time:  time.Now().Add(-authorizationRetention),
+		Valid: true,
+	}
+	if err := oas.queries.DeleteExpiredAuthorizations(ctx, expiredBefore); err != nil {
+		return err
+	}
+	return oas.queries.DeleteExpiredDeviceCodes(ctx, expiredBefore)
+}
+
+func (oas *OAuthService) pendingAuthorization(ctx context.Context, id pgtype.UUID) (*sqlc.OauthAuthorization, *sqlc.OauthClient, error) {
+	authz, err := oas.queries.GetPendingAuthorization(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, authorizationNotFoundErr()
+		}
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// revoked since the request started
+	client, err := oas.queries.GetOAuthClient(ctx, authz.ClientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, authorizationNotFoundErr()
+		}
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	return &authz, &client, nil
+}
+
+// revokeReplayedCode ends the session opened by a code presented twice, one
+// of the two holders stole it (OAuth 2.1 section 4.1.3)
+func (oas *OAuthService) revokeReplayedCode(ctx context.Context, codeHash pgtype.Text) {
+	authz, err := oas.queries.GetAuthorizationByCodeHash(ctx, codeHash)
+	if err != nil || !authz.UsedAt.Valid || !authz.SessionID.Valid {
+		return
+	}
+
+	logger.Warn("authorization code replayed, ending its session",
+		zap.String("clientId", authz.ClientID),
+		zap.String("sessionId", authz.SessionID.String()),
+	)
+	if err := oas.tokens.EndSession(ctx, authz.UserID, authz.SessionID); err != nil {
+		logger.Error("failed to end the session of a replayed code", zap.Error(err))
+	}
+}
+
+// grantableScopes splits the requested scopes, every one must be allowed to
+// the client. introspect is a client permission, never granted to a user
+func grantableScopes(allowed []string, requested string) ([]string, bool) {
+	scopes := []string{}
+	for _, scope := range strings.Fields(requested) {
+		if scope == ScopeIntrospect || !slices.Contains(allowed, scope) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+// verifyCodeChallenge checks the S256 transformation of the verifier
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if !codeVerifierRe.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// validateRedirectURI accepts absolute uris without fragment, plain http only
+// on the loopback (native apps)
+func validateRedirectURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid redirect uri %q", uri)
+	}
+	if parsed.Scheme == "http" && !isLoopback(parsed.Hostname()) {
+		return fmt.Errorf("redirect uri %q must use https", uri)
+	}
+	return nil
+}
+
+// matchRedirectURI compares the uri with the registered ones, the port of a
+// loopback uri may change between runs of a native app (RFC 8252 7.3)
+func matchRedirectURI(registered []string, uri string) bool {
+	if uri == "" {
+		return false
+	}
+	if slices.Contains(registered, uri) {
+		return true
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "http" || !isLoopback(parsed.Hostname()) {
+		return false
+	}
+	for _, candidate := range registered {
+		reg, err := url.Parse(candidate)
+		if err != nil || reg.Scheme != "http" || !isLoopback(reg.Hostname()) {
+			continue
+		}
+		if reg.Hostname() == parsed.Hostname() && reg.Path == parsed.Path && reg.RawQuery == parsed.RawQuery {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// withQuery adds the parameters to the query of the uri, empty ones are left
+// out
+func withQuery(uri string, params url.Values) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	query := parsed.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
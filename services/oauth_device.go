@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// DeviceCodeGrantType is the grant_type of the device polling (RFC 8628)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	// time left to the user to type the code
+	deviceCodeTTL = 10 * time.Minute
+	// seconds between two polls, raised by slow_down
+	devicePollInterval = 5
+	deviceSlowDownStep = 5
+	// consonants only so no word can be spelled (RFC 8628 section 6.1), 8 of
+	// them give 2^34 codes for a 10 minutes window behind the rate limits
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// status of a device code
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+func deviceCodeNotFoundErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusNotFound,
+		Code:    "DEVICE_CODE_NOT_FOUND",
+		Err:     "The code is unknown or expired, start again on the device",
+		Details: nil,
+	}
+}
+
+// generateUserCode draws the code the user types on the verification page
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode accepts the code as typed: any case, with the dash or
+// spaces
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+// formatUserCode splits the code in two halves, easier to read from a screen
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// StartDeviceAuthorization returns the codes of a device: the device code it
+// polls with and the user code the user types on another screen
+func (oas *OAuthService) StartDeviceAuthorization(ctx context.Context, client *sqlc.OauthClient, scope string) (*dtos.DeviceAuthorizationResponse, error) {
+	if !client.DeviceGrant {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "unauthorized_client",
+			Err:     "The client can't use the device flow",
+			Details: nil,
+		}
+	}
+
+	scopes, ok := grantableScopes(client.Scopes, scope)
+	if !ok || (slices.Contains(scopes, ScopeOpenID) && jwtImpl.SigningAlgorithm() == "") {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_scope",
+			Err:     "The client can't request these scopes",
+			Details: nil,
+		}
+	}
+
+	deviceCode, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	// a user code already pending is drawn again
+	var created sqlc.OauthDeviceCode
+	for attempt := 0; attempt < 3; attempt++ {
+		userCode, err := generateUserCode()
+		if err != nil {
+			return nil, err
+		}
+		created, err = oas.queries.CreateDeviceCode(ctx, sqlc.CreateDeviceCodeParams{
+			ClientID:       client.ClientID,
+			DeviceCodeHash: securetoken.Hash(deviceCode),
+			UserCode:       userCode,
+			Scope:          strings.Join(scopes, " "),
+			PollInterval:   devicePollInterval,
+			ExpiresAt: pgtype.Timestamptz{
+				Time:  time.Now().Add(deviceCodeTTL),
+				Valid: true,
+			},
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			continue
+		}
+		if err != nil {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "server_error",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		break
+	}
+	if !created.ID.Valid {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     "Failed to draw a unique user code",
+			Details: nil,
+		}
+	}
+
+	userCode := formatUserCode(created.UserCode)
+	logger.Info("device authorization started",
+		zap.String("clientId", client.ClientID),
+		zap.String("scope", created.Scope),
+	)
+	return &dtos.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         config.AppConfig.OAuthDeviceURL,
+		VerificationURIComplete: withQuery(config.AppConfig.OAuthDeviceURL, url.Values{"user_code": {userCode}}),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                created.PollInterval,
+	}, nil
+}
+
+// GetDeviceRequest describes the device waiting for the code typed by the user
+func (oas *OAuthService) GetDeviceRequest(ctx context.Context, user *jwtImpl.CustomAccessTokenClaims, userCode string) (*dtos.DeviceRequestDTO, error) {
+	if err := oas.requireSecondFactor(ctx, user); err != nil {
+		return nil, err
+	}
+
+	device, client, err := oas.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dtos.DeviceRequestDTO{
+		UserCode:   formatUserCode(device.UserCode),
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     strings.Fields(device.Scope),
+	}, nil
+}
+
+// DecideDeviceRequest records the answer of the user, the device gets its
+// tokens or access_denied on its next poll
+func (oas *OAuthService) DecideDeviceRequest(ctx context.Context, user *jwtImpl.CustomAccessTokenClaims, userCode string, approve bool) error {
+	if err := oas.requireSecondFactor(ctx, user); err != nil {
+		return err
+	}
+
+	device, client, err := oas.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	status := deviceStatusDenied
+	if approve {
+		status = deviceStatusApproved
+	}
+	rows, err := oas.queries.DecideDeviceCode(ctx, sqlc.DecideDeviceCodeParams{
+		ID:       device.ID,
+		Status:   status,
+		UserID:   user.UserID,
+		Amr:      append([]string{}, user.AMR...),
+		AuthTime: timestamptz(user.AuthTime),
+	})
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	// answered in another tab meanwhile
+	if rows == 0 {
+		return deviceCodeNotFoundErr()
+	}
+
+	if approve {
+		if err := oas.queries.SaveConsent(ctx, sqlc.SaveConsentParams{
+			UserID:   user.UserID,
+			ClientID: client.ClientID,
+			Scopes:   strings.Fields(device.Scope),
+		}); err != nil {
+			logger.Error("failed to save the consent", zap.Error(err))
+		}
+	}
+
+	logger.Info("device authorization answered",
+		zap.String("userId", user.UserID.String()),
+		zap.String("clientId", client.ClientID),
+		zap.String("status", status),
+	)
+	return nil
+}
+
+// PollDeviceToken answers the polls of the device: authorization_pending until
+// the user answers, slow_down when it polls too fast, then the tokens once
+func (oas *OAuthService) PollDeviceToken(ctx context.Context, client *sqlc.OauthClient, deviceCode string, info *ClientInfo) (*dtos.TokenResponse, error) {
+	device, err := oas.queries.GetDeviceCodeByHash(ctx, securetoken.Hash(deviceCode))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, invalidGrantErr("The device code is invalid")
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if device.ClientID != client.ClientID {
+		return nil, invalidGrantErr("The device code was issued to another client")
+	}
+	if device.ConsumedAt.Valid {
+		return nil, invalidGrantErr("The device code was already used")
+	}
+	if device.ExpiresAt.Time.Before(time.Now()) {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "expired_token",
+			Err:     "The device code expired, start again",
+			Details: nil,
+		}
+	}
+
+	// the device must wait the interval between two polls, every early poll
+	// makes it wait longer
+	interval := device.PollInterval
+	tooFast := device.LastPolledAt.Valid &&
+		time.Since(device.LastPolledAt.Time) < time.Duration(interval)*time.Second
+	if tooFast {
+		interval += deviceSlowDownStep
+	}
+	if err := oas.queries.RecordDeviceCodePoll(ctx, sqlc.RecordDeviceCodePollParams{
+		ID:           device.ID,
+		PollInterval: interval,
+	}); err != nil {
+		logger.Error("failed to record the device poll", zap.Error(err))
+	}
+	if tooFast {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "slow_down",
+			Err:     "Poll less often",
+			Details: nil,
+		}
+	}
+
+	switch device.Status {
+	case deviceStatusPending:
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "authorization_pending",
+			Err:     "The user hasn't answered yet",
+			Details: nil,
+		}
+	case deviceStatusDenied:
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "access_denied",
+			Err:     "The user denied the request",
+			Details: nil,
+		}
+	}
+
+	tx, err := transaction.StartTransaction(ctx, oas.db)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := oas.queries.WithTx(tx)
+
+	// two polls racing get one pair of tokens, the code is kept if the
+	// session can't be opened
+	rows, err := qtx.ConsumeDeviceCode(ctx, device.ID)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		return nil, invalidGrantErr("The device code was already used")
+	}
+
+	resp, _, err := oas.issueDelegatedTokens(ctx, qtx, client, &delegatedGrant{
+		UserID:   device.UserID,
+		Scope:    device.Scope,
+		Amr:      device.Amr,
+		AuthTime: device.AuthTime,
+	}, info)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("device code exchanged",
+		zap.String("userId", device.UserID.String()),
+		zap.String("clientId", client.ClientID),
+	)
+	return resp, nil
+}
+
+func (oas *OAuthService) pendingDeviceCode(ctx context.Context, userCode string) (*sqlc.OauthDeviceCode, *sqlc.OauthClient, error) {
+	device, err := oas.queries.GetPendingDeviceCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, deviceCodeNotFoundErr()
+		}
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// revoked since the device started
+	client, err := oas.queries.GetOAuthClient(ctx, device.ClientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, deviceCodeNotFoundErr()
+		}
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	return &device, &client, nil
+}
+
+// requireSecondFactor checks the token of a user with a second factor went
+// through it, a device gets the same access as the user
+func (oas *OAuthService) requireSecondFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) error {
+	user, err := oas.queries.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	passkeys, err := oas.queries.CountWebAuthnCredentials(ctx, claims.UserID)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return requireMFA(enrolledFactors(&user, passkeys), claims)
+}
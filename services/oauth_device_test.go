@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestDeviceApprovalNeedsTheSecondFactorOfPasskeyUsers(t *testing.T) {
+	store := newFakeStore()
+	oas, _, _ := newTestOAuthService(store)
+	user := store.addUser(sqlc.User{
+		Username:             "alice",
+		Email:                "alice@example.com",
+		WebauthnSecondFactor: true,
+	})
+	store.credentials = append(store.credentials, sqlc.WebauthnCredential{ID: newUUID(), UserID: user.ID})
+
+	claims := &jwtImpl.CustomAccessTokenClaims{UserID: user.ID, AMR: []string{amrPassword}}
+	if err := oas.DecideDeviceRequest(context.Background(), claims, "BCDFGHJK", true); errCode(t, err) != "MFA_REQUIRED" {
+		t.Fatalf("got %v, want MFA_REQUIRED", err)
+	}
+}
+
+func TestPollDeviceTokenKeepsTheCodeWhenTheSessionFails(t *testing.T) {
+	store := newFakeStore()
+	oas, db, tokens := newTestOAuthService(store)
+	user := store.addUser(sqlc.User{Username: "alice", Email: "alice@example.com"})
+	client := &sqlc.OauthClient{ClientID: "tv"}
+
+	db.one["GetDeviceCodeByHash"] = func(args []any) (any, error) {
+		return sqlc.OauthDeviceCode{
+			ID:           newUUID(),
+			ClientID:     client.ClientID,
+			Scope:        "profile",
+			Status:       deviceStatusApproved,
+			UserID:       user.ID,
+			Amr:          []string{amrPassword},
+			AuthTime:     timestampNow(),
+			PollInterval: devicePollInterval,
+			ExpiresAt:    pgtype.Timestamptz{Time: time.Now().Add(deviceCodeTTL), Valid: true},
+		}, nil
+	}
+	db.exec["RecordDeviceCodePoll"] = func(args []any) (int64, error) {
+		return 1, nil
+	}
+	db.exec["ConsumeDeviceCode"] = func(args []any) (int64, error) {
+		return 1, nil
+	}
+
+	tokens.err = errors.New("connection reset")
+	if _, err := oas.PollDeviceToken(context.Background(), client, "device-code", &ClientInfo{}); errCode(t, err) != "server_error" {
+		t.Fatalf("got %v, want server_error", err)
+	}
+	if slices.Contains(db.committed, "ConsumeDeviceCode") {
+		t.Fatal("the device code was consumed without a session")
+	}
+
+	tokens.err = nil
+	if _, err := oas.PollDeviceToken(context.Background(), client, "device-code", &ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(db.committed, "ConsumeDeviceCode") {
+		t.Errorf("the device code isn't consumed with the session: %v", db.committed)
+	}
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/internal/revocation"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// ScopeIntrospect lets a client call the introspection endpoint
+const ScopeIntrospect = "introspect"
+
+type OAuthServiceI interface {
+	AuthenticateClient(ctx context.Context, clientID string, secret string) (*sqlc.OauthClient, error)
+	Introspect(ctx context.Context, client *sqlc.OauthClient, token string, hint string) (*dtos.IntrospectionResponse, error)
+	CreateClient(ctx context.Context, params *OAuthClientParams) (*sqlc.OauthClient, string, error)
+	ListClients(ctx context.Context) ([]sqlc.OauthClient, error)
+	RevokeClient(ctx context.Context, clientID string) error
+	StartAuthorization(ctx context.Context, req *dtos.AuthorizeRequest) (string, error)
+	GetAuthorization(ctx context.Context, userID pgtype.UUID, id pgtype.UUID) (*dtos.AuthorizationDTO, error)
+	DecideAuthorization(ctx context.Context, user *jwtImpl.CustomAccessTokenClaims, id pgtype.UUID, approve bool) (string, error)
+	ExchangeCode(ctx context.Context, client *sqlc.OauthClient, code string, redirectURI string, verifier string, info *ClientInfo) (*dtos.TokenResponse, error)
+	RefreshClientToken(ctx context.Context, client *sqlc.OauthClient, refreshToken string) (*dtos.TokenResponse, error)
+	UserInfo(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) (*dtos.UserInfoResponse, error)
+	ClientCredentials(ctx context.Context, client *sqlc.OauthClient, scope string) (*dtos.TokenResponse, error)
+	StartDeviceAuthorization(ctx context.Context, client *sqlc.OauthClient, scope string) (*dtos.DeviceAuthorizationResponse, error)
+	GetDeviceRequest(ctx context.Context, user *jwtImpl.CustomAccessTokenClaims, userCode string) (*dtos.DeviceRequestDTO, error)
+	DecideDeviceRequest(ctx context.Context, user *jwtImpl.CustomAccessTokenClaims, userCode string, approve bool) error
+	PollDeviceToken(ctx context.Context, client *sqlc.OauthClient, deviceCode string, info *ClientInfo) (*dtos.TokenResponse, error)
+	CreateServiceAccount(ctx context.Context, by *principal.Principal, name string, scopes []string) (*dtos.ServiceAccountDTO, error)
+	ListServiceAccounts(ctx context.Context) ([]dtos.ServiceAccountDTO, error)
+	RotateServiceAccountSecret(ctx context.Context, by *principal.Principal, clientID string) (*dtos.ServiceAccountDTO, error)
+	RevokeServiceAccount(ctx context.Context, by *principal.Principal, clientID string) error
+	PurgeAuthorizations(ctx context.Context) error
+}
+
+type OAuthService struct {
+	queries *sqlc.Queries
+	db      transaction.Beginner
+	revoked revocation.Store
+	tokens  TokenServiceI
+}
+
+func NewOAuthService(qrs *sqlc.Queries, pgdb *pgxpool.Pool, store revocation.Store, tokSrv TokenServiceI) OAuthServiceI {
+	return &OAuthService{
+		queries: qrs,
+		db:      pgdb,
+		revoked: store,
+		tokens:  tokSrv,
+	}
+}
+
+func invalidClientErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "invalid_client",
+		Err:     "Client authentication failed",
+		Details: nil,
+		Headers: map[string]string{"WWW-Authenticate": `Basic realm="oauth"`},
+	}
+}
+
+// AuthenticateClient checks the client credentials, the secrets are random so
+// a sha256 is enough to store them. A public client only sends its id
+func (oas *OAuthService) AuthenticateClient(ctx context.Context, clientID string, secret string) (*sqlc.OauthClient, error) {
+	if clientID == "" {
+		return nil, invalidClientErr()
+	}
+
+	client, err := oas.queries.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, invalidClientErr()
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, invalidClientErr()
+		}
+		return &client, nil
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(securetoken.Hash(secret)), []byte(client.SecretHash)) != 1 {
+		logger.Warn("invalid client secret", zap.String("clientId", clientID))
+		return nil, invalidClientErr()
+	}
+	return &client, nil
+}
+
+// Introspect describes the token to a resource server (RFC 7662). The hint
+// only picks the type tried first
+func (oas *OAuthService) Introspect(ctx context.Context, client *sqlc.OauthClient, token string, hint string) (*dtos.IntrospectionResponse, error) {
+	if client.Public || !slices.Contains(client.Scopes, ScopeIntrospect) {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusForbidden,
+			Code:    "unauthorized_client",
+			Err:     "The client isn't allowed to introspect tokens",
+			Details: nil,
+		}
+	}
+	if token == "" {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+			Err:     "The token parameter is required",
+			Details: nil,
+		}
+	}
+
+	checks := []func(context.Context, string) (*dtos.IntrospectionResponse, error){
+		oas.introspectAccessToken,
+		oas.introspectRefreshToken,
+	}
+	if hint == "refresh_token" {
+		slices.Reverse(checks)
+	}
+
+	for _, check := range checks {
+		resp, err := check(ctx, token)
+		if err != nil {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "server_error",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		if resp != nil {
+			logger.Info("token introspected",
+				zap.String("clientId", client.ClientID),
+				zap.String("tokenType", resp.TokenType),
+			)
+			return resp, nil
+		}
+	}
+
+	return &dtos.IntrospectionResponse{Active: false}, nil
+}
+
+// introspectAccessToken returns nil when the token isn't an active access
+// token: bad signature, expired, revoked or its session ended
+func (oas *OAuthService) introspectAccessToken(ctx context.Context, token string) (*dtos.IntrospectionResponse, error) {
+	parsed, valid, err := jwtImpl.ParseExtractClaims(token, "access", config.AppConfig.JWTSEC)
+	if err != nil || !valid {
+		return nil, nil
+	}
+	claims, ok := parsed.Claims.(*jwtImpl.CustomAccessTokenClaims)
+	if !ok {
+		return nil, nil
+	}
+
+	revoked, err := oas.revoked.IsRevoked(ctx, claims)
+	if err != nil || revoked {
+		return nil, err
+	}
+
+	resp := &dtos.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Email,
+		TokenType: "Bearer",
+		Sub:       claims.UserID.String(),
+		Jti:       claims.ID,
+		Role:      claims.Role,
+	}
+	if claims.SessionID.Valid {
+		resp.SessionID = claims.SessionID.String()
+	}
+	// a service account token has no user, its subject is the client
+	if !claims.UserID.Valid {
+		resp.Sub = claims.Subject
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	return resp, nil
+}
+
+// introspectRefreshToken returns nil when the token isn't a refresh token that
+// can still be exchanged
+func (oas *OAuthService) introspectRefreshToken(ctx context.Context, token string) (*dtos.IntrospectionResponse, error) {
+	claims, err := jwtImpl.ParseRefreshToken(token)
+	if err != nil {
+		return nil, nil
+	}
+
+	stored, err := oas.queries.GetRefreshTokenByHash(ctx, securetoken.Hash(claims.ID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if stored.RevokedAt.Valid || stored.UsedAt.Valid || stored.ExpiresAt.Time.Before(time.Now()) {
+		return nil, nil
+	}
+
+	resp := &dtos.IntrospectionResponse{
+		Active:    true,
+		TokenType: "Refresh",
+		Sub:       claims.UserID.String(),
+		SessionID: claims.SessionID.String(),
+		Exp:       stored.ExpiresAt.Time.Unix(),
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	return resp, nil
+}
+
+// OAuthClientParams describes a client to register
+type OAuthClientParams struct {
+	Name         string
+	Scopes       []string
+	RedirectURIs []string
+	// public clients (SPA, mobile apps) can't keep a secret, they rely on pkce
+	Public bool
+	// service accounts act for themselves with the client credentials grant
+	ServiceAccount bool
+	// devices without browser (CLIs, TVs) use the device flow
+	DeviceGrant bool
+	// admin who registered the client, none from the command line
+	CreatedBy pgtype.UUID
+}
+
+// CreateClient registers a client, the secret of a confidential client is
+// only returned here
+func (oas *OAuthService) CreateClient(ctx context.Context, params *OAuthClientParams) (*sqlc.OauthClient, string, error) {
+	if params.Public && slices.Contains(params.Scopes, ScopeIntrospect) {
+		return nil, "", errors.New("a public client can't introspect tokens")
+	}
+	if params.Public && len(params.RedirectURIs) == 0 && !params.DeviceGrant {
+		return nil, "", errors.New("a public client needs a redirect uri or the device grant")
+	}
+	if params.ServiceAccount && (params.Public || params.DeviceGrant || len(params.RedirectURIs) > 0) {
+		return nil, "", errors.New("a service account is confidential and has no redirect uri nor device grant")
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, "", err
+		}
+	}
+
+	clientID, err := securetoken.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := securetoken.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+	// a public client authenticates with its id only, no hash can match
+	secretHash := securetoken.Hash(secret)
+	if params.Public {
+		secret, secretHash = "", ""
+	}
+
+	client, err := oas.queries.CreateOAuthClient(ctx, sqlc.CreateOAuthClientParams{
+		// 132 bits are plenty for an identifier, shorter to paste in a config
+		ClientID:   clientID[:22],
+		Name:       params.Name,
+		SecretHash: secretHash,
+		// nil slices would be stored as NULL
+		Scopes:         append([]string{}, params.Scopes...),
+		RedirectUris:   append([]string{}, params.RedirectURIs...),
+		Public:         params.Public,
+		ServiceAccount: params.ServiceAccount,
+		CreatedBy:      params.CreatedBy,
+		DeviceGrant:    params.DeviceGrant,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	logger.Info("oauth client created",
+		zap.String("clientId", client.ClientID),
+		zap.Strings("scopes", client.Scopes),
+		zap.Bool("public", client.Public),
+		zap.Bool("serviceAccount", client.ServiceAccount),
+	)
+	return &client, secret, nil
+}
+
+func (oas *OAuthService) ListClients(ctx context.Context) ([]sqlc.OauthClient, error) {
+	return oas.queries.ListOAuthClients(ctx)
+}
+
+// RevokeClient disables the client, its secret stops working at once
+func (oas *OAuthService) RevokeClient(ctx context.Context, clientID string) error {
+	rows, err := oas.queries.RevokeOAuthClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("unknown or already revoked client")
+	}
+
+	logger.Info("oauth client revoked", zap.String("clientId", clientID))
+	return nil
+}
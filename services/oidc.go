@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OpenID Connect scopes, openid asks for an ID token
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// authentication methods of RFC 8176, recorded in the sessions at login
+const (
+	amrPassword = "pwd"
+	amrOTP      = "otp"
+	amrMFA      = "mfa"
+)
+
+// authentication context classes of the ID tokens (NIST SP 800-63B levels)
+const (
+	ACRSingleFactor = "aal1"
+	ACRMultiFactor  = "aal2"
+)
+
+// idTokenTTL is the lifetime of the ID tokens, the relying party reads them
+// right after the code exchange
+const idTokenTTL = time.Hour
+
+// acrFor derives the authentication level from the methods used at login
+func acrFor(amr []string) string {
+	if slices.Contains(amr, amrMFA) {
+		return ACRMultiFactor
+	}
+	return ACRSingleFactor
+}
+
+// numericDate converts a nullable timestamp of the DB to a jwt date
+func numericDate(ts pgtype.Timestamptz) *jwt.NumericDate {
+	if !ts.Valid {
+		return nil
+	}
+	return jwt.NewNumericDate(ts.Time)
+}
+
+// timestamptz is the reverse of numericDate
+func timestamptz(date *jwt.NumericDate) pgtype.Timestamptz {
+	if date == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{
+		Time:  date.Time,
+		Valid: true,
+	}
+}
+
+// standardClaims maps the user to the OpenID claims the scopes allow
+func standardClaims(user *sqlc.User, scope string) *dtos.UserInfoResponse {
+	scopes := strings.Fields(scope)
+	info := &dtos.UserInfoResponse{
+		Sub: user.ID.String(),
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		verified := user.EmailVerifiedAt.Valid
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		info.PreferredUsername = user.Username
+	}
+	return info
+}
+
+// idToken signs the ID token of a grant, the audience is the client
+func idToken(user *sqlc.User, clientID string, grant *delegatedGrant) (string, error) {
+	info := standardClaims(user, grant.Scope)
+	now := time.Now()
+
+	return jwtImpl.GenerateIDToken(&jwtImpl.IDTokenClaims{
+		Nonce:             grant.Nonce,
+		AuthTime:          numericDate(grant.AuthTime),
+		ACR:               acrFor(grant.Amr),
+		AMR:               grant.Amr,
+		Email:             info.Email,
+		EmailVerified:     info.EmailVerified,
+		PreferredUsername: info.PreferredUsername,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.AppConfig.OIDCIssuer,
+			Subject:   info.Sub,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(idTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+// UserInfo returns the claims of the user the token was issued for, the token
+// was checked by the oauth middleware
+func (oas *OAuthService) UserInfo(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) (*dtos.UserInfoResponse, error) {
+	user, err := oas.queries.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusUnauthorized,
+				Code:    "invalid_token",
+				Err:     "The user doesn't exist anymore",
+				Details: nil,
+			}
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return standardClaims(&user, claims.Scope), nil
+}
+
+// OpenIDConfiguration is the discovery document, the endpoints are built from
+// OIDC_ISSUER
+func OpenIDConfiguration() *dtos.OpenIDConfiguration {
+	issuer := config.AppConfig.OIDCIssuer
+
+	// ID tokens are only issued with an asymmetric key
+	algs := []string{}
+	if alg := jwtImpl.SigningAlgorithm(); alg != "" {
+		algs = append(algs, alg)
+	}
+
+	return &dtos.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device/code",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", DeviceCodeGrantType},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr",
+			"email", "email_verified", "preferred_username",
+		},
+	}
+}
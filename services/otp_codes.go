@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// otpChannel gives access to the codes sent to a user by email or sms, the
+// checks of verifyOTPCode are the same for both
+type otpChannel struct {
+	// prefix of the error codes (EMAIL, SMS) and name in the logs
+	name        string
+	maxAttempts int32
+	invalidErr  func() *dtos.ApiErr
+
+	// active returns the id and the hash of the code waiting for the user
+	active       func(ctx context.Context) (pgtype.UUID, string, error)
+	countAttempt func(ctx context.Context, id pgtype.UUID) (int32, error)
+	consume      func(ctx context.Context, id pgtype.UUID) (int64, error)
+	// drop deletes the codes of the user once the attempts are exhausted
+	drop func(ctx context.Context) error
+}
+
+// verifyOTPCode checks a code against the active one of the channel and
+// consumes it. Every failure counts for the lockout, the attempts counter of
+// the code comes on top
+func (usr *AuthService) verifyOTPCode(ctx context.Context, userID pgtype.UUID, ch *otpChannel, code string, lockKey string, client *ClientInfo) error {
+	id, codeHash, err := ch.active(ctx)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			usr.recordFailure(ctx, lockKey, client)
+			return ch.invalidErr()
+		}
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	attempts, err := ch.countAttempt(ctx, id)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if attempts > ch.maxAttempts {
+		if err := ch.drop(ctx); err != nil {
+			logger.Error("failed to drop the codes",
+				zap.String("channel", ch.name),
+				zap.Error(err),
+			)
+		}
+		usr.recordFailure(ctx, lockKey, client)
+		return &dtos.ApiErr{
+			Status:  http.StatusUnauthorized,
+			Code:    ch.name + "_OTP_ATTEMPTS_EXCEEDED",
+			Err:     "Too many wrong codes, ask for a new one",
+			Details: nil,
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otpHash(userID, code)), []byte(codeHash)) != 1 {
+		usr.recordFailure(ctx, lockKey, client)
+		return ch.invalidErr()
+	}
+
+	// two requests racing with the same code can't both be accepted
+	rows, err := ch.consume(ctx, id)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		return ch.invalidErr()
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/sms"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const testPhone = "+33612345678"
+
+func newOTPUser(t *testing.T) (*AuthService, *fakeDB, *fakeTokens, *memoryLockoutStore, *fakeStore, sqlc.User) {
+	t.Helper()
+	store := newFakeStore()
+	user := store.addUser(sqlc.User{
+		Username:        "alice",
+		Email:           "alice@example.com",
+		EmailOtpEnabled: true,
+		SmsOtpEnabled:   true,
+		PhoneNumber:     pgtype.Text{String: testPhone, Valid: true},
+	})
+	usr, db, tokens, locks := newTestAuthService(store)
+	return usr, db, tokens, locks, store, user
+}
+
+func otpTemp(user sqlc.User) *jwtImpl.TempTOTPTokenClaims {
+	return &jwtImpl.TempTOTPTokenClaims{
+		UserID:   user.ID,
+		Role:     user.Role,
+		Email:    user.Email,
+		SMS:      true,
+		EmailOTP: true,
+		AMR:      []string{amrPassword},
+	}
+}
+
+func TestValidateEmailOTP(t *testing.T) {
+	usr, _, tokens, _, store, user := newOTPUser(t)
+	store.addEmailCode(user.ID, "123456")
+
+	if _, _, err := usr.ValidateEmailOTP(context.Background(), otpTemp(user), "123456", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{amrPassword, amrEmail, amrMFA}; !slices.Equal(tokens.claims.AMR, want) {
+		t.Errorf("amr %v, want %v", tokens.claims.AMR, want)
+	}
+
+	// consumed, a replay is refused
+	_, _, err := usr.ValidateEmailOTP(context.Background(), otpTemp(user), "123456", nil)
+	if code := errCode(t, err); code != "INVALID_EMAIL_OTP" {
+		t.Fatalf("replay: %s, want INVALID_EMAIL_OTP", code)
+	}
+}
+
+func TestValidateEmailOTPWrongCode(t *testing.T) {
+	usr, _, _, locks, store, user := newOTPUser(t)
+	store.addEmailCode(user.ID, "123456")
+
+	_, _, err := usr.ValidateEmailOTP(context.Background(), otpTemp(user), "654321", nil)
+	if code := errCode(t, err); code != "INVALID_EMAIL_OTP" {
+		t.Fatalf("%s, want INVALID_EMAIL_OTP", code)
+	}
+	if n := locks.count(lockout.SecondFactorKey(user.ID.String())); n != 1 {
+		t.Errorf("%d lockout failures, want 1", n)
+	}
+	if store.emailCodes[0].ConsumedAt.Valid {
+		t.Error("a wrong code consumed the code")
+	}
+}
+
+func TestValidateEmailOTPAttemptsExceeded(t *testing.T) {
+	usr, _, _, _, store, user := newOTPUser(t)
+	store.addEmailCode(user.ID, "123456")
+
+	for range emailOTPMaxAttempts {
+		usr.ValidateEmailOTP(context.Background(), otpTemp(user), "000000", nil)
+	}
+
+	// the right code comes too late, the code is dropped
+	_, _, err := usr.ValidateEmailOTP(context.Background(), otpTemp(user), "123456", nil)
+	if code := errCode(t, err); code != "EMAIL_OTP_ATTEMPTS_EXCEEDED" {
+		t.Fatalf("%s, want EMAIL_OTP_ATTEMPTS_EXCEEDED", code)
+	}
+	if len(store.emailCodes) != 0 {
+		t.Errorf("%d codes kept, want 0", len(store.emailCodes))
+	}
+}
+
+func TestValidateSMSOTP(t *testing.T) {
+	usr, _, tokens, locks, store, user := newOTPUser(t)
+	store.addSMSCode(user.ID, testPhone, smsPurposeLogin, "123456")
+
+	_, _, err := usr.ValidateSMSOTP(context.Background(), otpTemp(user), "654321", nil)
+	if code := errCode(t, err); code != "INVALID_SMS_OTP" {
+		t.Fatalf("%s, want INVALID_SMS_OTP", code)
+	}
+	if n := locks.count(lockout.SecondFactorKey(user.ID.String())); n != 1 {
+		t.Errorf("%d lockout failures, want 1", n)
+	}
+
+	if _, _, err := usr.ValidateSMSOTP(context.Background(), otpTemp(user), "123456", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{amrPassword, amrSMS, amrMFA}; !slices.Equal(tokens.claims.AMR, want) {
+		t.Errorf("amr %v, want %v", tokens.claims.AMR, want)
+	}
+	if n := locks.count(lockout.SecondFactorKey(user.ID.String())); n != 0 {
+		t.Errorf("%d lockout failures after the success, want 0", n)
+	}
+}
+
+func TestValidateSMSOTPEnrollmentCode(t *testing.T) {
+	usr, _, _, _, store, user := newOTPUser(t)
+	store.addSMSCode(user.ID, testPhone, smsPurposeEnroll, "123456")
+
+	_, _, err := usr.ValidateSMSOTP(context.Background(), otpTemp(user), "123456", nil)
+	if code := errCode(t, err); code != "INVALID_SMS_OTP" {
+		t.Fatalf("%s, want INVALID_SMS_OTP", code)
+	}
+}
+
+func TestSendSMSOTPKeepsTheEnrollmentCode(t *testing.T) {
+	usr, _, _, _, store, user := newOTPUser(t)
+	texts := sms.NewMemorySender()
+	usr.sms = texts
+	// a new number is being confirmed while the user logs in
+	store.addSMSCode(user.ID, "+33698765432", smsPurposeEnroll, "123456")
+
+	if _, err := usr.SendSMSOTP(context.Background(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+	usr.jobs.Wait()
+
+	if _, ok := texts.Last(testPhone); !ok {
+		t.Error("no login code texted")
+	}
+	purposes := []string{}
+	for _, code := range store.smsCodes {
+		purposes = append(purposes, code.Purpose)
+	}
+	if want := []string{smsPurposeEnroll, smsPurposeLogin}; !slices.Equal(purposes, want) {
+		t.Errorf("codes %v, want %v", purposes, want)
+	}
+}
+
+func TestValidateSMSOTPNotOffered(t *testing.T) {
+	usr, db, _, _, store, user := newOTPUser(t)
+	store.addSMSCode(user.ID, testPhone, smsPurposeLogin, "123456")
+
+	// the factor was enabled after the password step
+	temp := otpTemp(user)
+	temp.SMS = false
+
+	_, _, err := usr.ValidateSMSOTP(context.Background(), temp, "123456", nil)
+	if code := errCode(t, err); code != "SMS_OTP_NOT_ENABLED" {
+		t.Fatalf("%s, want SMS_OTP_NOT_ENABLED", code)
+	}
+	if n := db.ran("GetActiveSMSOTP"); n != 0 {
+		t.Errorf("the code was looked up %d times", n)
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// serviceTokenTTL is short, a revoked service account keeps working until its
+// tokens expire for the verifiers that only check the signature
+const serviceTokenTTL = 15 * time.Minute
+
+// scopes of the service accounts: lower case words, ":" "." "_" "-" allowed
+var serviceScopeRe = regexp.MustCompile(`^[a-z][a-z0-9:._-]{0,63}$`)
+
+func serviceAccountNotFoundErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusNotFound,
+		Code:    "SERVICE_ACCOUNT_NOT_FOUND",
+		Err:     "Unknown or revoked service account",
+		Details: nil,
+	}
+}
+
+func serviceAccountDTO(client *sqlc.OauthClient, secret string) *dtos.ServiceAccountDTO {
+	account := &dtos.ServiceAccountDTO{
+		ClientID:     client.ClientID,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		CreatedAt:    client.CreatedAt.Time,
+		ClientSecret: secret,
+	}
+	if client.RevokedAt.Valid {
+		account.RevokedAt = &client.RevokedAt.Time
+	}
+	return account
+}
+
+// ClientCredentials issues an access token to a service account for itself,
+// no refresh token: the account asks again with its credentials
+func (oas *OAuthService) ClientCredentials(ctx context.Context, client *sqlc.OauthClient, scope string) (*dtos.TokenResponse, error) {
+	if !client.ServiceAccount {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusBadRequest,
+			Code:    "unauthorized_client",
+			Err:     "The client isn't a service account",
+			Details: nil,
+		}
+	}
+
+	// every scope of the account when none is requested
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, s := range scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_scope",
+				Err:     "The service account can't request these scopes",
+				Details: nil,
+			}
+		}
+	}
+
+	jti, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	granted := strings.Join(scopes, " ")
+	claims := &jwtImpl.CustomAccessTokenClaims{
+		Role:     principal.RoleService,
+		Scope:    granted,
+		ClientID: client.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   client.ClientID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(serviceTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	accessToken, err := jwtImpl.GenerateAccessToken(claims)
+	if err != nil {
+		logger.Error("failed to sign the service token", zap.Error(err))
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "server_error",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("service token issued",
+		zap.String("clientId", client.ClientID),
+		zap.String("scope", granted),
+	)
+	return &dtos.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(serviceTokenTTL.Seconds()),
+		Scope:       granted,
+	}, nil
+}
+
+// CreateServiceAccount registers a confidential client for the client
+// credentials grant, the secret is only returned here
+func (oas *OAuthService) CreateServiceAccount(ctx context.Context, by *principal.Principal, name string, scopes []string) (*dtos.ServiceAccountDTO, error) {
+	for _, scope := range scopes {
+		// the openid scopes describe a user, a service has none
+		if !serviceScopeRe.MatchString(scope) || slices.Contains([]string{ScopeOpenID, ScopeProfile, ScopeEmail}, scope) {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusBadRequest,
+				Code:    "INVALID_SCOPE",
+				Err:     "Invalid scope " + scope,
+				Details: nil,
+			}
+		}
+	}
+
+	// a service can't create an account with more rights than its own
+	if by.IsService() {
+		for _, scope := range scopes {
+			if !by.HasScope(scope) {
+				return nil, &dtos.ApiErr{
+					Status:  http.StatusForbidden,
+					Code:    "INSUFFICIENT_SCOPE",
+					Err:     "The service can't grant the scope " + scope + " it doesn't hold",
+					Details: nil,
+				}
+			}
+		}
+	}
+
+	client, secret, err := oas.CreateClient(ctx, &OAuthClientParams{
+		Name:           name,
+		Scopes:         slices.Compact(slices.Sorted(slices.Values(scopes))),
+		ServiceAccount: true,
+		CreatedBy:      by.UserID,
+	})
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("service account created",
+		zap.String("clientId", client.ClientID),
+		zap.String("by", by.String()),
+	)
+	return serviceAccountDTO(client, secret), nil
+}
+
+func (oas *OAuthService) ListServiceAccounts(ctx context.Context) ([]dtos.ServiceAccountDTO, error) {
+	clients, err := oas.queries.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	result := make([]dtos.ServiceAccountDTO, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, *serviceAccountDTO(&client, ""))
+	}
+	return result, nil
+}
+
+// RotateServiceAccountSecret replaces the secret, the previous one stops
+// working at once while the tokens already issued live until they expire
+func (oas *OAuthService) RotateServiceAccountSecret(ctx context.Context, by *principal.Principal, clientID string) (*dtos.ServiceAccountDTO, error) {
+	secret, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := oas.queries.RotateServiceAccountSecret(ctx, sqlc.RotateServiceAccountSecretParams{
+		ClientID:   clientID,
+		SecretHash: securetoken.Hash(secret),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, serviceAccountNotFoundErr()
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("service account secret rotated",
+		zap.String("clientId", clientID),
+		zap.String("by", by.String()),
+	)
+	return serviceAccountDTO(&client, secret), nil
+}
+
+// RevokeServiceAccount disables the account, its tokens are rejected by the
+// revocation check from now on
+func (oas *OAuthService) RevokeServiceAccount(ctx context.Context, by *principal.Principal, clientID string) error {
+	rows, err := oas.queries.RevokeServiceAccount(ctx, clientID)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		return serviceAccountNotFoundErr()
+	}
+
+	logger.Info("service account revoked",
+		zap.String("clientId", clientID),
+		zap.String("by", by.String()),
+	)
+	return nil
+}
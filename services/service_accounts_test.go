@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/principal"
+)
+
+func TestServiceCantCreateAnAccountWithMoreScopes(t *testing.T) {
+	oas, db, _ := newTestOAuthService(newFakeStore())
+	by := &principal.Principal{
+		Kind:     principal.Service,
+		ID:       "provisioner",
+		ClientID: "provisioner",
+		Role:     principal.RoleService,
+		Scopes:   []string{"admin:service-accounts", "orders:read"},
+	}
+
+	_, err := oas.CreateServiceAccount(context.Background(), by, "billing", []string{"orders:read", "admin:lockouts"})
+	if code := errCode(t, err); code != "INSUFFICIENT_SCOPE" {
+		t.Fatalf("got %q, want INSUFFICIENT_SCOPE", code)
+	}
+	if n := db.ran("CreateOAuthClient"); n != 0 {
+		t.Errorf("the account was created %d times", n)
+	}
+
+	// the scopes it holds can be granted
+	db.one["CreateOAuthClient"] = func(args []any) (any, error) {
+		return sqlc.OauthClient{ClientID: args[0].(string), Name: args[1].(string), Scopes: args[3].([]string), ServiceAccount: true}, nil
+	}
+	account, err := oas.CreateServiceAccount(context.Background(), by, "billing", []string{"orders:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(account.Scopes, []string{"orders:read"}) {
+		t.Errorf("scopes %v, want [orders:read]", account.Scopes)
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+type SessionServiceI interface {
+	ListSessions(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) ([]dtos.SessionDTO, error)
+	RevokeSession(ctx context.Context, userID pgtype.UUID, sessionID pgtype.UUID) error
+	Touch(ctx context.Context, sessionID pgtype.UUID) error
+}
+
+type SessionService struct {
+	queries *sqlc.Queries
+	tokens  TokenServiceI
+}
+
+func NewSessionService(qrs *sqlc.Queries, tokSrv TokenServiceI) SessionServiceI {
+	return &SessionService{
+		queries: qrs,
+		tokens:  tokSrv,
+	}
+}
+
+// ListSessions returns the active sessions (devices) of the user, the one
+// the access token belongs to is flagged as current
+func (ss *SessionService) ListSessions(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) ([]dtos.SessionDTO, error) {
+
+	// a session idle for longer than a refresh token lives can't be resumed
+	sessions, err := ss.queries.ListUserSessions(ctx, sqlc.ListUserSessionsParams{
+		UserID: claims.UserID,
+		ActiveSince: pgtype.Timestamptz{
+			Time:  time.Now().Add(-jwtImpl.RefreshTokenTTL),
+			Valid: true,
+		},
+	})
+	if err != nil {
+		logger.Error("failed to list sessions",
+			zap.String("userId", claims.UserID.String()),
+			zap.Error(err),
+		)
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	result := make([]dtos.SessionDTO, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, dtos.SessionDTO{
+			ID:         session.ID.String(),
+			UserAgent:  session.UserAgent,
+			IP:         session.Ip,
+			Protocol:   session.Protocol,
+			CreatedAt:  session.CreatedAt.Time,
+			LastSeenAt: session.LastSeenAt.Time,
+			Current:    session.ID == claims.SessionID,
+		})
+	}
+
+	return result, nil
+}
+
+func (ss *SessionService) RevokeSession(ctx context.Context, userID pgtype.UUID, sessionID pgtype.UUID) error {
+	if err := ss.tokens.EndSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	logger.Info("Session revoked",
+		zap.String("userId", userID.String()),
+		zap.String("sessionId", sessionID.String()),
+	)
+	return nil
+}
+
+// Touch updates the last seen time of the session, at most once a minute
+func (ss *SessionService) Touch(ctx context.Context, sessionID pgtype.UUID) error {
+	return ss.queries.TouchSession(ctx, sessionID)
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "https://localhost"
+)
+
+// authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+func newTestRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "echoAuth tests",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+// softAuthenticator is a P-256 authenticator in memory holding one
+// credential, it answers the ceremonies like a browser would
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 32)
+	rand.Read(credentialID)
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (sa *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   b64(challenge),
+		"origin":      testOrigin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return data
+}
+
+// authData builds the authenticator data, the attested credential is added
+// for a registration
+func (sa *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, sa.signCount)
+	return append(data, attested...)
+}
+
+func (sa *softAuthenticator) coseKey() []byte {
+	key, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: sa.key.X.FillBytes(make([]byte, 32)),
+		YCoord: sa.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return key
+}
+
+// create answers navigator.credentials.create with a "none" attestation
+func (sa *softAuthenticator) create(options any) json.RawMessage {
+	creation, ok := options.(*protocol.CredentialCreation)
+	if !ok {
+		sa.t.Fatalf("registration options are %T", options)
+	}
+	sa.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	attested := make([]byte, 16) // aaguid
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(sa.credentialID)))
+	attested = append(attested, sa.credentialID...)
+	attested = append(attested, sa.coseKey()...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": sa.authData(flagUserPresent|flagUserVerified|flagAttested, attested),
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return sa.marshal(map[string]any{
+		"id":    b64(sa.credentialID),
+		"rawId": b64(sa.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(sa.clientData("webauthn.create", creation.Response.Challenge)),
+			"attestationObject": b64(attestation),
+			"transports":        []string{"usb"},
+		},
+	})
+}
+
+// get answers navigator.credentials.get, the counter goes up on each use
+func (sa *softAuthenticator) get(options any) json.RawMessage {
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		sa.t.Fatalf("login options are %T", options)
+	}
+	sa.signCount++
+	return sa.sign(assertion.Response.Challenge)
+}
+
+func (sa *softAuthenticator) sign(challenge protocol.URLEncodedBase64) json.RawMessage {
+	clientData := sa.clientData("webauthn.get", challenge)
+	authData := sa.authData(flagUserPresent|flagUserVerified, nil)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, sa.key, digest[:])
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return sa.marshal(map[string]any{
+		"id":    b64(sa.credentialID),
+		"rawId": b64(sa.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(sa.userHandle),
+		},
+	})
+}
+
+func (sa *softAuthenticator) marshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,501 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/revocation"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/securetoken"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type TokenServiceI interface {
+	StartSession(ctx context.Context, qtx *sqlc.Queries, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) (string, string, error)
+	IssueTokens(ctx context.Context, qtx *sqlc.Queries, claims *jwtImpl.CustomAccessTokenClaims, sessionID pgtype.UUID) (string, string, error)
+	RotateRefreshToken(ctx context.Context, refTok string, clientID string) (string, string, error)
+	RevokeSession(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) error
+	EndSession(ctx context.Context, userID pgtype.UUID, sessionID pgtype.UUID) error
+	RevokeOtherSessions(ctx context.Context, qtx *sqlc.Queries, userID pgtype.UUID, sessionID pgtype.UUID) error
+	RevokeAllSessions(ctx context.Context, userID pgtype.UUID) error
+}
+
+type TokenService struct {
+	queries *sqlc.Queries
+	db      *pgxpool.Pool
+	revoked revocation.Store
+}
+
+func NewTokenService(qrs *sqlc.Queries, pgdb *pgxpool.Pool, store revocation.Store) TokenServiceI {
+	return &TokenService{
+		queries: qrs,
+		db:      pgdb,
+		revoked: store,
+	}
+}
+
+func invalidRefreshErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "INVALID_REFRESH_TOKEN",
+		Err:     "Refresh token is invalid or expired, login again",
+		Details: nil,
+	}
+}
+
+// StartSession records a new login of the user and issues its first token
+// pair. It runs in the transaction of qtx, its own one when nil, so the
+// session is only kept along with what the login consumed (a recovery code,
+// a totp step)
+func (ts *TokenService) StartSession(ctx context.Context, qtx *sqlc.Queries, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) (string, string, error) {
+
+	if qtx == nil {
+		tx, err := transaction.StartTransaction(ctx, ts.db)
+		if err != nil {
+			return "", "", err
+		}
+		defer tx.Rollback(ctx)
+
+		accessToken, refreshToken, err := ts.StartSession(ctx, ts.queries.WithTx(tx), claims, client)
+		if err != nil {
+			return "", "", err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return "", "", err
+		}
+		return accessToken, refreshToken, nil
+	}
+
+	session, err := qtx.CreateSession(ctx, sqlc.CreateSessionParams{
+		UserID:    claims.UserID,
+		UserAgent: client.UserAgent,
+		Ip:        client.IP,
+		Protocol:  client.Protocol,
+		ClientID: pgtype.Text{
+			String: claims.ClientID,
+			Valid:  claims.ClientID != "",
+		},
+		Scope:    claims.Scope,
+		Amr:      append([]string{}, claims.AMR...),
+		AuthTime: timestamptz(claims.AuthTime),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return ts.IssueTokens(ctx, qtx, claims, session.ID)
+}
+
+// IssueTokens signs an access/refresh pair for the session and stores the
+// refresh token, the session id is the family of the refresh token
+func (ts *TokenService) IssueTokens(ctx context.Context, qtx *sqlc.Queries, claims *jwtImpl.CustomAccessTokenClaims, sessionID pgtype.UUID) (string, string, error) {
+
+	if qtx == nil {
+		qtx = ts.queries
+	}
+
+	jti, err := securetoken.Generate()
+	if err != nil {
+		return "", "", err
+	}
+
+	// the access token gets its own jti so it can be revoked on logout
+	if claims.ID, err = securetoken.Generate(); err != nil {
+		return "", "", err
+	}
+	claims.SessionID = sessionID
+
+	expiresAt := time.Now().Add(jwtImpl.RefreshTokenTTL)
+
+	_, err = qtx.CreateRefreshToken(ctx, sqlc.CreateRefreshTokenParams{
+		UserID:    claims.UserID,
+		FamilyID:  sessionID,
+		TokenHash: securetoken.Hash(jti),
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  expiresAt,
+			Valid: true,
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	refClaims := &jwtImpl.CustomRefreshTokenClaims{
+		UserID:       claims.UserID,
+		SessionID:    sessionID,
+		TokenVersion: claims.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return jwtImpl.GenerateToken(claims, refClaims)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new pair, each refresh
+// token can be used once, presenting a used one revokes the whole family. The
+// session must belong to the oauth client (empty for the first party app)
+func (ts *TokenService) RotateRefreshToken(ctx context.Context, refTok string, clientID string) (string, string, error) {
+
+	refClaims, err := jwtImpl.ParseRefreshToken(refTok)
+	if err != nil {
+		logger.Info("invalid refresh token", zap.Error(err))
+		return "", "", invalidRefreshErr()
+	}
+
+	tx, err := transaction.StartTransaction(ctx, ts.db)
+	if err != nil {
+		logger.Error("error when startsing a transaction",
+			zap.String("context", "error in function start transaction from utils"),
+			zap.Error(err),
+		)
+
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := ts.queries.WithTx(tx)
+
+	stored, err := qtx.GetRefreshTokenByHash(ctx, securetoken.Hash(refClaims.ID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", invalidRefreshErr()
+		}
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if stored.RevokedAt.Valid || stored.ExpiresAt.Time.Before(time.Now()) {
+		return "", "", invalidRefreshErr()
+	}
+
+	// checked before the token is used so another client can't burn it
+	session, err := qtx.GetSession(ctx, stored.FamilyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", invalidRefreshErr()
+		}
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if session.ClientID.String != clientID {
+		logger.Warn("refresh token presented by another client",
+			zap.String("sessionId", session.ID.String()),
+			zap.String("clientId", clientID),
+		)
+		return "", "", invalidRefreshErr()
+	}
+
+	// a used token is presented again, somebody else holds a copy of it
+	rows, err := qtx.MarkRefreshTokenUsed(ctx, stored.ID)
+	if err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		return "", "", ts.revokeReusedFamily(ctx, qtx, tx, stored)
+	}
+
+	if err = qtx.TouchSession(ctx, stored.FamilyID); err != nil {
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	user, err := qtx.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", invalidRefreshErr()
+		}
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	// the password changed since this token was issued
+	if refClaims.TokenVersion != user.TokenVersion {
+		return "", "", invalidRefreshErr()
+	}
+
+	claims := &jwtImpl.CustomAccessTokenClaims{
+		UserID:       user.ID,
+		Role:         user.Role,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		Scope:        session.Scope,
+		ClientID:     session.ClientID.String,
+		AMR:          session.Amr,
+		ACR:          acrFor(session.Amr),
+		AuthTime:     numericDate(session.AuthTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	accessToken, refreshToken, err := ts.IssueTokens(ctx, qtx, claims, stored.FamilyID)
+	if err != nil {
+		logger.Error("failed to refresh the token",
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Error("failed to refresh the token",
+			zap.String("commit", "failed"),
+			zap.String("reason", err.Error()),
+			zap.Error(err),
+		)
+
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// RevokeSession ends the login the access token belongs to
+func (ts *TokenService) RevokeSession(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) error {
+
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	if err := ts.revoked.RevokeToken(ctx, claims.ID, claims.UserID, expiresAt); err != nil {
+		logger.Error("failed to revoke access token",
+			zap.String("userId", claims.UserID.String()),
+			zap.Error(err),
+		)
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if claims.SessionID.Valid {
+		return ts.EndSession(ctx, claims.UserID, claims.SessionID)
+	}
+
+	return nil
+}
+
+// EndSession revokes the session and every refresh token issued for it,
+// access tokens carrying its sid are rejected by the revocation store
+func (ts *TokenService) EndSession(ctx context.Context, userID pgtype.UUID, sessionID pgtype.UUID) error {
+
+	tx, err := transaction.StartTransaction(ctx, ts.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := ts.queries.WithTx(tx)
+
+	rows, err := qtx.RevokeSession(ctx, sqlc.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		return &dtos.ApiErr{
+			Status:  http.StatusNotFound,
+			Code:    "SESSION_NOT_FOUND",
+			Err:     "Session not found or already revoked",
+			Details: nil,
+		}
+	}
+
+	if err = qtx.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+		logger.Error("failed to revoke refresh token family",
+			zap.String("userId", userID.String()),
+			zap.Error(err),
+		)
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions ends every login of the user except the given session,
+// runs in the transaction of the caller
+func (ts *TokenService) RevokeOtherSessions(ctx context.Context, qtx *sqlc.Queries, userID pgtype.UUID, sessionID pgtype.UUID) error {
+
+	if qtx == nil {
+		qtx = ts.queries
+	}
+
+	err := qtx.RevokeOtherUserSessions(ctx, sqlc.RevokeOtherUserSessionsParams{
+		UserID: userID,
+		ID:     sessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return qtx.RevokeOtherUserRefreshTokens(ctx, sqlc.RevokeOtherUserRefreshTokensParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+}
+
+// RevokeAllSessions ends every login of the user
+func (ts *TokenService) RevokeAllSessions(ctx context.Context, userID pgtype.UUID) error {
+
+	if err := ts.queries.RevokeUserSessions(ctx, userID); err != nil {
+		logger.Error("failed to revoke sessions",
+			zap.String("userId", userID.String()),
+			zap.Error(err),
+		)
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := ts.queries.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		logger.Error("failed to revoke refresh tokens",
+			zap.String("userId", userID.String()),
+			zap.Error(err),
+		)
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := ts.revoked.RevokeAllForUser(ctx, userID); err != nil {
+		logger.Error("failed to revoke access tokens",
+			zap.String("userId", userID.String()),
+			zap.Error(err),
+		)
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return nil
+}
+
+func (ts *TokenService) revokeReusedFamily(ctx context.Context, qtx *sqlc.Queries, tx pgx.Tx, stored sqlc.RefreshToken) error {
+	logger.Warn("refresh token reuse detected, revoking family",
+		zap.String("userId", stored.UserID.String()),
+		zap.String("familyId", stored.FamilyID.String()),
+	)
+
+	if _, err := qtx.RevokeSession(ctx, sqlc.RevokeSessionParams{
+		ID:     stored.FamilyID,
+		UserID: stored.UserID,
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := qtx.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "REFRESH_TOKEN_REUSED",
+		Err:     "Refresh token was already used, the session is revoked",
+		Details: nil,
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+)
+
+// totpAlgorithm maps the configured algorithm name, config.Init already
+// rejected unknown names
+func totpAlgorithm() otp.Algorithm {
+	switch config.AppConfig.TOTPAlgorithm {
+	case "SHA256":
+		return otp.AlgorithmSHA256
+	case "SHA512":
+		return otp.AlgorithmSHA512
+	default:
+		return otp.AlgorithmSHA1
+	}
+}
+
+// generateTOTPKey creates a new secret with the configured parameters
+func generateTOTPKey(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      config.AppConfig.TOTPIssuer,
+		AccountName: accountName,
+		Period:      config.AppConfig.TOTPPeriod,
+		Digits:      otp.Digits(config.AppConfig.TOTPDigits),
+		Algorithm:   totpAlgorithm(),
+	})
+}
+
+// matchTOTPStep returns the time step the code was generated for, the steps
+// within the configured skew around now are checked
+func matchTOTPStep(code string, secret string, now time.Time) (int64, bool) {
+	if secret == "" {
+		return 0, false
+	}
+
+	period := int64(config.AppConfig.TOTPPeriod)
+	skew := int64(config.AppConfig.TOTPSkew)
+	opts := hotp.ValidateOpts{
+		Digits:    otp.Digits(config.AppConfig.TOTPDigits),
+		Algorithm: totpAlgorithm(),
+	}
+
+	current := now.Unix() / period
+	for step := current - skew; step <= current+skew; step++ {
+		if step < 0 {
+			continue
+		}
+		valid, err := hotp.ValidateCustom(code, uint64(step), secret, opts)
+		if err != nil {
+			return 0, false
+		}
+		if valid {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// verifyTOTP checks a code of the active secret and records its time step, a
+// code from the last accepted step or an earlier one is rejected as a replay
+func (usr *AuthService) verifyTOTP(ctx context.Context, qtx *sqlc.Queries, user *sqlc.User, code string) (bool, error) {
+
+	secret, err := usr.openTOTPSecret(user.ID, user.TotpSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := matchTOTPStep(code, secret, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// the update is conditional so two requests racing with the same code
+	// can't both be accepted
+	rows, err := qtx.AcceptTOTPStep(ctx, sqlc.AcceptTOTPStepParams{
+		ID: user.ID,
+		TotpLastStep: pgtype.Int8{
+			Int64: step,
+			Valid: true,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		logger.Warn("replayed TOTP code rejected",
+			zap.String("userId", user.ID.String()),
+		)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// sealTOTPSecret encrypts a secret before it's stored, the user id is the
+// additional data so a sealed secret can't be moved to another account
+func (usr *AuthService) sealTOTPSecret(userID pgtype.UUID, secret string) (string, error) {
+	return usr.secrets.Encrypt(secret, userID.Bytes[:])
+}
+
+// openTOTPSecret decrypts a stored secret, secrets stored before encryption
+// was enabled are returned as they are
+func (usr *AuthService) openTOTPSecret(userID pgtype.UUID, stored pgtype.Text) (string, error) {
+	if !stored.Valid {
+		return "", nil
+	}
+	return usr.secrets.Decrypt(stored.String, userID.Bytes[:])
+}
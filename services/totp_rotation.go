@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/secretbox"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// users loaded per page by the re-encryption pass
+const reencryptPageSize = 100
+
+// ReencryptTOTPSecrets seals again every stored secret (active and pending)
+// that isn't encrypted with the active key, plaintext secrets included. A row
+// changed while it's processed is skipped and picked up by the next pass. It
+// returns the number of users updated
+func ReencryptTOTPSecrets(ctx context.Context, qrs *sqlc.Queries, secrets *secretbox.Keyring) (int, error) {
+
+	if !secrets.Enabled() {
+		return 0, nil
+	}
+
+	var (
+		updated int
+		failed  int
+		lastID  pgtype.UUID
+	)
+	// the nil uuid sorts before every id
+	lastID.Valid = true
+
+	for {
+		rows, err := qrs.ListTOTPSecrets(ctx, sqlc.ListTOTPSecretsParams{
+			ID:    lastID,
+			Limit: reencryptPageSize,
+		})
+		if err != nil {
+			return updated, err
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+
+			secret, secretChanged, err := reseal(secrets, row.ID, row.TotpSecret)
+			if err != nil {
+				failed++
+				logger.Error("failed to re-encrypt totp secret",
+					zap.String("userId", row.ID.String()),
+					zap.Error(err),
+				)
+				continue
+			}
+			pending, pendingChanged, err := reseal(secrets, row.ID, row.TotpPendingSecret)
+			if err != nil {
+				failed++
+				logger.Error("failed to re-encrypt pending totp secret",
+					zap.String("userId", row.ID.String()),
+					zap.Error(err),
+				)
+				continue
+			}
+			if !secretChanged && !pendingChanged {
+				continue
+			}
+
+			// compare and swap, a concurrent 2FA setup wins over the pass
+			n, err := qrs.ReplaceTOTPSecrets(ctx, sqlc.ReplaceTOTPSecretsParams{
+				ID:                   row.ID,
+				TotpSecret:           secret,
+				TotpPendingSecret:    pending,
+				OldTotpSecret:        row.TotpSecret,
+				OldTotpPendingSecret: row.TotpPendingSecret,
+			})
+			if err != nil {
+				return updated, err
+			}
+			updated += int(n)
+		}
+
+		if len(rows) < reencryptPageSize {
+			break
+		}
+	}
+
+	if failed > 0 {
+		return updated, fmt.Errorf("%d users could not be re-encrypted", failed)
+	}
+	return updated, nil
+}
+
+// reseal decrypts a stored secret and encrypts it with the active key when
+// it's needed, it reports if the value changed
+func reseal(secrets *secretbox.Keyring, userID pgtype.UUID, stored pgtype.Text) (pgtype.Text, bool, error) {
+	if !stored.Valid || !secrets.NeedsRotation(stored.String) {
+		return stored, false, nil
+	}
+
+	plain, err := secrets.Decrypt(stored.String, userID.Bytes[:])
+	if err != nil {
+		return stored, false, err
+	}
+	sealed, err := secrets.Encrypt(plain, userID.Bytes[:])
+	if err != nil {
+		return stored, false, err
+	}
+
+	return pgtype.Text{
+		String: sealed,
+		Valid:  true,
+	}, true, nil
+}
@@ -0,0 +1,782 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/internal/logger"
+	"github.com/BigBr41n/echoAuth/internal/passkey"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/BigBr41n/echoAuth/utils/transaction"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// ceremonies a stored challenge was issued for
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+// amr of a login with an authenticator holding a key (RFC 8176)
+const amrHardwareKey = "hwk"
+
+func webAuthnChallengeErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "WEBAUTHN_CHALLENGE_EXPIRED",
+		Err:     "The challenge is unknown or expired, start again",
+		Details: nil,
+	}
+}
+
+func webAuthnNotRegisteredErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusNotFound,
+		Code:    "WEBAUTHN_NOT_REGISTERED",
+		Err:     "No passkey or security key is registered",
+		Details: nil,
+	}
+}
+
+func webAuthnSecondFactorNotEnabledErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusBadRequest,
+		Code:    "WEBAUTHN_2FA_NOT_ENABLED",
+		Err:     "Passkeys are not asked as a second factor for this account",
+		Details: nil,
+	}
+}
+
+// webAuthnClonedErr refuses a counter that didn't move forward: two copies of
+// the key may exist
+func webAuthnClonedErr() *dtos.ApiErr {
+	return &dtos.ApiErr{
+		Status:  http.StatusUnauthorized,
+		Code:    "WEBAUTHN_CLONED_AUTHENTICATOR",
+		Err:     "The authenticator may have been cloned, use another one",
+		Details: nil,
+	}
+}
+
+// webAuthnErr reports a response the library refused, the debug info of the
+// library is only logged
+func webAuthnErr(status int, err error) *dtos.ApiErr {
+	msg := err.Error()
+	var protoErr *protocol.Error
+	if errors.As(err, &protoErr) {
+		msg = protoErr.Details
+		logger.Warn("webauthn response refused",
+			zap.String("type", protoErr.Type),
+			zap.String("info", protoErr.DevInfo),
+		)
+	}
+	return &dtos.ApiErr{
+		Status:  status,
+		Code:    "INVALID_WEBAUTHN_RESPONSE",
+		Err:     msg,
+		Details: nil,
+	}
+}
+
+// webAuthnUser adapts a user and its stored credentials to the library, the
+// user handle is the user id
+type webAuthnUser struct {
+	user        sqlc.User
+	credentials []sqlc.WebauthnCredential
+}
+
+func (wu *webAuthnUser) WebAuthnID() []byte {
+	return wu.user.ID.Bytes[:]
+}
+
+func (wu *webAuthnUser) WebAuthnName() string {
+	return wu.user.Email
+}
+
+func (wu *webAuthnUser) WebAuthnDisplayName() string {
+	return wu.user.Username
+}
+
+func (wu *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(wu.credentials))
+	for _, cred := range wu.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(cred.Transports))
+		for _, t := range cred.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              cred.CredentialID,
+			PublicKey:       cred.PublicKey,
+			AttestationType: cred.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				BackupEligible: cred.BackupEligible,
+				BackupState:    cred.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    cred.Aaguid,
+				SignCount: uint32(cred.SignCount),
+			},
+		})
+	}
+	return credentials
+}
+
+// stored returns the row of a credential the library validated
+func (wu *webAuthnUser) stored(credentialID []byte) (sqlc.WebauthnCredential, bool) {
+	i := slices.IndexFunc(wu.credentials, func(cred sqlc.WebauthnCredential) bool {
+		return bytes.Equal(cred.CredentialID, credentialID)
+	})
+	if i < 0 {
+		return sqlc.WebauthnCredential{}, false
+	}
+	return wu.credentials[i], true
+}
+
+func webAuthnCredentialDTO(cred *sqlc.WebauthnCredential) dtos.WebAuthnCredentialDTO {
+	dto := dtos.WebAuthnCredentialDTO{
+		ID:         cred.ID.String(),
+		Name:       cred.Name,
+		Transports: cred.Transports,
+		Synced:     cred.BackupState,
+		CreatedAt:  cred.CreatedAt.Time,
+	}
+	if cred.LastUsedAt.Valid {
+		dto.LastUsedAt = &cred.LastUsedAt.Time
+	}
+	return dto
+}
+
+func (usr *AuthService) loadWebAuthnUser(ctx context.Context, userID pgtype.UUID) (*webAuthnUser, error) {
+	user, err := usr.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusNotFound,
+				Code:    "USER_NOT_FOUND",
+				Err:     "User not found",
+				Details: nil,
+			}
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	credentials, err := usr.queries.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// factors returns the second factors enrolled by the user
+func (wu *webAuthnUser) factors() []string {
+	return enrolledFactors(&wu.user, int64(len(wu.credentials)))
+}
+
+// saveChallenge stores the session data of a ceremony until the answer of the
+// authenticator, the id is given to the client. amr keeps the methods of the
+// login step done before a second factor
+func (usr *AuthService) saveChallenge(ctx context.Context, userID pgtype.UUID, ceremony string, amr []string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	challenge, err := usr.queries.CreateWebAuthnChallenge(ctx, sqlc.CreateWebAuthnChallengeParams{
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: data,
+		ExpiresAt: pgtype.Timestamptz{
+			Time:  time.Now().Add(passkey.ChallengeTTL),
+			Valid: true,
+		},
+		Amr: amr,
+	})
+	if err != nil {
+		return "", err
+	}
+	return challenge.ID.String(), nil
+}
+
+// consumeChallenge deletes the challenge as it's read, an answer can't be
+// replayed
+func (usr *AuthService) consumeChallenge(ctx context.Context, challengeID string, ceremony string) (*sqlc.WebauthnChallenge, *webauthn.SessionData, error) {
+	var id pgtype.UUID
+	if err := id.Scan(challengeID); err != nil {
+		return nil, nil, webAuthnChallengeErr()
+	}
+
+	challenge, err := usr.queries.ConsumeWebAuthnChallenge(ctx, sqlc.ConsumeWebAuthnChallengeParams{
+		ID:       id,
+		Ceremony: ceremony,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, webAuthnChallengeErr()
+		}
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(challenge.SessionData, &session); err != nil {
+		return nil, nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	return &challenge, &session, nil
+}
+
+// BeginWebAuthnRegistration returns the options of navigator.credentials.create,
+// a discoverable credential (passkey) is asked when the authenticator can
+func (usr *AuthService) BeginWebAuthnRegistration(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims) (*dtos.WebAuthnOptionsDTO, error) {
+	wu, err := usr.loadWebAuthnUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireMFA(wu.factors(), claims); err != nil {
+		return nil, err
+	}
+
+	creation, session, err := usr.passkeys.BeginRegistration(wu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(webauthn.Credentials(wu.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	challengeID, err := usr.saveChallenge(ctx, wu.user.ID, ceremonyRegistration, nil, session)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &dtos.WebAuthnOptionsDTO{
+		ChallengeID: challengeID,
+		Options:     creation,
+	}, nil
+}
+
+// FinishWebAuthnRegistration verifies the attestation of the authenticator
+// and stores the new credential
+func (usr *AuthService) FinishWebAuthnRegistration(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, input *dtos.WebAuthnRegisterDTO, client *ClientInfo) (*dtos.WebAuthnCredentialDTO, error) {
+	challenge, session, err := usr.consumeChallenge(ctx, input.ChallengeID, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	// a challenge of another account
+	if challenge.UserID != claims.UserID {
+		return nil, webAuthnChallengeErr()
+	}
+
+	wu, err := usr.loadWebAuthnUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		return nil, webAuthnErr(http.StatusBadRequest, err)
+	}
+	credential, err := usr.passkeys.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		return nil, webAuthnErr(http.StatusBadRequest, err)
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	stored, err := qtx.CreateWebAuthnCredential(ctx, sqlc.CreateWebAuthnCredentialParams{
+		UserID:          claims.UserID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Aaguid:          append([]byte{}, credential.Authenticator.AAGUID...),
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            input.Name,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, &dtos.ApiErr{
+				Status:  http.StatusConflict,
+				Code:    "WEBAUTHN_CREDENTIAL_EXISTS",
+				Err:     "This authenticator is already registered",
+				Details: nil,
+			}
+		}
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	details := map[string]any{"credentialId": stored.ID.String(), "name": stored.Name}
+	if err := recordAuditEvent(ctx, qtx, claims.UserID, auditWebAuthnRegistered, client, details); err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("webauthn credential registered",
+		zap.String("userId", claims.UserID.String()),
+		zap.String("credentialId", stored.ID.String()),
+	)
+	dto := webAuthnCredentialDTO(&stored)
+	return &dto, nil
+}
+
+func (usr *AuthService) ListWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) ([]dtos.WebAuthnCredentialDTO, error) {
+	credentials, err := usr.queries.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	result := make([]dtos.WebAuthnCredentialDTO, 0, len(credentials))
+	for _, cred := range credentials {
+		result = append(result, webAuthnCredentialDTO(&cred))
+	}
+	return result, nil
+}
+
+// DeleteWebAuthnCredential removes a credential of the user, the
+// authenticator can't log in anymore
+func (usr *AuthService) DeleteWebAuthnCredential(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, credentialID pgtype.UUID, client *ClientInfo) error {
+	wu, err := usr.loadWebAuthnUser(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if err := requireMFA(wu.factors(), claims); err != nil {
+		return err
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	rows, err := qtx.DeleteWebAuthnCredential(ctx, sqlc.DeleteWebAuthnCredentialParams{
+		ID:     credentialID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		return &dtos.ApiErr{
+			Status:  http.StatusNotFound,
+			Code:    "WEBAUTHN_CREDENTIAL_NOT_FOUND",
+			Err:     "Unknown credential",
+			Details: nil,
+		}
+	}
+
+	// without passkeys the opt in is dropped, a later passkey doesn't become
+	// a second factor on its own
+	if wu.user.WebauthnSecondFactor {
+		left, err := qtx.CountWebAuthnCredentials(ctx, claims.UserID)
+		if err != nil {
+			return &dtos.ApiErr{
+				Status:  http.StatusInternalServerError,
+				Code:    "INTERNAL_ERROR",
+				Err:     err.Error(),
+				Details: nil,
+			}
+		}
+		if left == 0 {
+			if err := qtx.SetWebAuthnSecondFactor(ctx, sqlc.SetWebAuthnSecondFactorParams{
+				ID:                   claims.UserID,
+				WebauthnSecondFactor: false,
+			}); err != nil {
+				return &dtos.ApiErr{
+					Status:  http.StatusInternalServerError,
+					Code:    "INTERNAL_ERROR",
+					Err:     err.Error(),
+					Details: nil,
+				}
+			}
+		}
+	}
+
+	details := map[string]any{"credentialId": credentialID.String()}
+	if err := recordAuditEvent(ctx, qtx, claims.UserID, auditWebAuthnRemoved, client, details); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("webauthn credential removed",
+		zap.String("userId", claims.UserID.String()),
+		zap.String("credentialId", credentialID.String()),
+	)
+	return nil
+}
+
+// EnableWebAuthnSecondFactor asks for a passkey after the password (or a
+// magic link), a registered passkey alone only gives the passwordless login
+func (usr *AuthService) EnableWebAuthnSecondFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error {
+	return usr.setWebAuthnSecondFactor(ctx, claims, true, client)
+}
+
+// DisableWebAuthnSecondFactor stops asking for a passkey after the password,
+// the passkeys stay registered
+func (usr *AuthService) DisableWebAuthnSecondFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, client *ClientInfo) error {
+	return usr.setWebAuthnSecondFactor(ctx, claims, false, client)
+}
+
+func (usr *AuthService) setWebAuthnSecondFactor(ctx context.Context, claims *jwtImpl.CustomAccessTokenClaims, enabled bool, client *ClientInfo) error {
+	wu, err := usr.loadWebAuthnUser(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	if wu.user.WebauthnSecondFactor == enabled {
+		if enabled {
+			return &dtos.ApiErr{
+				Status:  http.StatusConflict,
+				Code:    "WEBAUTHN_2FA_ALREADY_ENABLED",
+				Err:     "Passkeys are already asked as a second factor",
+				Details: nil,
+			}
+		}
+		return webAuthnSecondFactorNotEnabledErr()
+	}
+	if enabled && len(wu.credentials) == 0 {
+		return webAuthnNotRegisteredErr()
+	}
+	if err := requireMFA(wu.factors(), claims); err != nil {
+		return err
+	}
+
+	tx, err := transaction.StartTransaction(ctx, usr.db)
+	if err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	defer tx.Rollback(ctx)
+	qtx := usr.queries.WithTx(tx)
+
+	if err := qtx.SetWebAuthnSecondFactor(ctx, sqlc.SetWebAuthnSecondFactorParams{
+		ID:                   claims.UserID,
+		WebauthnSecondFactor: enabled,
+	}); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	event := auditWebAuthnEnabled
+	if !enabled {
+		event = auditWebAuthnDisabled
+	}
+	if err := recordAuditEvent(ctx, qtx, claims.UserID, event, client, nil); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	logger.Info("webauthn second factor changed",
+		zap.String("userId", claims.UserID.String()),
+		zap.Bool("enabled", enabled),
+	)
+	return nil
+}
+
+// BeginWebAuthnLogin returns the options of navigator.credentials.get: for the
+// user of a temp token as a second factor, or for any passkey (the user is
+// found from it) without temp token
+func (usr *AuthService) BeginWebAuthnLogin(ctx context.Context, temp *jwtImpl.TempTOTPTokenClaims) (*dtos.WebAuthnOptionsDTO, error) {
+	var assertion *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var userID pgtype.UUID
+	var firstStep []string
+	var err error
+
+	if temp != nil {
+		userID, firstStep = temp.UserID, temp.AMR
+		wu, apiErr := usr.loadWebAuthnUser(ctx, userID)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		if len(wu.credentials) == 0 {
+			return nil, webAuthnNotRegisteredErr()
+		}
+		// offered at the first step, and still enabled
+		if !temp.WebAuthn || !wu.user.WebauthnSecondFactor {
+			return nil, webAuthnSecondFactorNotEnabledErr()
+		}
+		assertion, session, err = usr.passkeys.BeginLogin(wu)
+	} else {
+		// without a password the authenticator must verify the user (pin,
+		// biometrics) to count as two factors
+		assertion, session, err = usr.passkeys.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationRequired),
+		)
+	}
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	challengeID, err := usr.saveChallenge(ctx, userID, ceremonyLogin, firstStep, session)
+	if err != nil {
+		return nil, &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+
+	return &dtos.WebAuthnOptionsDTO{
+		ChallengeID: challengeID,
+		Options:     assertion,
+	}, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion of the authenticator and opens
+// the session
+func (usr *AuthService) FinishWebAuthnLogin(ctx context.Context, input *dtos.WebAuthnLoginDTO, client *ClientInfo) (string, string, error) {
+	challenge, session, err := usr.consumeChallenge(ctx, input.ChallengeID, ceremonyLogin)
+	if err != nil {
+		return "", "", err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		return "", "", webAuthnErr(http.StatusBadRequest, err)
+	}
+
+	var wu *webAuthnUser
+	var credential *webauthn.Credential
+	var amr []string
+
+	if challenge.UserID.Valid {
+		// second factor after the password or a magic link, limited like
+		// the totp
+		lockKey := lockout.SecondFactorKey(challenge.UserID.String())
+		if err := usr.checkLockout(ctx, lockKey, client); err != nil {
+			return "", "", err
+		}
+
+		var apiErr error
+		if wu, apiErr = usr.loadWebAuthnUser(ctx, challenge.UserID); apiErr != nil {
+			return "", "", apiErr
+		}
+		if credential, err = usr.passkeys.ValidateLogin(wu, *session, parsed); err != nil {
+			usr.recordFailure(ctx, lockKey, client)
+			return "", "", webAuthnErr(http.StatusUnauthorized, err)
+		}
+		usr.recordSuccess(ctx, lockKey)
+		amr = withSecondFactor(challenge.Amr, amrHardwareKey)
+	} else {
+		// passwordless: the user handle returned by the passkey is the user id
+		user, cred, err := usr.passkeys.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			if len(userHandle) != len(pgtype.UUID{}.Bytes) {
+				return nil, errors.New("invalid user handle")
+			}
+			id := pgtype.UUID{Valid: true}
+			copy(id.Bytes[:], userHandle)
+			wu, err := usr.loadWebAuthnUser(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return wu, nil
+		}, *session, parsed)
+		if err != nil {
+			return "", "", webAuthnErr(http.StatusUnauthorized, err)
+		}
+		wu, credential = user.(*webAuthnUser), cred
+
+		// the address must be confirmed before the first login
+		if config.AppConfig.RequireEmailVerification && !wu.user.EmailVerifiedAt.Valid {
+			return "", "", &dtos.ApiErr{
+				Status:  http.StatusForbidden,
+				Code:    "EMAIL_NOT_VERIFIED",
+				Err:     "Email address is not verified",
+				Details: nil,
+			}
+		}
+		amr = []string{amrHardwareKey, amrMFA}
+	}
+
+	// the counter went backwards: two copies of the key may exist
+	if credential.Authenticator.CloneWarning {
+		logger.Warn("webauthn sign count went backwards, login refused",
+			zap.String("userId", wu.user.ID.String()),
+		)
+		return "", "", webAuthnClonedErr()
+	}
+
+	// the stored counter is what detects a cloned key, no session without it
+	stored, ok := wu.stored(credential.ID)
+	if !ok {
+		return "", "", webAuthnErr(http.StatusUnauthorized, errors.New("unknown credential"))
+	}
+	// the update is conditional so two logins racing with the same counter
+	// can't both be accepted
+	rows, err := usr.queries.UseWebAuthnCredential(ctx, sqlc.UseWebAuthnCredentialParams{
+		ID:          stored.ID,
+		SignCount:   int64(credential.Authenticator.SignCount),
+		BackupState: credential.Flags.BackupState,
+	})
+	if err != nil {
+		logger.Error("failed to update the webauthn credential", zap.Error(err))
+		return "", "", &dtos.ApiErr{
+			Status:  http.StatusInternalServerError,
+			Code:    "INTERNAL_ERROR",
+			Err:     err.Error(),
+			Details: nil,
+		}
+	}
+	if rows == 0 {
+		logger.Warn("webauthn sign count already used, login refused",
+			zap.String("userId", wu.user.ID.String()),
+		)
+		return "", "", webAuthnClonedErr()
+	}
+
+	return usr.openSession(ctx, nil, &wu.user, amr, client)
+}
+
+// PurgeChallenges drops the webauthn challenges nobody answered and the
+// expired sms and email codes
+func (usr *AuthService) PurgeChallenges(ctx context.Context) error {
+	now := pgtype.Timestamptz{
+		Time:  time.Now(),
+		Valid: true,
+	}
+	if err := usr.queries.DeleteExpiredWebAuthnChallenges(ctx, now); err != nil {
+		return err
+	}
+	if err := usr.queries.DeleteExpiredSMSOTPs(ctx, now); err != nil {
+		return err
+	}
+	return usr.queries.DeleteExpiredEmailOTPs(ctx, now)
+}
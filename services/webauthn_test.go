@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	dtos "github.com/BigBr41n/echoAuth/DTOs"
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/BigBr41n/echoAuth/db/sqlc"
+	"github.com/BigBr41n/echoAuth/internal/lockout"
+	"github.com/BigBr41n/echoAuth/utils/jwtImpl"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// errCode returns the code of an api error, empty for nil
+func errCode(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var apiErr *dtos.ApiErr
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return apiErr.Code
+}
+
+type webAuthnFixture struct {
+	usr    *AuthService
+	db     *fakeDB
+	store  *fakeStore
+	tokens *fakeTokens
+	locks  *memoryLockoutStore
+	user   sqlc.User
+	client *ClientInfo
+}
+
+func newWebAuthnFixture(t *testing.T) *webAuthnFixture {
+	store := newFakeStore()
+	usr, db, tokens, locks := newTestAuthService(store)
+	usr.passkeys = newTestRelyingParty(t)
+
+	user := store.addUser(sqlc.User{
+		Username: "alice",
+		Email:    "alice@example.com",
+	})
+	return &webAuthnFixture{
+		usr:    usr,
+		db:     db,
+		store:  store,
+		tokens: tokens,
+		locks:  locks,
+		user:   user,
+		client: &ClientInfo{IP: "198.51.100.7"},
+	}
+}
+
+func (f *webAuthnFixture) claims() *jwtImpl.CustomAccessTokenClaims {
+	return &jwtImpl.CustomAccessTokenClaims{
+		UserID: f.user.ID,
+		Role:   f.user.Role,
+		Email:  f.user.Email,
+		AMR:    []string{amrPassword},
+	}
+}
+
+// register enrolls a new software authenticator of the user
+func (f *webAuthnFixture) register(t *testing.T) *softAuthenticator {
+	t.Helper()
+	ctx := context.Background()
+	sa := newSoftAuthenticator(t)
+
+	options, err := f.usr.BeginWebAuthnRegistration(ctx, f.claims())
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	_, err = f.usr.FinishWebAuthnRegistration(ctx, f.claims(), &dtos.WebAuthnRegisterDTO{
+		ChallengeID: options.ChallengeID,
+		Name:        "soft key",
+		Credential:  sa.create(options.Options),
+	}, f.client)
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+	return sa
+}
+
+// enableSecondFactor opts in for the passkeys after the password
+func (f *webAuthnFixture) enableSecondFactor(t *testing.T) {
+	t.Helper()
+	if err := f.usr.EnableWebAuthnSecondFactor(context.Background(), f.claims(), f.client); err != nil {
+		t.Fatalf("enable second factor: %v", err)
+	}
+}
+
+// login runs a login ceremony with the authenticator, temp is nil for a
+// passwordless login
+func (f *webAuthnFixture) login(t *testing.T, sa *softAuthenticator, temp *jwtImpl.TempTOTPTokenClaims) error {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := f.usr.BeginWebAuthnLogin(ctx, temp)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	_, _, err = f.usr.FinishWebAuthnLogin(ctx, &dtos.WebAuthnLoginDTO{
+		ChallengeID: options.ChallengeID,
+		Credential:  sa.get(options.Options),
+	}, f.client)
+	return err
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	ctx := context.Background()
+	sa := newSoftAuthenticator(t)
+
+	options, err := f.usr.BeginWebAuthnRegistration(ctx, f.claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := f.usr.FinishWebAuthnRegistration(ctx, f.claims(), &dtos.WebAuthnRegisterDTO{
+		ChallengeID: options.ChallengeID,
+		Name:        "soft key",
+		Credential:  sa.create(options.Options),
+	}, f.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cred.Name != "soft key" || !slices.Equal(cred.Transports, []string{"usb"}) {
+		t.Errorf("unexpected credential %+v", cred)
+	}
+	stored := f.store.credential(0)
+	if string(stored.CredentialID) != string(sa.credentialID) || stored.UserID != f.user.ID {
+		t.Error("the credential of the authenticator isn't stored for the user")
+	}
+	if !slices.Contains(f.db.committed, "CreateAuditEvent") || !slices.Contains(f.store.audit, auditWebAuthnRegistered) {
+		t.Error("the registration isn't audited")
+	}
+}
+
+func TestWebAuthnRegistrationOfAnotherAccount(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	ctx := context.Background()
+	sa := newSoftAuthenticator(t)
+
+	options, err := f.usr.BeginWebAuthnRegistration(ctx, f.claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := f.store.addUser(sqlc.User{Username: "mallory", Email: "mallory@example.com"})
+	_, err = f.usr.FinishWebAuthnRegistration(ctx, &jwtImpl.CustomAccessTokenClaims{UserID: other.ID}, &dtos.WebAuthnRegisterDTO{
+		ChallengeID: options.ChallengeID,
+		Name:        "soft key",
+		Credential:  sa.create(options.Options),
+	}, f.client)
+	if code := errCode(t, err); code != "WEBAUTHN_CHALLENGE_EXPIRED" {
+		t.Errorf("got %q, want WEBAUTHN_CHALLENGE_EXPIRED", code)
+	}
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+
+	if err := f.login(t, sa, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.tokens.claims.UserID != f.user.ID {
+		t.Error("the session isn't opened for the owner of the passkey")
+	}
+	if !slices.Equal(f.tokens.claims.AMR, []string{amrHardwareKey, amrMFA}) {
+		t.Errorf("amr %v, want [hwk mfa]", f.tokens.claims.AMR)
+	}
+	if got := f.store.credential(0).SignCount; got != int64(sa.signCount) {
+		t.Errorf("stored sign count %d, want %d", got, sa.signCount)
+	}
+}
+
+func TestWebAuthnSecondFactorLogin(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+	f.enableSecondFactor(t)
+
+	temp := &jwtImpl.TempTOTPTokenClaims{UserID: f.user.ID, WebAuthn: true, AMR: []string{amrPassword}}
+	if err := f.login(t, sa, temp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(f.tokens.claims.AMR, []string{amrPassword, amrHardwareKey, amrMFA}) {
+		t.Errorf("amr %v, want [pwd hwk mfa]", f.tokens.claims.AMR)
+	}
+}
+
+func TestWebAuthnSecondFactorLoginWithAnotherKey(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+	f.enableSecondFactor(t)
+
+	// same credential id, another private key: the signature doesn't verify
+	forged := newSoftAuthenticator(t)
+	forged.credentialID, forged.userHandle = sa.credentialID, sa.userHandle
+
+	temp := &jwtImpl.TempTOTPTokenClaims{UserID: f.user.ID, WebAuthn: true, AMR: []string{amrPassword}}
+	err := f.login(t, forged, temp)
+	if code := errCode(t, err); code != "INVALID_WEBAUTHN_RESPONSE" {
+		t.Fatalf("got %q, want INVALID_WEBAUTHN_RESPONSE", code)
+	}
+	if f.tokens.claims != nil {
+		t.Error("a session was opened")
+	}
+	if f.locks.count(lockout.SecondFactorKey(f.user.ID.String())) != 1 {
+		t.Error("the failure isn't counted for the lockout")
+	}
+}
+
+func TestWebAuthnSecondFactorWithoutCredential(t *testing.T) {
+	f := newWebAuthnFixture(t)
+
+	temp := &jwtImpl.TempTOTPTokenClaims{UserID: f.user.ID, AMR: []string{amrPassword}}
+	_, err := f.usr.BeginWebAuthnLogin(context.Background(), temp)
+	if code := errCode(t, err); code != "WEBAUTHN_NOT_REGISTERED" {
+		t.Errorf("got %q, want WEBAUTHN_NOT_REGISTERED", code)
+	}
+}
+
+func TestWebAuthnSecondFactorOptIn(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.JWTTOTP = "test temp secret"
+
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+	ctx := context.Background()
+
+	// a registered passkey alone logs in without password, it isn't asked
+	// after one
+	user := f.store.users[f.user.ID]
+	if _, _, err := f.usr.continueLogin(ctx, &user, []string{amrPassword}, f.client); err != nil {
+		t.Fatal(err)
+	}
+	if f.tokens.claims == nil {
+		t.Fatal("the password alone didn't open the session")
+	}
+	temp := &jwtImpl.TempTOTPTokenClaims{UserID: f.user.ID, WebAuthn: true, AMR: []string{amrPassword}}
+	if _, err := f.usr.BeginWebAuthnLogin(ctx, temp); errCode(t, err) != "WEBAUTHN_2FA_NOT_ENABLED" {
+		t.Fatalf("got %v, want WEBAUTHN_2FA_NOT_ENABLED", err)
+	}
+
+	f.enableSecondFactor(t)
+	f.tokens.claims = nil
+	user = f.store.users[f.user.ID]
+	if _, _, err := f.usr.continueLogin(ctx, &user, []string{amrPassword}, f.client); err != nil {
+		t.Fatal(err)
+	}
+	if f.tokens.claims != nil {
+		t.Fatal("the session was opened without the passkey")
+	}
+	if err := f.login(t, sa, temp); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(f.store.audit, auditWebAuthnEnabled) {
+		t.Error("the opt in isn't audited")
+	}
+}
+
+func TestWebAuthnSecondFactorWithoutPasskeys(t *testing.T) {
+	f := newWebAuthnFixture(t)
+
+	err := f.usr.EnableWebAuthnSecondFactor(context.Background(), f.claims(), f.client)
+	if code := errCode(t, err); code != "WEBAUTHN_NOT_REGISTERED" {
+		t.Fatalf("got %q, want WEBAUTHN_NOT_REGISTERED", code)
+	}
+}
+
+func TestWebAuthnLastPasskeyRemovedDropsOptIn(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	f.register(t)
+	f.enableSecondFactor(t)
+
+	// the session went through the passkey
+	claims := f.claims()
+	claims.AMR = []string{amrPassword, amrHardwareKey, amrMFA}
+	if err := f.usr.DeleteWebAuthnCredential(context.Background(), claims, f.store.credential(0).ID, f.client); err != nil {
+		t.Fatal(err)
+	}
+	if f.store.users[f.user.ID].WebauthnSecondFactor {
+		t.Error("the opt in outlived the passkeys")
+	}
+}
+
+func TestWebAuthnLoginFailsWithoutCounterUpdate(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+
+	f.db.exec["UseWebAuthnCredential"] = func(args []any) (int64, error) {
+		return 0, errors.New("connection reset")
+	}
+	err := f.login(t, sa, nil)
+	if code := errCode(t, err); code != "INTERNAL_ERROR" {
+		t.Fatalf("got %q, want INTERNAL_ERROR", code)
+	}
+	if f.tokens.claims != nil {
+		t.Error("a session was opened with a stale sign count")
+	}
+}
+
+func TestWebAuthnLoginRefusedWhenTheCounterWasAlreadyUsed(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+
+	// another login stored the same counter meanwhile
+	f.db.exec["UseWebAuthnCredential"] = func(args []any) (int64, error) {
+		return 0, nil
+	}
+	err := f.login(t, sa, nil)
+	if code := errCode(t, err); code != "WEBAUTHN_CLONED_AUTHENTICATOR" {
+		t.Fatalf("got %q, want WEBAUTHN_CLONED_AUTHENTICATOR", code)
+	}
+	if f.tokens.claims != nil {
+		t.Error("a session was opened with a counter already used")
+	}
+}
+
+func TestWebAuthnChallengeReplay(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+	ctx := context.Background()
+
+	options, err := f.usr.BeginWebAuthnLogin(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := &dtos.WebAuthnLoginDTO{
+		ChallengeID: options.ChallengeID,
+		Credential:  sa.get(options.Options),
+	}
+	if _, _, err := f.usr.FinishWebAuthnLogin(ctx, input, f.client); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same answer again: the challenge was consumed
+	_, _, err = f.usr.FinishWebAuthnLogin(ctx, input, f.client)
+	if code := errCode(t, err); code != "WEBAUTHN_CHALLENGE_EXPIRED" {
+		t.Errorf("replay: got %q, want WEBAUTHN_CHALLENGE_EXPIRED", code)
+	}
+}
+
+func TestWebAuthnExpiredChallenge(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+	ctx := context.Background()
+
+	options, err := f.usr.BeginWebAuthnLogin(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id pgtype.UUID
+	if err := id.Scan(options.ChallengeID); err != nil {
+		t.Fatal(err)
+	}
+	f.store.mu.Lock()
+	challenge := f.store.challenges[id]
+	challenge.ExpiresAt = pgtype.Timestamptz{Time: time.Now().Add(-time.Second), Valid: true}
+	f.store.challenges[id] = challenge
+	f.store.mu.Unlock()
+
+	_, _, err = f.usr.FinishWebAuthnLogin(ctx, &dtos.WebAuthnLoginDTO{
+		ChallengeID: options.ChallengeID,
+		Credential:  sa.get(options.Options),
+	}, f.client)
+	if code := errCode(t, err); code != "WEBAUTHN_CHALLENGE_EXPIRED" {
+		t.Errorf("got %q, want WEBAUTHN_CHALLENGE_EXPIRED", code)
+	}
+}
+
+func TestWebAuthnChallengeOfAnotherCeremony(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+	ctx := context.Background()
+
+	// a second key, the session went through the first one
+	claims := f.claims()
+	claims.AMR = []string{amrHardwareKey, amrMFA}
+	options, err := f.usr.BeginWebAuthnRegistration(ctx, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = f.usr.FinishWebAuthnLogin(ctx, &dtos.WebAuthnLoginDTO{
+		ChallengeID: options.ChallengeID,
+		Credential:  sa.sign(options.Options.(*protocol.CredentialCreation).Response.Challenge),
+	}, f.client)
+	if code := errCode(t, err); code != "WEBAUTHN_CHALLENGE_EXPIRED" {
+		t.Errorf("got %q, want WEBAUTHN_CHALLENGE_EXPIRED", code)
+	}
+}
+
+func TestWebAuthnSignCountRegression(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	sa := f.register(t)
+
+	if err := f.login(t, sa, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.tokens.claims = nil
+
+	// a copy of the key still at the previous counter
+	sa.signCount--
+	err := f.login(t, sa, nil)
+	if code := errCode(t, err); code != "WEBAUTHN_CLONED_AUTHENTICATOR" {
+		t.Fatalf("got %q, want WEBAUTHN_CLONED_AUTHENTICATOR", code)
+	}
+	if f.tokens.claims != nil {
+		t.Error("a session was opened")
+	}
+}
@@ -0,0 +1,64 @@
+package clientinfo
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// extractor reads the client address of a request: the connection address
+// unless the request comes through a trusted proxy
+var extractor = echo.ExtractIPDirect()
+
+// TrustProxies honours X-Forwarded-For on the requests coming from the given
+// addresses or CIDR ranges only, set once at startup. The address is the
+// first entry not added by a trusted proxy, a client can't pick its own
+func TrustProxies(proxies []string) error {
+	if len(proxies) == 0 {
+		extractor = echo.ExtractIPDirect()
+		return nil
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	extractor = echo.ExtractIPFromXFFHeader(options...)
+	return nil
+}
+
+// IP returns the address of the client without the port, so it's stable
+// across connections (ip lockout and rate limit keys)
+func IP(c echo.Context) string {
+	return extractor(c.Request())
+}
+
+// Protocol returns the ALPN like name of the HTTP version used (h3, h2, http/1.1)
+func Protocol(c echo.Context) string {
+	switch c.Request().ProtoMajor {
+	case 3:
+		return "h3"
+	case 2:
+		return "h2"
+	default:
+		return "http/1.1"
+	}
+}
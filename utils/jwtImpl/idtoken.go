@@ -0,0 +1,40 @@
+package jwtImpl
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenClaims is the OpenID Connect ID token, its audience is the client
+// and the profile claims depend on the granted scopes
+type IDTokenClaims struct {
+	Nonce             string           `json:"nonce,omitempty"`
+	AuthTime          *jwt.NumericDate `json:"auth_time,omitempty"`
+	ACR               string           `json:"acr,omitempty"`
+	AMR               []string         `json:"amr,omitempty"`
+	Email             string           `json:"email,omitempty"`
+	EmailVerified     *bool            `json:"email_verified,omitempty"`
+	PreferredUsername string           `json:"preferred_username,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ErrNoSigningKey is returned when the tokens are HS256 signed, the relying
+// parties can't verify an ID token without the public key
+var ErrNoSigningKey = errors.New("jwt: ID tokens need an asymmetric signing key")
+
+func GenerateIDToken(data *IDTokenClaims) (string, error) {
+	if currentSigningKey() == nil {
+		return "", ErrNoSigningKey
+	}
+	return sign("id", data, nil)
+}
+
+// SigningAlgorithm is the alg of the active key, empty with HS256
+func SigningAlgorithm() string {
+	sk := currentSigningKey()
+	if sk == nil {
+		return ""
+	}
+	return sk.Method.Alg()
+}
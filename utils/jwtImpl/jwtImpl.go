@@ -10,52 +10,83 @@ import (
 )
 
 type CustomAccessTokenClaims struct {
-	UserID pgtype.UUID `json:"user_id"`
-	Role   string      `json:"role"`
-	Email  string      `json:"email"`
+	UserID       pgtype.UUID `json:"user_id"`
+	Role         string      `json:"role"`
+	Email        string      `json:"email"`
+	SessionID    pgtype.UUID `json:"sid"`
+	TokenVersion int32       `json:"ver"`
+	// space separated scopes granted to the token (RFC 8693 format)
+	Scope string `json:"scope,omitempty"`
+	// oauth client the token was issued to, empty for the first party app
+	ClientID string `json:"client_id,omitempty"`
+	// how and when the user logged in (RFC 8176 methods) and the level it
+	// reached (aal1, aal2), kept by the refresh and renewed by a step up
+	AMR      []string         `json:"amr,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// the second factors the user can answer the temp token with
 type TempTOTPTokenClaims struct {
-	UserID pgtype.UUID `json:"user_id"`
-	Role   string      `json:"role"`
-	Email  string      `json:"email"`
-	TOTP   bool        `json:"totp"`
+	UserID   pgtype.UUID `json:"user_id"`
+	Role     string      `json:"role"`
+	Email    string      `json:"email"`
+	TOTP     bool        `json:"totp"`
+	WebAuthn bool        `json:"webauthn,omitempty"`
+	SMS      bool        `json:"sms,omitempty"`
+	EmailOTP bool        `json:"email_otp,omitempty"`
+	// methods of the first step of the login (pwd, email for a magic link)
+	AMR []string `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// the session id is also the family of the refresh token
 type CustomRefreshTokenClaims struct {
-	UserID pgtype.UUID `json:"user_id"`
+	UserID       pgtype.UUID `json:"user_id"`
+	SessionID    pgtype.UUID `json:"sid"`
+	TokenVersion int32       `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-var (
-	jwt_sec     string = config.AppConfig.JWTSEC
-	jwt_ref_sec string = config.AppConfig.JWTREFSEC
-)
+// refresh tokens are long lived, the DB row decides if they can still be used
+const RefreshTokenTTL = time.Hour * 24 * 7
+
+// secrets are read on use, the config is loaded after package init
+func accessSecret() []byte {
+	return []byte(config.AppConfig.JWTSEC)
+}
+
+func refreshSecret() []byte {
+	return []byte(config.AppConfig.JWTREFSEC)
+}
+
+func tempSecret() []byte {
+	return []byte(config.AppConfig.JWTTOTP)
+}
 
-func GenerateToken(data *CustomAccessTokenClaims) (string, string, error) {
+// typ header of the tokens signed with an asymmetric key, the kinds share
+// the keys so the header keeps one from being used as another
+var tokenTypes = map[string]string{
+	"access":  "at+jwt",
+	"refresh": "rt+jwt",
+	"temp":    "totp+jwt",
+	"id":      "JWT",
+}
+
+func GenerateToken(data *CustomAccessTokenClaims, refData *CustomRefreshTokenClaims) (string, string, error) {
 
 	/*claims := jwt.MapClaims{
 		"sub": user_id,
 		"exp": time.Now().Add(time.Hour * 2).Unix(),
 	} */
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, data)
-	signedToken, err := accessToken.SignedString([]byte(jwt_sec))
+	signedToken, err := sign("access", data, accessSecret())
 	if err != nil {
 		return "", "", err
 	}
 
 	// refresh token sign
-	refreshTokenClaims := CustomRefreshTokenClaims{
-		UserID: data.UserID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)),
-		},
-	}
-
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	signedRefToken, err := refreshToken.SignedString([]byte(jwt_ref_sec))
+	signedRefToken, err := sign("refresh", refData, refreshSecret())
 	if err != nil {
 		return "", "", err
 	}
@@ -63,43 +94,46 @@ func GenerateToken(data *CustomAccessTokenClaims) (string, string, error) {
 	return signedToken, signedRefToken, nil
 }
 
-func GenerateTempToken(data *TempTOTPTokenClaims) (string, error) {
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, data)
-	signedToken, err := accessToken.SignedString([]byte(jwt_sec))
-	if err != nil {
-		return "", err
+// GenerateAccessToken signs an access token without refresh token (service
+// accounts get a new one with their credentials)
+func GenerateAccessToken(data *CustomAccessTokenClaims) (string, error) {
+	return sign("access", data, accessSecret())
+}
+
+// sign uses the active asymmetric key (kid and typ in the header) so other
+// services can verify with the JWKS, HS256 with the secret of the type otherwise
+func sign(typ string, claims jwt.Claims, secret []byte) (string, error) {
+	sk := currentSigningKey()
+	if sk == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
 	}
 
-	return signedToken, nil
+	token := jwt.NewWithClaims(sk.Method, claims)
+	token.Header["kid"] = sk.ID
+	token.Header["typ"] = tokenTypes[typ]
+	return token.SignedString(sk.Private)
 }
 
-func RefreshAccessToken(reftok string, old string) (string, error) {
-
-	parsedAccToken, _, err := ParseExtractClaims(old, "access", jwt_sec)
+// ParseRefreshToken checks the signature and expiry of a refresh token
+func ParseRefreshToken(tok string) (*CustomRefreshTokenClaims, error) {
+	parsedToken, valid, err := ParseExtractClaims(tok, "refresh", string(refreshSecret()))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.New("reftok not valid")
 	}
-	accClaims := parsedAccToken.Claims.(*CustomAccessTokenClaims)
 
-	_, valid, err := ParseExtractClaims(old, "refresh", jwt_sec)
-	if err != nil || !valid {
-		if !valid {
-			return "", errors.New("reftok not valid")
-		}
+	return parsedToken.Claims.(*CustomRefreshTokenClaims), nil
+}
+
+func GenerateTempToken(data *TempTOTPTokenClaims) (string, error) {
+	signedToken, err := sign("temp", data, tempSecret())
+	if err != nil {
 		return "", err
 	}
-	// Generate new access token
-	newAccessTokenClaims := CustomAccessTokenClaims{
-		UserID: accClaims.UserID,
-		Role:   accClaims.Role,
-		Email:  accClaims.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 15)), // 15 minutes expiration
-		},
-	}
 
-	newAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newAccessTokenClaims)
-	return newAccessToken.SignedString([]byte(jwt_sec))
+	return signedToken, nil
 }
 
 func ParseExtractClaims(tok string, typ string, secret string) (jwt.Token, bool, error) {
@@ -118,11 +152,23 @@ func ParseExtractClaims(tok string, typ string, secret string) (jwt.Token, bool,
 
 	// Parse the token
 	parsedToken, err := jwt.ParseWithClaims(tok, claims, func(token *jwt.Token) (interface{}, error) {
-		// Check the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+		// tokens signed before a signing key was configured
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			// an empty secret would let anyone sign
+			if secret == "" {
+				return nil, errors.New("no secret for HMAC tokens")
+			}
+			return []byte(secret), nil
+		}
+		// access tokens signed before the typ header was added have none
+		header, _ := token.Header["typ"].(string)
+		if header != tokenTypes[typ] && (typ != "access" || header != "") {
+			return nil, errors.New("unexpected token type")
 		}
-		return []byte(secret), nil
+
+		// the kid picks the verification key
+		kid, _ := token.Header["kid"].(string)
+		return verificationKey(kid, token.Method)
 	})
 
 	if err != nil {
@@ -0,0 +1,195 @@
+package jwtImpl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/BigBr41n/echoAuth/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric key signing the access tokens, the public part
+// is published in the JWKS so other services can verify them
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// Public returns the verification key
+func (sk *SigningKey) Public() crypto.PublicKey {
+	return sk.Private.Public()
+}
+
+var (
+	keysMu sync.RWMutex
+	// verification keys by kid
+	signingKeys = map[string]*SigningKey{}
+	// key signing the new access tokens, HS256 with JWT_SECRET when nil
+	activeKey *SigningKey
+)
+
+// NewSigningKey picks the algorithm from the key type: RS256 for RSA, ES256
+// for P-256 and EdDSA for Ed25519. The kid defaults to the RFC 7638 thumbprint
+func NewSigningKey(private crypto.Signer, kid string) (*SigningKey, error) {
+	var method jwt.SigningMethod
+
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("jwt: RSA keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("jwt: only P-256 EC keys are supported (ES256)")
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("jwt: unsupported key type %T", private)
+	}
+
+	sk := &SigningKey{
+		ID:      kid,
+		Method:  method,
+		Private: private,
+	}
+	if sk.ID == "" {
+		thumbprint, err := Thumbprint(sk.Public())
+		if err != nil {
+			return nil, err
+		}
+		sk.ID = thumbprint
+	}
+
+	return sk, nil
+}
+
+// ParsePrivateKeyPEM reads a PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt: no PEM block found")
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("jwt: unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// LoadSigningKeys loads the key of JWT_SIGNING_KEY_FILE, without it the access
+// tokens stay HS256 signed with JWT_SECRET
+func LoadSigningKeys() error {
+	if config.AppConfig.JWTSigningKeyFile == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(config.AppConfig.JWTSigningKeyFile)
+	if err != nil {
+		return err
+	}
+	private, err := ParsePrivateKeyPEM(raw)
+	if err != nil {
+		return err
+	}
+	sk, err := NewSigningKey(private, config.AppConfig.JWTSigningKID)
+	if err != nil {
+		return err
+	}
+
+	AddSigningKey(sk, true)
+	return nil
+}
+
+// AddSigningKey registers a verification key, active makes it sign the new
+// access tokens
+func AddSigningKey(sk *SigningKey, active bool) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	signingKeys[sk.ID] = sk
+	if active {
+		activeKey = sk
+	}
+}
+
+// SetSigningKeys replaces every key at once, used when a key ring is reloaded.
+// A nil active key goes back to HS256
+func SetSigningKeys(active *SigningKey, verifyOnly []*SigningKey) {
+	keys := make(map[string]*SigningKey, len(verifyOnly)+1)
+	for _, sk := range verifyOnly {
+		keys[sk.ID] = sk
+	}
+	if active != nil {
+		keys[active.ID] = active
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	signingKeys = keys
+	activeKey = active
+}
+
+// currentSigningKey returns the key signing the access tokens, nil for HS256
+func currentSigningKey() *SigningKey {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return activeKey
+}
+
+// verificationKey returns the public key of the kid if it was registered for
+// the algorithm of the token
+func verificationKey(kid string, method jwt.SigningMethod) (crypto.PublicKey, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	sk, ok := signingKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if sk.Method.Alg() != method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return sk.Public(), nil
+}
+
+// publicKeys returns every registered verification key
+func publicKeys() []*SigningKey {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(signingKeys))
+	for _, sk := range signingKeys {
+		keys = append(keys, sk)
+	}
+	return keys
+}
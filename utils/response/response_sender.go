@@ -40,6 +40,10 @@ func ErrResp(c echo.Context, resp error) error {
 		ApiError.Err = "Internal Server Error"
 	}
 
+	for key, val := range ApiError.Headers {
+		c.Response().Header().Set(key, val)
+	}
+
 	return c.JSON(ApiError.Status, dtos.ApiErr{
 		Status:  ApiError.Status,
 		Code:    ApiError.Code,
@@ -47,3 +51,32 @@ func ErrResp(c echo.Context, resp error) error {
 		Details: ApiError.Details,
 	})
 }
+
+// OAuthErrResp answers the oauth endpoints in the RFC 6749 format, the code of
+// the ApiErr is the oauth error (invalid_client, invalid_request...)
+func OAuthErrResp(c echo.Context, resp error) error {
+	ApiError, ok := resp.(*dtos.ApiErr)
+	if !ok {
+		logger.Error("Unknown error", zap.Error(resp))
+		ApiError = &dtos.ApiErr{
+			Status: http.StatusInternalServerError,
+			Code:   "server_error",
+			Err:    resp.Error(),
+		}
+	}
+
+	if (os.Getenv("ECHO_AUTH_APP") == "prod") && (ApiError.Status == 500) {
+		ApiError.Err = "Internal Server Error"
+	}
+
+	for key, val := range ApiError.Headers {
+		c.Response().Header().Set(key, val)
+	}
+
+	// tokens and their metadata must not be cached
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(ApiError.Status, dtos.OAuthErr{
+		Error:       ApiError.Code,
+		Description: ApiError.Err,
+	})
+}
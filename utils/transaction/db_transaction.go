@@ -5,10 +5,14 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func StartTransaction(ctx context.Context, db *pgxpool.Pool) (pgx.Tx, error) {
+// Beginner starts the transactions, the pgx pool in the app
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+func StartTransaction(ctx context.Context, db Beginner) (pgx.Tx, error) {
 	tx, err := db.Begin(ctx)
 
 	if err != nil {